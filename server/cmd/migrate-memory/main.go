@@ -0,0 +1,47 @@
+// Command migrate-memory imports memory_*.json dumps into append-only
+// memory logs usable with "memory_backend": "log".
+package main
+
+import (
+	"chak-server/internal/memory"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func main() {
+	szDir := flag.String("dir", ".", "directory containing the memory files")
+	szPattern := flag.String("pattern", "memory_*.json", "glob of JSON memory files to import")
+	bForce := flag.Bool("force", false, "import into logs that already exist")
+	flag.Parse()
+
+	matches, err := filepath.Glob(filepath.Join(*szDir, *szPattern))
+	if err != nil {
+		log.Fatalf("Invalid pattern: %v", err)
+	}
+
+	if len(matches) == 0 {
+		fmt.Println("No memory files found")
+		return
+	}
+
+	for _, szJSONFile := range matches {
+		szLogFile := strings.TrimSuffix(szJSONFile, filepath.Ext(szJSONFile)) + ".log"
+
+		if _, err := os.Stat(szLogFile); err == nil && !*bForce {
+			fmt.Printf("Skipping %s: %s already exists (use -force to merge)\n", szJSONFile, szLogFile)
+			continue
+		}
+
+		inImported, err := memory.MigrateJSONToLog(szJSONFile, szLogFile)
+		if err != nil {
+			log.Printf("Failed to migrate %s: %v", szJSONFile, err)
+			continue
+		}
+
+		fmt.Printf("Imported %d memories from %s into %s\n", inImported, szJSONFile, szLogFile)
+	}
+}
@@ -1,14 +1,106 @@
 package config
 
+import "time"
+
 type Profile struct {
 	SzID string `json:"id"`
 	SzName string `json:"name"`
 	SzDescription string `json:"description"`
 	SzDirectories []string `json:"directories"`
 	SzMemoryFile string `json:"memory_file"`
+	SzMemoryBackend string `json:"memory_backend"`
 	SzIndexFile string `json:"index_file"`
+	SzSessionDir string `json:"session_dir,omitempty"`
 	Extensions []string `json:"extensions"`
 	InMaxSizeFile int64 `json:"max_file_size"`
+	Include []string `json:"include,omitempty"`
+	Exclude []string `json:"exclude,omitempty"`
+	BFollowSymlinks bool `json:"follow_symlinks,omitempty"`
+	BSkipHidden bool `json:"skip_hidden,omitempty"`
+	BOneFilesystem bool `json:"one_filesystem,omitempty"`
+	Retrieval RetrievalConfig `json:"retrieval"`
+	Chunking ChunkingConfig `json:"chunking"`
+	Memory MemoryConfig `json:"memory"`
+}
+
+type RetrievalConfig struct {
+	BExactSearch bool `json:"exact_search"`
+	SzFusion string `json:"fusion,omitempty"`
+	FlVectorWeight float64 `json:"vector_weight,omitempty"`
+	FlKeywordWeight float64 `json:"keyword_weight,omitempty"`
+	InRRFK int `json:"rrf_k,omitempty"`
+	SzRerankModel string `json:"rerank_model,omitempty"`
+	InRerankCandidates int `json:"rerank_candidates,omitempty"`
+	InRerankTopN int `json:"rerank_top_n,omitempty"`
+}
+
+// ChunkingConfig controls how indexed files are cut into chunks.
+type ChunkingConfig struct {
+	BCodeAware bool `json:"code_aware"`
+	InTargetTokens int `json:"target_tokens,omitempty"`
+	InOverlapTokens int `json:"overlap_tokens,omitempty"`
+	InParentTokens int `json:"parent_tokens,omitempty"`
+}
+
+// MemoryConfig keeps conversation memories from piling up. A memory more
+// similar than DedupThreshold (cosine, 0 disables it) to a stored one of
+// the same type is not saved. With a SummaryModel, conversation memories
+// older than ConsolidateAfterHours are clustered every
+// ConsolidateIntervalMinutes, and each cluster of at least MinClusterSize
+// memories closer than ClusterThreshold is replaced by one summary.
+type MemoryConfig struct {
+	FlDedupThreshold float64 `json:"dedup_threshold,omitempty"`
+	SzSummaryModel string `json:"summary_model,omitempty"`
+	InConsolidateAfterHours int `json:"consolidate_after_hours,omitempty"`
+	InConsolidateIntervalMinutes int `json:"consolidate_interval_minutes,omitempty"`
+	FlClusterThreshold float64 `json:"cluster_threshold,omitempty"`
+	InMinClusterSize int `json:"min_cluster_size,omitempty"`
+}
+
+const (
+	MemoryBackendJSON = "json"
+	MemoryBackendLog = "log"
+)
+
+const (
+	DefaultGenerateTimeout = 5 * time.Minute
+	DefaultSearchTimeout = 15 * time.Second
+	DefaultEmbedTimeout = 30 * time.Second
+	DefaultRerankTimeout = 60 * time.Second
+
+	DefaultRerankCandidates = 30
+	DefaultContextTopN = 3
+
+	DefaultFullScanInterval = time.Hour
+	DefaultWatchDebounce = 500 * time.Millisecond
+	DefaultIndexWorkers = 4
+	DefaultEmbedBatchSize = 32
+
+	DefaultConsolidateAfter = 7 * 24 * time.Hour
+	DefaultConsolidateInterval = time.Hour
+)
+
+// TimeoutConfig holds the deadline of each outbound stage in seconds.
+// A zero value falls back to the matching default.
+type TimeoutConfig struct {
+	InGenerateSeconds int `json:"generate_seconds"`
+	InSearchSeconds int `json:"search_seconds"`
+	InEmbedSeconds int `json:"embed_seconds"`
+	InRerankSeconds int `json:"rerank_seconds"`
+}
+
+// IndexerConfig tunes the document watcher. Changes are picked up from
+// filesystem events after a quiet period of DebounceMs; the full rescan
+// every FullScanMinutes only catches what the events missed. SzHash names
+// the content hash used to detect changes: md5 (default), sha256 or
+// xxhash64. Workers files are indexed in parallel, their chunks embedded
+// EmbedBatchSize per request.
+type IndexerConfig struct {
+	InFullScanMinutes int `json:"full_scan_minutes"`
+	InDebounceMs int `json:"debounce_ms"`
+	SzHash string `json:"hash,omitempty"`
+	InWorkers int `json:"workers,omitempty"`
+	InEmbedBatchSize int `json:"embed_batch_size,omitempty"`
 }
 
 type ConfigInterface interface {
@@ -16,10 +108,113 @@ type ConfigInterface interface {
 	SwitchProfile(szName string) error
 	ListProfile() []Profile
 	GetProfile(szName string) (Profile, error)
+	GetTimeouts() TimeoutConfig
+	GetIndexer() IndexerConfig
 }
 
 type Config struct {
 	SzActiveProfile string `json:"active_profile"`
+	Timeouts TimeoutConfig `json:"timeouts"`
+	Indexer IndexerConfig `json:"indexer"`
 	Profiles map[string]Profile `json:"profiles"`
 }
 
+// SessionDir is where the conversations of the profile are kept, by
+// default sessions_<id>.
+func (profile Profile) SessionDir() string {
+	if profile.SzSessionDir == "" {
+		return "sessions_" + profile.SzID
+	}
+	return profile.SzSessionDir
+}
+
+func (timeouts TimeoutConfig) Generate() time.Duration {
+	return secondsOrDefault(timeouts.InGenerateSeconds, DefaultGenerateTimeout)
+}
+
+func (timeouts TimeoutConfig) Search() time.Duration {
+	return secondsOrDefault(timeouts.InSearchSeconds, DefaultSearchTimeout)
+}
+
+func (timeouts TimeoutConfig) Embed() time.Duration {
+	return secondsOrDefault(timeouts.InEmbedSeconds, DefaultEmbedTimeout)
+}
+
+func (timeouts TimeoutConfig) Rerank() time.Duration {
+	return secondsOrDefault(timeouts.InRerankSeconds, DefaultRerankTimeout)
+}
+
+func (indexer IndexerConfig) FullScanInterval() time.Duration {
+	if indexer.InFullScanMinutes <= 0 {
+		return DefaultFullScanInterval
+	}
+	return time.Duration(indexer.InFullScanMinutes) * time.Minute
+}
+
+func (indexer IndexerConfig) Debounce() time.Duration {
+	if indexer.InDebounceMs <= 0 {
+		return DefaultWatchDebounce
+	}
+	return time.Duration(indexer.InDebounceMs) * time.Millisecond
+}
+
+func (indexer IndexerConfig) Workers() int {
+	if indexer.InWorkers <= 0 {
+		return DefaultIndexWorkers
+	}
+	return indexer.InWorkers
+}
+
+func (indexer IndexerConfig) EmbedBatchSize() int {
+	if indexer.InEmbedBatchSize <= 0 {
+		return DefaultEmbedBatchSize
+	}
+	return indexer.InEmbedBatchSize
+}
+
+// TopN is the number of memories placed into the prompt.
+func (retrieval RetrievalConfig) TopN() int {
+	if retrieval.InRerankTopN <= 0 {
+		return DefaultContextTopN
+	}
+	return retrieval.InRerankTopN
+}
+
+// Candidates is the number of memories fetched before reranking. Without a
+// rerank model there is nothing to narrow down, so it equals TopN.
+func (retrieval RetrievalConfig) Candidates() int {
+	if retrieval.SzRerankModel == "" {
+		return retrieval.TopN()
+	}
+	if retrieval.InRerankCandidates <= 0 {
+		return max(DefaultRerankCandidates, retrieval.TopN())
+	}
+	return max(retrieval.InRerankCandidates, retrieval.TopN())
+}
+
+// ConsolidateAfter is the age at which conversation memories are
+// consolidated, or 0 when no summary model is set.
+func (memory MemoryConfig) ConsolidateAfter() time.Duration {
+	if memory.SzSummaryModel == "" {
+		return 0
+	}
+	if memory.InConsolidateAfterHours <= 0 {
+		return DefaultConsolidateAfter
+	}
+	return time.Duration(memory.InConsolidateAfterHours) * time.Hour
+}
+
+func (memory MemoryConfig) ConsolidateInterval() time.Duration {
+	if memory.InConsolidateIntervalMinutes <= 0 {
+		return DefaultConsolidateInterval
+	}
+	return time.Duration(memory.InConsolidateIntervalMinutes) * time.Minute
+}
+
+func secondsOrDefault(inSeconds int, tmDefault time.Duration) time.Duration {
+	if inSeconds <= 0 {
+		return tmDefault
+	}
+	return time.Duration(inSeconds) * time.Second
+}
+
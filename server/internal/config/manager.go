@@ -27,7 +27,7 @@ func NewConfigManager(szConfigFilePath string) *ConfigManager {
 func (cfgMgr *ConfigManager) loadConfig() error {
 	data, err := os.ReadFile(cfgMgr.szConfigFilePath)
 	if err != nil {
-		fmt.Printf("Failed to load config: %w \n", err)
+		fmt.Printf("Failed to load config: %v \n", err)
 		return nil
 	}
 	return json.Unmarshal(data, &cfgMgr.config)
@@ -87,3 +87,17 @@ func (cfgMgr *ConfigManager) GetProfile(szName string) (Profile, error) {
 
 	return profile, nil
 }
+
+func (cfgMgr *ConfigManager) GetTimeouts() TimeoutConfig {
+	cfgMgr.mu.RLock()
+	defer cfgMgr.mu.RUnlock()
+
+	return cfgMgr.config.Timeouts
+}
+
+func (cfgMgr *ConfigManager) GetIndexer() IndexerConfig {
+	cfgMgr.mu.RLock()
+	defer cfgMgr.mu.RUnlock()
+
+	return cfgMgr.config.Indexer
+}
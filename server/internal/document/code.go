@@ -0,0 +1,503 @@
+package document
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// sourceExtensionMap lists the extensions ChunkCode understands, marking
+// the languages that use "#" for line comments.
+var sourceExtensionMap = map[string]bool{
+	".go": false, ".c": false, ".h": false, ".cc": false, ".cpp": false, ".hpp": false, ".cs": false,
+	".java": false, ".kt": false, ".kts": false, ".scala": false, ".swift": false, ".rs": false,
+	".js": false, ".jsx": false, ".mjs": false, ".cjs": false, ".ts": false, ".tsx": false, ".php": false,
+	".py": true, ".rb": true, ".sh": true, ".bash": true, ".pl": true, ".r": true, ".lua": false,
+}
+
+// IsSourceFile reports whether ChunkCode can split files with this
+// extension on their declarations.
+func IsSourceFile(szExtension string) bool {
+	_, exists := sourceExtensionMap[strings.ToLower(szExtension)]
+	return exists
+}
+
+// codeChunker holds the lines of one source file while it is split.
+// lineTokens[i] is the token count of the lines before line i+1.
+type codeChunker struct {
+	lines []string
+	lineTokens []int
+	bHashComments bool
+	inMaxTokens int
+}
+
+// codeBlock is a run of source lines (1-based, inclusive) holding one or
+// more top-level declarations.
+type codeBlock struct {
+	inStart int
+	inEnd int
+	szSymbol string
+	szKind string
+}
+
+// ChunkCode splits source code on its top-level declarations (functions,
+// methods, types) instead of on prose boundaries. Go is parsed with
+// go/parser; other languages use a brace and indentation heuristic. Every
+// segment records "symbol", "kind", "start_line" and "end_line" metadata.
+// Declarations larger than inMaxTokens are split into their members where
+// possible, otherwise by lines. Chunks do not overlap so that their line
+// ranges stay exact.
+func ChunkCode(szExtension string, szText string, inMaxTokens int) []Segment {
+	szExtension = strings.ToLower(szExtension)
+	chunker := &codeChunker{
+		lines: strings.Split(strings.ReplaceAll(szText, "\r\n", "\n"), "\n"),
+		bHashComments: sourceExtensionMap[szExtension],
+		inMaxTokens: inMaxTokens,
+	}
+	chunker.lineTokens = make([]int, len(chunker.lines)+1)
+	for i, szLine := range chunker.lines {
+		chunker.lineTokens[i+1] = chunker.lineTokens[i] + EstimateTokens(szLine)
+	}
+
+	var blocks []codeBlock
+	if szExtension == ".go" {
+		blocks = goBlocks(szText, len(chunker.lines))
+	}
+	if blocks == nil {
+		blocks = chunker.heuristicBlocks(0, len(chunker.lines), "")
+	}
+
+	var segments []Segment
+	for _, block := range chunker.mergeSmallBlocks(blocks) {
+		for _, piece := range chunker.splitLargeBlock(block) {
+			szChunk := strings.Trim(strings.Join(chunker.lines[piece.inStart-1:piece.inEnd], "\n"), "\n")
+			if strings.TrimSpace(szChunk) == "" {
+				continue
+			}
+
+			// Only a single over-long line, as in minified files, is still
+			// too big here.
+			parts := []string{szChunk}
+			if piece.inStart == piece.inEnd && chunker.size(piece.inStart, piece.inEnd) > inMaxTokens {
+				parts = ChunkByTokens(szChunk, inMaxTokens)
+			}
+			for _, szPart := range parts {
+				metadataMap := map[string]string{
+					"kind": piece.szKind,
+					"start_line": strconv.Itoa(piece.inStart),
+					"end_line": strconv.Itoa(piece.inEnd),
+				}
+				if piece.szSymbol != "" {
+					metadataMap["symbol"] = piece.szSymbol
+				}
+				segments = append(segments, Segment{SzText: szPart, MetadataMap: metadataMap})
+			}
+		}
+	}
+
+	return segments
+}
+
+// goBlocks returns one block per top-level Go declaration, with its doc
+// comment and any lines since the previous declaration. It returns nil when
+// the file does not parse so the heuristic splitter can take over.
+func goBlocks(szText string, inLineCount int) []codeBlock {
+	fileSet := token.NewFileSet()
+	file, err := parser.ParseFile(fileSet, "", szText, parser.ParseComments)
+	if err != nil || len(file.Decls) == 0 {
+		return nil
+	}
+
+	var blocks []codeBlock
+	inNext := 1
+	for _, decl := range file.Decls {
+		block := codeBlock{inStart: inNext, inEnd: fileSet.Position(decl.End()).Line}
+
+		switch typed := decl.(type) {
+		case *ast.FuncDecl:
+			block.szKind = "function"
+			block.szSymbol = typed.Name.Name
+			if typed.Recv != nil && len(typed.Recv.List) > 0 {
+				block.szKind = "method"
+				block.szSymbol = receiverName(typed.Recv.List[0].Type) + "." + typed.Name.Name
+			}
+		case *ast.GenDecl:
+			block.szKind = typed.Tok.String()
+			var names []string
+			for _, spec := range typed.Specs {
+				switch typedSpec := spec.(type) {
+				case *ast.TypeSpec:
+					names = append(names, typedSpec.Name.Name)
+				case *ast.ValueSpec:
+					for _, name := range typedSpec.Names {
+						names = append(names, name.Name)
+					}
+				case *ast.ImportSpec:
+					names = append(names, strings.Trim(typedSpec.Path.Value, "\"`"))
+				}
+			}
+			block.szSymbol = strings.Join(names, ", ")
+		}
+
+		blocks = append(blocks, block)
+		inNext = block.inEnd + 1
+	}
+
+	blocks[len(blocks)-1].inEnd = inLineCount
+	return blocks
+}
+
+func receiverName(expr ast.Expr) string {
+	switch typed := expr.(type) {
+	case *ast.StarExpr:
+		return receiverName(typed.X)
+	case *ast.IndexExpr:
+		return receiverName(typed.X)
+	case *ast.IndexListExpr:
+		return receiverName(typed.X)
+	case *ast.Ident:
+		return typed.Name
+	}
+	return ""
+}
+
+// declarationPatterns name the declaration a block starts with. The symbol
+// is the last submatch.
+var declarationPatterns = []struct {
+	szKind string
+	regex *regexp.Regexp
+}{
+	{"function", regexp.MustCompile(`^(?:export\s+)?(?:default\s+)?(?:async\s+)?function\s*\*?\s*([\w$]+)`)},
+	{"function", regexp.MustCompile(`^(?:async\s+)?def\s+(\w+)`)},
+	{"function", regexp.MustCompile(`^(?:pub(?:\([\w:]+\))?\s+)?(?:const\s+)?(?:async\s+)?(?:unsafe\s+)?(?:extern\s+"\w+"\s+)?fn\s+(\w+)`)},
+	{"function", regexp.MustCompile(`^(?:export\s+)?(?:const|let|var)\s+([\w$]+)\s*(?::[^=]+)?=\s*(?:async\s+)?(?:function\b|\([^)]*\)\s*(?::[^=]+)?=>|[\w$]+\s*=>)`)},
+	{"function", regexp.MustCompile(`^(?:(?:public|private|protected|internal|static|final|abstract|override|virtual|async|suspend|inline|open)\s+)*fun(?:ction)?\s+(?:<[^>]*>\s*)?(?:[\w.]+\.)?(\w+)`)},
+	{"class", regexp.MustCompile(`^(?:export\s+)?(?:default\s+)?(?:(?:public|private|protected|internal|static|final|abstract|sealed|partial|data|open|pub(?:\([\w:]+\))?)\s+)*(?:class|object|module)\s+([\w$]+)`)},
+	{"type", regexp.MustCompile(`^(?:export\s+)?(?:declare\s+)?(?:(?:public|private|protected|internal|pub(?:\([\w:]+\))?)\s+)?(?:interface|enum|struct|trait|protocol|type|record|mod)\s+([\w$]+)`)},
+	{"impl", regexp.MustCompile(`^(?:unsafe\s+)?impl(?:<[^>]*>)?\s+(?:[\w:<>, ]+\s+for\s+)?([\w:]+)`)},
+	{"function", regexp.MustCompile(`^(?:(?:public|private|protected|internal|static|final|abstract|override|virtual|async|extern|inline|unsafe|const)\s+)*[\w:<>,\[\]\*&\s]+?[\s\*&]([\w:~]+)\s*\([^;]*$`)},
+}
+
+// heuristicBlocks splits lines[inFrom:inTo] at declaration boundaries: a
+// line indented exactly szIndent, outside any string or comment, at the
+// brace depth the range started with. Comments and decorators directly
+// above a declaration stay with it.
+func (chunker *codeChunker) heuristicBlocks(inFrom int, inTo int, szIndent string) []codeBlock {
+	lines := chunker.lines
+	scanner := &codeScanner{bHashComments: chunker.bHashComments}
+	var boundaries []int
+	inBaseDepth := -1
+
+	for i := inFrom; i < inTo; i++ {
+		bInsideLiteral := scanner.bInComment || scanner.szString != ""
+		inDepth := scanner.inDepth
+		scanner.scanLine(lines[i])
+
+		szLine := lines[i]
+		szTrimmed := strings.TrimSpace(szLine)
+		if szTrimmed == "" || bInsideLiteral || chunker.isCommentOrDecorator(szLine) {
+			continue
+		}
+		if inBaseDepth < 0 {
+			inBaseDepth = inDepth
+		}
+
+		szLeading := szLine[:len(szLine)-len(strings.TrimLeft(szLine, " \t"))]
+		if szLeading != szIndent || inDepth != inBaseDepth || isContinuation(szTrimmed) {
+			continue
+		}
+
+		boundaries = append(boundaries, i)
+	}
+
+	if len(boundaries) == 0 {
+		return []codeBlock{{inStart: inFrom + 1, inEnd: inTo, szKind: "code"}}
+	}
+
+	// Pull leading comments and decorators into the declaration below them.
+	for k, inLine := range boundaries {
+		inFloor := inFrom
+		if k > 0 {
+			inFloor = boundaries[k-1] + 1
+		}
+		for inLine-1 >= inFloor && chunker.isCommentOrDecorator(lines[inLine-1]) {
+			inLine--
+		}
+		boundaries[k] = inLine
+	}
+
+	var blocks []codeBlock
+	for k, inLine := range boundaries {
+		inEnd := inTo
+		if k+1 < len(boundaries) {
+			inEnd = boundaries[k+1]
+		}
+		if k == 0 {
+			inLine = inFrom
+		}
+
+		block := codeBlock{inStart: inLine + 1, inEnd: inEnd}
+		block.szKind, block.szSymbol = chunker.describeDeclaration(lines[inLine:inEnd])
+		blocks = append(blocks, block)
+	}
+
+	return blocks
+}
+
+// continuationPrefixes start lines that carry on the statement above even
+// at declaration indentation, such as an Allman-style brace or a where
+// clause.
+var continuationPrefixes = []string{"{", "}", ")", "]", "where", "else", "elif", "except", "finally", "catch", "end"}
+
+func isContinuation(szTrimmed string) bool {
+	for _, szPrefix := range continuationPrefixes {
+		if strings.HasPrefix(szTrimmed, szPrefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// describeDeclaration names the first declaration line of a block, skipping
+// comments and decorators.
+func (chunker *codeChunker) describeDeclaration(lines []string) (string, string) {
+	for _, szLine := range lines {
+		szTrimmed := strings.TrimSpace(szLine)
+		if szTrimmed == "" || chunker.isCommentOrDecorator(szLine) {
+			continue
+		}
+
+		for _, pattern := range declarationPatterns {
+			if match := pattern.regex.FindStringSubmatch(szTrimmed); match != nil {
+				return pattern.szKind, match[len(match)-1]
+			}
+		}
+		return "code", ""
+	}
+
+	return "code", ""
+}
+
+func (chunker *codeChunker) isCommentOrDecorator(szLine string) bool {
+	szTrimmed := strings.TrimSpace(szLine)
+	if szTrimmed == "" {
+		return false
+	}
+
+	if strings.HasPrefix(szTrimmed, "//") || strings.HasPrefix(szTrimmed, "/*") || strings.HasPrefix(szTrimmed, "*") ||
+		strings.HasPrefix(szTrimmed, "@") || strings.HasPrefix(szTrimmed, "#[") {
+		return true
+	}
+	return chunker.bHashComments && strings.HasPrefix(szTrimmed, "#")
+}
+
+// mergeSmallBlocks joins neighbouring imports, constants and statements
+// while they fit in one chunk. Functions, methods and types always keep a
+// chunk of their own so their symbol metadata stays exact.
+func (chunker *codeChunker) mergeSmallBlocks(blocks []codeBlock) []codeBlock {
+	var merged []codeBlock
+
+	for _, block := range blocks {
+		if len(merged) > 0 {
+			last := &merged[len(merged)-1]
+			if isMergeableKind(last.szKind) && isMergeableKind(block.szKind) &&
+				chunker.size(last.inStart, block.inEnd) <= chunker.inMaxTokens {
+				last.inEnd = block.inEnd
+				last.szSymbol = joinNonEmpty(last.szSymbol, block.szSymbol)
+				if last.szKind != block.szKind {
+					last.szKind = "code"
+				}
+				continue
+			}
+		}
+		merged = append(merged, block)
+	}
+
+	return merged
+}
+
+func isMergeableKind(szKind string) bool {
+	switch szKind {
+	case "import", "const", "var", "code":
+		return true
+	}
+	return false
+}
+
+func joinNonEmpty(szFirst string, szSecond string) string {
+	if szFirst == "" {
+		return szSecond
+	}
+	if szSecond == "" || slices.Contains(strings.Split(szFirst, ", "), szSecond) {
+		return szFirst
+	}
+	return szFirst + ", " + szSecond
+}
+
+// size returns the token count of lines inStart to inEnd (1-based).
+func (chunker *codeChunker) size(inStart int, inEnd int) int {
+	inEnd = min(inEnd, len(chunker.lines))
+	return chunker.lineTokens[inEnd] - chunker.lineTokens[inStart-1]
+}
+
+// splitLargeBlock breaks a block that does not fit in one chunk. Classes
+// and similar containers are split into their members, named
+// "Class.member"; anything else is cut between lines.
+func (chunker *codeChunker) splitLargeBlock(block codeBlock) []codeBlock {
+	if chunker.size(block.inStart, block.inEnd) <= chunker.inMaxTokens {
+		return []codeBlock{block}
+	}
+
+	if block.szKind == "class" || block.szKind == "impl" || block.szKind == "type" {
+		if members := chunker.memberBlocks(block); len(members) > 1 {
+			var pieces []codeBlock
+			for _, member := range chunker.mergeSmallBlocks(members) {
+				pieces = append(pieces, chunker.splitLargeBlock(member)...)
+			}
+			return pieces
+		}
+	}
+
+	var pieces []codeBlock
+	piece := codeBlock{inStart: block.inStart, szSymbol: block.szSymbol, szKind: block.szKind}
+	inSize := 0
+	for i := block.inStart; i <= block.inEnd; i++ {
+		inLineSize := chunker.size(i, i)
+		if inSize > 0 && inSize+inLineSize > chunker.inMaxTokens {
+			piece.inEnd = i - 1
+			pieces = append(pieces, piece)
+			piece = codeBlock{inStart: i, szSymbol: block.szSymbol, szKind: block.szKind}
+			inSize = 0
+		}
+		inSize += inLineSize
+	}
+	piece.inEnd = block.inEnd
+	pieces = append(pieces, piece)
+
+	return pieces
+}
+
+// memberBlocks splits a container body at the indentation of its first
+// member. The container's header lines stay with the first member.
+func (chunker *codeChunker) memberBlocks(block codeBlock) []codeBlock {
+	lines := chunker.lines
+	inHeader := -1
+	for i := block.inStart - 1; i < block.inEnd; i++ {
+		if !chunker.isCommentOrDecorator(lines[i]) && strings.TrimSpace(lines[i]) != "" {
+			inHeader = i
+			break
+		}
+	}
+	if inHeader < 0 {
+		return nil
+	}
+
+	inFirst := -1
+	for i := inHeader + 1; i < block.inEnd; i++ {
+		if strings.TrimSpace(lines[i]) != "" {
+			inFirst = i
+			break
+		}
+	}
+	if inFirst < 0 {
+		return nil
+	}
+	szIndent := lines[inFirst][:len(lines[inFirst])-len(strings.TrimLeft(lines[inFirst], " \t"))]
+	if szIndent == "" {
+		return nil
+	}
+
+	members := chunker.heuristicBlocks(inFirst, block.inEnd, szIndent)
+	members[0].inStart = block.inStart
+	if members[0].szKind == "code" {
+		members[0].szKind = block.szKind
+	}
+	for i := range members {
+		if members[i].szSymbol != "" {
+			members[i].szSymbol = block.szSymbol + "." + members[i].szSymbol
+		} else {
+			members[i].szSymbol = block.szSymbol
+		}
+	}
+	return members
+}
+
+// codeScanner tracks brace depth across lines while skipping strings and
+// comments, which is enough to tell whether a line starts at top level.
+type codeScanner struct {
+	bHashComments bool
+	inDepth int
+	bInComment bool
+	szString string
+}
+
+func (scanner *codeScanner) scanLine(szLine string) {
+	for i := 0; i < len(szLine); i++ {
+		c := szLine[i]
+
+		if scanner.bInComment {
+			if c == '*' && i+1 < len(szLine) && szLine[i+1] == '/' {
+				scanner.bInComment = false
+				i++
+			}
+			continue
+		}
+
+		if scanner.szString != "" {
+			if c == '\\' {
+				i++
+				continue
+			}
+			if strings.HasPrefix(szLine[i:], scanner.szString) {
+				i += len(scanner.szString) - 1
+				scanner.szString = ""
+			}
+			continue
+		}
+
+		switch {
+		case c == '/' && i+1 < len(szLine) && szLine[i+1] == '/':
+			return
+		case c == '#' && scanner.bHashComments:
+			return
+		case c == '/' && i+1 < len(szLine) && szLine[i+1] == '*':
+			scanner.bInComment = true
+			i++
+		case strings.HasPrefix(szLine[i:], `"""`) || strings.HasPrefix(szLine[i:], `'''`):
+			scanner.szString = szLine[i : i+3]
+			i += 2
+		case c == '`':
+			scanner.szString = "`"
+		case c == '"' || c == '\'':
+			// Plain quotes only close on the same line; an unmatched one is
+			// a lifetime or apostrophe, not a string.
+			if inEnd := closingQuote(szLine, i); inEnd > 0 {
+				i = inEnd
+			}
+		case c == '{':
+			scanner.inDepth++
+		case c == '}':
+			if scanner.inDepth > 0 {
+				scanner.inDepth--
+			}
+		}
+	}
+}
+
+func closingQuote(szLine string, inStart int) int {
+	quote := szLine[inStart]
+	for i := inStart + 1; i < len(szLine); i++ {
+		if szLine[i] == '\\' {
+			i++
+			continue
+		}
+		if szLine[i] == quote {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,181 @@
+package document
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+type wantChunk struct {
+	szSymbol string
+	szKind string
+	szStart string
+	szEnd string
+	szPrefix string
+}
+
+func checkChunks(t *testing.T, segments []Segment, wantChunks []wantChunk) {
+	t.Helper()
+
+	if len(segments) != len(wantChunks) {
+		for _, segment := range segments {
+			t.Logf("%v %q", segment.MetadataMap, segment.SzText)
+		}
+		t.Fatalf("got %d chunks, want %d", len(segments), len(wantChunks))
+	}
+	for i, want := range wantChunks {
+		metadataMap := segments[i].MetadataMap
+		if metadataMap["symbol"] != want.szSymbol || metadataMap["kind"] != want.szKind ||
+			metadataMap["start_line"] != want.szStart || metadataMap["end_line"] != want.szEnd {
+			t.Errorf("chunk %d metadata %v, want symbol %q kind %q lines %s-%s", i, metadataMap, want.szSymbol, want.szKind, want.szStart, want.szEnd)
+		}
+		if !strings.HasPrefix(strings.TrimSpace(segments[i].SzText), want.szPrefix) {
+			t.Errorf("chunk %d starts with %q, want %q", i, segments[i].SzText, want.szPrefix)
+		}
+	}
+}
+
+const goSource = `package demo
+
+import (
+	"fmt"
+	"strings"
+)
+
+const Limit = 3
+
+// Greet says hello.
+func Greet(szName string) string {
+	return fmt.Sprintf("hi %s", strings.TrimSpace(szName))
+}
+
+type Stack[T any] struct {
+	items []T
+}
+
+func (stack *Stack[T]) Push(item T) {
+	stack.items = append(stack.items, item)
+}
+`
+
+func TestChunkCodeGoDeclarations(t *testing.T) {
+	checkChunks(t, ChunkCode(".go", goSource, 200), []wantChunk{
+		{"fmt, strings, Limit", "code", "1", "8", "package demo"},
+		{"Greet", "function", "9", "13", "// Greet says hello."},
+		{"Stack", "type", "14", "17", "type Stack[T any] struct"},
+		{"Stack.Push", "method", "18", "22", "func (stack *Stack[T]) Push"},
+	})
+}
+
+func TestChunkCodeGoFunctionsStayApart(t *testing.T) {
+	szSource := "package tiny\n\nfunc A() {}\n\nfunc B() {}\n\nvar x = 1\n\nvar y = 2\n"
+	checkChunks(t, ChunkCode(".go", szSource, 500), []wantChunk{
+		{"A", "function", "1", "3", "package tiny"},
+		{"B", "function", "4", "5", "func B() {}"},
+		{"x, y", "var", "6", "10", "var x = 1"},
+	})
+}
+
+const pythonSource = `import os
+
+
+class Store:
+    """Keeps items."""
+
+    def __init__(self):
+        self.items = []
+
+    @property
+    def size(self):
+        return len(self.items)
+
+    def add(self, item):
+        if item:
+            self.items.append(item)
+
+
+def main():
+    print(Store().size)
+`
+
+func TestChunkCodeHeuristic(t *testing.T) {
+	checkChunks(t, ChunkCode(".py", pythonSource, 200), []wantChunk{
+		{"", "code", "1", "3", "import os"},
+		{"Store", "class", "4", "18", "class Store:"},
+		{"main", "function", "19", "21", "def main():"},
+	})
+
+	szJS := "const x = 1;\n\nexport function load(url) {\n  const s = \"}\";\n  return fetch(url);\n}\n\nclass A {\n  run() {}\n}\n"
+	checkChunks(t, ChunkCode(".js", szJS, 200), []wantChunk{
+		{"", "code", "1", "2", "const x = 1;"},
+		{"load", "function", "3", "7", "export function load(url)"},
+		{"A", "class", "8", "11", "class A {"},
+	})
+}
+
+func TestChunkCodeSplitsLargeClassIntoMembers(t *testing.T) {
+	segments := ChunkCode(".py", pythonSource, 20)
+	checkChunks(t, segments, []wantChunk{
+		{"", "code", "1", "3", "import os"},
+		{"Store", "class", "4", "6", "class Store:"},
+		{"Store.__init__", "function", "7", "9", "def __init__(self):"},
+		{"Store.size", "function", "10", "13", "@property"},
+		{"Store.add", "function", "14", "15", "def add(self, item):"},
+		{"Store.add", "function", "16", "18", "self.items.append(item)"},
+		{"main", "function", "19", "21", "def main():"},
+	})
+
+	for _, segment := range segments {
+		if inTokens := EstimateTokens(segment.SzText); inTokens > 20 {
+			t.Errorf("chunk %q has %d tokens, more than 20", segment.SzText, inTokens)
+		}
+	}
+}
+
+func TestChunkCodeLineRangesCoverFile(t *testing.T) {
+	for _, tt := range []struct {
+		szExtension string
+		szSource string
+	}{
+		{".go", goSource},
+		{".py", pythonSource},
+	} {
+		inLines := len(strings.Split(tt.szSource, "\n"))
+		inNext := 1
+		szPrevious := ""
+		for _, segment := range ChunkCode(tt.szExtension, tt.szSource, 20) {
+			// A single line too long for one chunk is cut into several
+			// chunks with the same range.
+			szRange := segment.MetadataMap["start_line"] + "-" + segment.MetadataMap["end_line"]
+			if szRange == szPrevious && segment.MetadataMap["start_line"] == segment.MetadataMap["end_line"] {
+				continue
+			}
+			szPrevious = szRange
+
+			if segment.MetadataMap["start_line"] != itoa(inNext) {
+				t.Errorf("%s: chunk starts at line %s, want %d", tt.szExtension, segment.MetadataMap["start_line"], inNext)
+			}
+			inNext = atoi(segment.MetadataMap["end_line"]) + 1
+		}
+		if inNext != inLines+1 {
+			t.Errorf("%s: chunks end at line %d, want %d", tt.szExtension, inNext-1, inLines)
+		}
+	}
+}
+
+func TestIsSourceFile(t *testing.T) {
+	for szExtension, bWant := range map[string]bool{".go": true, ".PY": true, ".tsx": true, ".md": false, ".txt": false, "": false} {
+		if bGot := IsSourceFile(szExtension); bGot != bWant {
+			t.Errorf("IsSourceFile(%q) = %v, want %v", szExtension, bGot, bWant)
+		}
+	}
+}
+
+func itoa(inValue int) string {
+	return strconv.Itoa(inValue)
+}
+
+func atoi(szValue string) int {
+	inValue, _ := strconv.Atoi(szValue)
+	return inValue
+}
@@ -0,0 +1,254 @@
+package document
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	RegisterExtractor(".docx", DocxExtractor{})
+}
+
+// DocxExtractor reads the body of a Word document. Headings (by style or
+// outline level) become "#" lines, list paragraphs become "- " items and
+// tables are rendered row by row with their column headers.
+type DocxExtractor struct{}
+
+func (DocxExtractor) Extract(data []byte) ([]Segment, error) {
+	archive, err := openZipArchive(data)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := archive.read("word/document.xml")
+	if err != nil {
+		return nil, err
+	}
+
+	headingStyleMap := map[string]int{}
+	if archive.has("word/styles.xml") {
+		if styles, err := archive.read("word/styles.xml"); err == nil {
+			headingStyleMap = parseDocxHeadingStyles(styles)
+		}
+	}
+
+	blocks, err := parseDocxBody(content, headingStyleMap)
+	if err != nil {
+		return nil, err
+	}
+
+	return []Segment{{SzText: renderBlocks(blocks)}}, nil
+}
+
+var docxHeadingNameRegex = regexp.MustCompile(`(?i)^heading\s*(\d)$`)
+
+type docxStyle struct {
+	inLevel int
+	szBasedOn string
+}
+
+// parseDocxHeadingStyles maps paragraph style ids to heading levels. Styles
+// are matched by their built-in name ("heading 2", "Title") or outline
+// level, so localized and custom heading styles based on them also count.
+func parseDocxHeadingStyles(data []byte) map[string]int {
+	styleMap := make(map[string]*docxStyle)
+
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	var current *docxStyle
+
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			break
+		}
+
+		element, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		switch element.Name.Local {
+		case "style":
+			current = &docxStyle{}
+			styleMap[xmlAttr(element, "styleId")] = current
+		case "name":
+			if current == nil {
+				continue
+			}
+			szName := xmlAttr(element, "val")
+			if match := docxHeadingNameRegex.FindStringSubmatch(szName); match != nil {
+				current.inLevel, _ = strconv.Atoi(match[1])
+			} else if strings.EqualFold(szName, "title") {
+				current.inLevel = 1
+			}
+		case "basedOn":
+			if current != nil {
+				current.szBasedOn = xmlAttr(element, "val")
+			}
+		case "outlineLvl":
+			if current != nil && current.inLevel == 0 {
+				if inLevel, err := strconv.Atoi(xmlAttr(element, "val")); err == nil && inLevel < 9 {
+					current.inLevel = inLevel + 1
+				}
+			}
+		}
+	}
+
+	headingStyleMap := make(map[string]int)
+	for szId, style := range styleMap {
+		for inDepth := 0; style != nil && inDepth < 16; inDepth++ {
+			if style.inLevel > 0 {
+				headingStyleMap[szId] = style.inLevel
+				break
+			}
+			style = styleMap[style.szBasedOn]
+		}
+	}
+
+	return headingStyleMap
+}
+
+// parseDocxBody walks word/document.xml and returns its paragraphs and
+// tables in reading order.
+func parseDocxBody(data []byte, headingStyleMap map[string]int) ([]textBlock, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+
+	var blocks []textBlock
+	var tables []*tableBuilder
+	var paragraph *textBlock
+	var sbText strings.Builder
+	inNestedParagraphs := 0
+	inRunDepth := 0
+	bInText := false
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse document.xml: %w", err)
+		}
+
+		switch element := token.(type) {
+		case xml.StartElement:
+			if !strings.Contains(element.Name.Space, "wordprocessingml") {
+				// Alternate content repeats what the preferred choice
+				// already holds, e.g. text boxes for older readers.
+				if element.Name.Local == "Fallback" {
+					if err := decoder.Skip(); err != nil {
+						return nil, fmt.Errorf("failed to parse document.xml: %w", err)
+					}
+				}
+				continue
+			}
+
+			switch element.Name.Local {
+			case "p":
+				if paragraph != nil {
+					inNestedParagraphs++
+					sbText.WriteString(" ")
+					continue
+				}
+				paragraph = &textBlock{}
+				sbText.Reset()
+			case "pStyle":
+				if paragraph != nil && inNestedParagraphs == 0 {
+					paragraph.inHeadingLevel = headingStyleMap[xmlAttr(element, "val")]
+				}
+			case "outlineLvl":
+				if paragraph != nil && inNestedParagraphs == 0 && paragraph.inHeadingLevel == 0 {
+					if inLevel, err := strconv.Atoi(xmlAttr(element, "val")); err == nil && inLevel < 9 {
+						paragraph.inHeadingLevel = inLevel + 1
+					}
+				}
+			case "numPr":
+				if paragraph != nil && inNestedParagraphs == 0 {
+					paragraph.bListItem = true
+				}
+			case "r":
+				inRunDepth++
+			case "t":
+				bInText = inRunDepth > 0
+			case "tab":
+				if inRunDepth > 0 {
+					sbText.WriteString("\t")
+				}
+			case "br", "cr":
+				if inRunDepth > 0 {
+					sbText.WriteString("\n")
+				}
+			case "noBreakHyphen":
+				sbText.WriteString("-")
+			case "tbl":
+				tables = append(tables, &tableBuilder{})
+			case "tr":
+				if len(tables) > 0 {
+					tables[len(tables)-1].startRow()
+				}
+			case "tc":
+				if len(tables) > 0 {
+					tables[len(tables)-1].startCell()
+				}
+			}
+
+		case xml.EndElement:
+			if !strings.Contains(element.Name.Space, "wordprocessingml") {
+				continue
+			}
+
+			switch element.Name.Local {
+			case "p":
+				if inNestedParagraphs > 0 {
+					inNestedParagraphs--
+					continue
+				}
+				if paragraph == nil {
+					continue
+				}
+				paragraph.szText = sbText.String()
+				if len(tables) > 0 {
+					tables[len(tables)-1].writeCell(strings.TrimSpace(paragraph.szText))
+				} else {
+					blocks = append(blocks, *paragraph)
+				}
+				paragraph = nil
+			case "r":
+				inRunDepth--
+			case "t":
+				bInText = false
+			case "tc":
+				if len(tables) > 0 {
+					tables[len(tables)-1].endCell(1)
+				}
+			case "tr":
+				if len(tables) > 0 {
+					tables[len(tables)-1].endRow(1)
+				}
+			case "tbl":
+				if len(tables) == 0 {
+					continue
+				}
+				table := tables[len(tables)-1]
+				tables = tables[:len(tables)-1]
+				if len(tables) > 0 {
+					tables[len(tables)-1].writeCell(table.flatten())
+				} else if len(table.rows) > 0 {
+					blocks = append(blocks, textBlock{tableRows: table.rows})
+				}
+			}
+
+		case xml.CharData:
+			if bInText && paragraph != nil {
+				sbText.Write(element)
+			}
+		}
+	}
+
+	return blocks, nil
+}
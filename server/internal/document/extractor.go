@@ -0,0 +1,57 @@
+package document
+
+import (
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Segment is a piece of extracted text together with the metadata that
+// every chunk cut from it should carry, such as the page it came from.
+type Segment struct {
+	SzText string
+	MetadataMap map[string]string
+}
+
+// ExtractorInterface turns the raw bytes of a file into text segments that
+// ChunkText can split.
+type ExtractorInterface interface {
+	Extract(data []byte) ([]Segment, error)
+}
+
+var (
+	extractorMu sync.RWMutex
+	extractorMap = make(map[string]ExtractorInterface)
+)
+
+// RegisterExtractor makes an extractor available for a file extension such
+// as ".pdf". Registering an extension again replaces the previous one.
+func RegisterExtractor(szExtension string, extractor ExtractorInterface) {
+	extractorMu.Lock()
+	defer extractorMu.Unlock()
+
+	extractorMap[strings.ToLower(szExtension)] = extractor
+}
+
+// ExtractorFor returns the extractor registered for the extension, falling
+// back to plain text.
+func ExtractorFor(szExtension string) ExtractorInterface {
+	extractorMu.RLock()
+	defer extractorMu.RUnlock()
+
+	if extractor, exists := extractorMap[strings.ToLower(szExtension)]; exists {
+		return extractor
+	}
+	return PlainTextExtractor{}
+}
+
+type PlainTextExtractor struct{}
+
+func (PlainTextExtractor) Extract(data []byte) ([]Segment, error) {
+	szText := string(data)
+	if !utf8.ValidString(szText) {
+		szText = strings.ToValidUTF8(szText, "�")
+	}
+
+	return []Segment{{SzText: szText}}, nil
+}
@@ -0,0 +1,585 @@
+package document
+
+import (
+	"html"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+func init() {
+	RegisterExtractor(".html", HTMLExtractor{})
+	RegisterExtractor(".htm", HTMLExtractor{})
+}
+
+// HTMLExtractor turns a saved web page into text. Scripts, styles and page
+// furniture (navigation, headers, footers, sidebars, cookie banners) are
+// dropped, and when the page marks its <main> or <article> content only
+// that is kept. Headings become "#" lines so smartSplit still finds the
+// sections, links keep their text and the <title> is recorded as "title"
+// metadata.
+type HTMLExtractor struct{}
+
+func (HTMLExtractor) Extract(data []byte) ([]Segment, error) {
+	szSource := string(data)
+	if !utf8.ValidString(szSource) {
+		// Pages without a UTF-8 charset are nearly always Windows-1252.
+		szSource = decodeWinAnsi(data)
+	}
+
+	walker := newHTMLWalker()
+	lexer := &htmlLexer{szData: szSource}
+	for {
+		token, ok := lexer.next()
+		if !ok {
+			break
+		}
+		walker.handle(token)
+	}
+	walker.flush()
+
+	segment := Segment{SzText: renderBlocks(walker.contentBlocks())}
+	if szTitle := strings.Join(strings.Fields(walker.sbTitle.String()), " "); szTitle != "" {
+		segment.MetadataMap = map[string]string{"title": szTitle}
+	}
+
+	return []Segment{segment}, nil
+}
+
+const (
+	htmlText = iota
+	htmlStartTag
+	htmlEndTag
+)
+
+type htmlToken struct {
+	inType int
+	szName string
+	attrMap map[string]string
+	bSelfClosing bool
+	szText string
+}
+
+// htmlLexer is a forgiving tokenizer: it never fails, and anything it
+// cannot read as markup is passed through as text.
+type htmlLexer struct {
+	szData string
+	inPos int
+	szRawTag string
+}
+
+// rawTextElements hold text that must not be read as markup.
+var rawTextElements = map[string]bool{
+	"script": true, "style": true, "textarea": true, "title": true, "xmp": true,
+}
+
+func (lexer *htmlLexer) next() (htmlToken, bool) {
+	if lexer.inPos >= len(lexer.szData) {
+		return htmlToken{}, false
+	}
+
+	if lexer.szRawTag != "" {
+		szClose := "</" + lexer.szRawTag
+		inEnd := indexFold(lexer.szData[lexer.inPos:], szClose)
+		if inEnd < 0 {
+			inEnd = len(lexer.szData) - lexer.inPos
+		}
+		szText := lexer.szData[lexer.inPos : lexer.inPos+inEnd]
+		if lexer.szRawTag == "title" || lexer.szRawTag == "textarea" {
+			szText = html.UnescapeString(szText)
+		}
+		lexer.inPos += inEnd
+		lexer.szRawTag = ""
+		return htmlToken{inType: htmlText, szText: szText}, true
+	}
+
+	if lexer.szData[lexer.inPos] != '<' {
+		inEnd := strings.IndexByte(lexer.szData[lexer.inPos:], '<')
+		if inEnd < 0 {
+			inEnd = len(lexer.szData) - lexer.inPos
+		}
+		if inEnd == 0 {
+			inEnd = 1
+		}
+		szText := lexer.szData[lexer.inPos : lexer.inPos+inEnd]
+		lexer.inPos += inEnd
+		return htmlToken{inType: htmlText, szText: html.UnescapeString(szText)}, true
+	}
+
+	szRest := lexer.szData[lexer.inPos:]
+	switch {
+	case strings.HasPrefix(szRest, "<!--"):
+		lexer.skipPast("-->", 4)
+		return lexer.next()
+	case strings.HasPrefix(szRest, "<!") || strings.HasPrefix(szRest, "<?"):
+		lexer.skipPast(">", 2)
+		return lexer.next()
+	case strings.HasPrefix(szRest, "</") && len(szRest) > 2 && isASCIILetter(szRest[2]):
+		lexer.inPos += 2
+		szName := lexer.readName()
+		lexer.skipPast(">", 0)
+		return htmlToken{inType: htmlEndTag, szName: szName}, true
+	case len(szRest) > 1 && isASCIILetter(szRest[1]):
+		lexer.inPos++
+		token := htmlToken{inType: htmlStartTag, szName: lexer.readName(), attrMap: map[string]string{}}
+		lexer.readAttributes(&token)
+		if rawTextElements[token.szName] && !token.bSelfClosing {
+			lexer.szRawTag = token.szName
+		}
+		return token, true
+	}
+
+	lexer.inPos++
+	return htmlToken{inType: htmlText, szText: "<"}, true
+}
+
+func (lexer *htmlLexer) skipPast(szMarker string, inFrom int) {
+	inEnd := strings.Index(lexer.szData[lexer.inPos+inFrom:], szMarker)
+	if inEnd < 0 {
+		lexer.inPos = len(lexer.szData)
+		return
+	}
+	lexer.inPos += inFrom + inEnd + len(szMarker)
+}
+
+func (lexer *htmlLexer) readName() string {
+	inStart := lexer.inPos
+	for lexer.inPos < len(lexer.szData) {
+		c := lexer.szData[lexer.inPos]
+		if c == '>' || c == '/' || c == '=' || isHTMLSpace(c) {
+			break
+		}
+		lexer.inPos++
+	}
+	return strings.ToLower(lexer.szData[inStart:lexer.inPos])
+}
+
+func (lexer *htmlLexer) readAttributes(token *htmlToken) {
+	for lexer.inPos < len(lexer.szData) {
+		c := lexer.szData[lexer.inPos]
+		switch {
+		case isHTMLSpace(c):
+			lexer.inPos++
+		case c == '>':
+			lexer.inPos++
+			return
+		case c == '/':
+			lexer.inPos++
+			if lexer.inPos < len(lexer.szData) && lexer.szData[lexer.inPos] == '>' {
+				token.bSelfClosing = true
+			}
+		default:
+			szName := lexer.readName()
+			if szName == "" {
+				lexer.inPos++
+				continue
+			}
+			for lexer.inPos < len(lexer.szData) && isHTMLSpace(lexer.szData[lexer.inPos]) {
+				lexer.inPos++
+			}
+			if lexer.inPos >= len(lexer.szData) || lexer.szData[lexer.inPos] != '=' {
+				token.attrMap[szName] = ""
+				continue
+			}
+			lexer.inPos++
+			for lexer.inPos < len(lexer.szData) && isHTMLSpace(lexer.szData[lexer.inPos]) {
+				lexer.inPos++
+			}
+			token.attrMap[szName] = html.UnescapeString(lexer.readAttributeValue())
+		}
+	}
+}
+
+func (lexer *htmlLexer) readAttributeValue() string {
+	if lexer.inPos >= len(lexer.szData) {
+		return ""
+	}
+
+	if quote := lexer.szData[lexer.inPos]; quote == '"' || quote == '\'' {
+		inEnd := strings.IndexByte(lexer.szData[lexer.inPos+1:], quote)
+		if inEnd < 0 {
+			szValue := lexer.szData[lexer.inPos+1:]
+			lexer.inPos = len(lexer.szData)
+			return szValue
+		}
+		szValue := lexer.szData[lexer.inPos+1 : lexer.inPos+1+inEnd]
+		lexer.inPos += inEnd + 2
+		return szValue
+	}
+
+	inStart := lexer.inPos
+	for lexer.inPos < len(lexer.szData) && !isHTMLSpace(lexer.szData[lexer.inPos]) && lexer.szData[lexer.inPos] != '>' {
+		lexer.inPos++
+	}
+	return lexer.szData[inStart:lexer.inPos]
+}
+
+func isASCIILetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isHTMLSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+// indexFold is strings.Index for an ASCII needle, ignoring case.
+func indexFold(szText string, szNeedle string) int {
+	for i := 0; i+len(szNeedle) <= len(szText); i++ {
+		if strings.EqualFold(szText[i:i+len(szNeedle)], szNeedle) {
+			return i
+		}
+	}
+	return -1
+}
+
+var voidElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true, "hr": true, "img": true,
+	"input": true, "link": true, "meta": true, "param": true, "source": true, "track": true, "wbr": true,
+}
+
+// boilerplateElements are dropped together with everything inside them.
+var boilerplateElements = map[string]bool{
+	"script": true, "style": true, "noscript": true, "template": true, "svg": true, "canvas": true,
+	"iframe": true, "object": true, "nav": true, "header": true, "footer": true, "aside": true,
+	"form": true, "button": true, "select": true, "textarea": true, "dialog": true, "menu": true,
+}
+
+var boilerplateRoles = map[string]bool{
+	"navigation": true, "banner": true, "contentinfo": true, "complementary": true, "search": true, "menu": true,
+}
+
+var boilerplateClassRegex = regexp.MustCompile(`(?i)(^|[\s_-])(nav|navbar|navigation|menu|sidebar|breadcrumbs?|cookies?|consent|footer|skip-link|headerlink|anchor|advert|ads|share|social)($|[\s_-])`)
+
+// contentElements are never dropped for their class or id, which on these
+// often describe the layout ("has-sidebar") rather than the element.
+var contentElements = map[string]bool{
+	"html": true, "body": true, "main": true, "article": true,
+}
+
+var blockElements = map[string]bool{
+	"p": true, "div": true, "section": true, "article": true, "main": true, "body": true,
+	"ul": true, "ol": true, "li": true, "dl": true, "dt": true, "dd": true, "blockquote": true,
+	"figure": true, "figcaption": true, "details": true, "summary": true, "address": true,
+	"hr": true, "table": true, "caption": true, "center": true,
+}
+
+// htmlWalker follows the token stream with a stack of open elements,
+// closing unclosed ones the way browsers do when an outer element ends.
+type htmlWalker struct {
+	stack []string
+	inSkipDepth int
+	inMainDepth int
+	inPreDepth int
+	bTitle bool
+	sbTitle strings.Builder
+	sbText strings.Builder
+	inHeadingLevel int
+	bListItem bool
+	tables []*tableBuilder
+	blocks []textBlock
+	mainBlocks []textBlock
+}
+
+func newHTMLWalker() *htmlWalker {
+	return &htmlWalker{inSkipDepth: -1, inMainDepth: -1, inPreDepth: -1}
+}
+
+func (walker *htmlWalker) handle(token htmlToken) {
+	switch token.inType {
+	case htmlText:
+		walker.writeText(token.szText)
+	case htmlStartTag:
+		walker.open(token)
+	case htmlEndTag:
+		walker.close(token.szName)
+	}
+}
+
+// paragraphScope stops the search for an unclosed <p> to end.
+var paragraphScope = map[string]bool{
+	"div": true, "li": true, "td": true, "th": true, "table": true, "ul": true, "ol": true, "dl": true,
+	"blockquote": true, "section": true, "article": true, "main": true, "body": true,
+}
+
+func (walker *htmlWalker) open(token htmlToken) {
+	szName := token.szName
+
+	switch szName {
+	case "li":
+		walker.closeImplied([]string{"li"}, map[string]bool{"ul": true, "ol": true})
+	case "td", "th":
+		walker.closeImplied([]string{"td", "th"}, map[string]bool{"tr": true, "table": true})
+	case "tr":
+		walker.closeImplied([]string{"tr"}, map[string]bool{"table": true})
+	case "dt", "dd":
+		walker.closeImplied([]string{"dt", "dd"}, map[string]bool{"dl": true})
+	}
+	if blockElements[szName] || headingLevel(szName) > 0 || szName == "pre" {
+		walker.closeImplied([]string{"p"}, paragraphScope)
+	}
+
+	if walker.inSkipDepth < 0 && walker.isBoilerplate(token) {
+		if voidElements[szName] || token.bSelfClosing {
+			return
+		}
+		walker.inSkipDepth = len(walker.stack)
+	}
+
+	if walker.inSkipDepth < 0 {
+		switch {
+		case szName == "br":
+			walker.sbText.WriteString("\n")
+		case szName == "title":
+			walker.bTitle = true
+		case headingLevel(szName) > 0:
+			walker.flush()
+			walker.inHeadingLevel = headingLevel(szName)
+		case szName == "pre":
+			walker.flush()
+			if walker.inPreDepth < 0 {
+				walker.inPreDepth = len(walker.stack)
+			}
+		case szName == "li":
+			walker.flush()
+			walker.bListItem = true
+		case szName == "table":
+			walker.flush()
+			walker.tables = append(walker.tables, &tableBuilder{})
+		case szName == "tr":
+			if len(walker.tables) > 0 {
+				walker.tables[len(walker.tables)-1].startRow()
+			}
+		case szName == "td" || szName == "th":
+			walker.flush()
+			if len(walker.tables) > 0 {
+				walker.tables[len(walker.tables)-1].startCell()
+			}
+		case blockElements[szName]:
+			walker.flush()
+		}
+
+		if (szName == "main" || szName == "article" || token.attrMap["role"] == "main") && walker.inMainDepth < 0 {
+			walker.inMainDepth = len(walker.stack)
+		}
+	}
+
+	if voidElements[szName] || token.bSelfClosing {
+		return
+	}
+	walker.stack = append(walker.stack, szName)
+}
+
+// closeImplied closes an element the new one implicitly ends, such as an
+// open <li> when the next <li> starts, unless a stopper is reached first.
+func (walker *htmlWalker) closeImplied(targets []string, stopperMap map[string]bool) {
+	for i := len(walker.stack) - 1; i >= 0; i-- {
+		for _, szTarget := range targets {
+			if walker.stack[i] == szTarget {
+				for len(walker.stack) > i {
+					walker.pop()
+				}
+				return
+			}
+		}
+		if stopperMap[walker.stack[i]] {
+			return
+		}
+	}
+}
+
+func (walker *htmlWalker) close(szName string) {
+	inIndex := -1
+	for i := len(walker.stack) - 1; i >= 0; i-- {
+		if walker.stack[i] == szName {
+			inIndex = i
+			break
+		}
+	}
+	if inIndex < 0 {
+		return
+	}
+
+	for len(walker.stack) > inIndex {
+		walker.pop()
+	}
+}
+
+// pop closes the innermost open element.
+func (walker *htmlWalker) pop() {
+	inDepth := len(walker.stack) - 1
+	szName := walker.stack[inDepth]
+	walker.stack = walker.stack[:inDepth]
+
+	if walker.inSkipDepth >= 0 {
+		if inDepth == walker.inSkipDepth {
+			walker.inSkipDepth = -1
+		}
+		return
+	}
+
+	switch {
+	case szName == "title":
+		walker.bTitle = false
+	case headingLevel(szName) > 0:
+		walker.flush()
+		walker.inHeadingLevel = 0
+	case szName == "pre":
+		if inDepth == walker.inPreDepth {
+			walker.flushPre()
+			walker.inPreDepth = -1
+		}
+	case szName == "td" || szName == "th":
+		walker.flush()
+		if len(walker.tables) > 0 {
+			walker.tables[len(walker.tables)-1].endCell(1)
+		}
+	case szName == "tr":
+		if len(walker.tables) > 0 {
+			table := walker.tables[len(walker.tables)-1]
+			table.endCell(1)
+			table.endRow(1)
+		}
+	case szName == "table":
+		walker.flush()
+		if len(walker.tables) > 0 {
+			table := walker.tables[len(walker.tables)-1]
+			walker.tables = walker.tables[:len(walker.tables)-1]
+			if len(walker.tables) > 0 {
+				walker.tables[len(walker.tables)-1].writeCell(table.flatten())
+			} else if len(table.rows) > 0 {
+				walker.emit(textBlock{tableRows: table.rows})
+			}
+		}
+	case blockElements[szName]:
+		walker.flush()
+	}
+
+	if inDepth == walker.inMainDepth {
+		walker.inMainDepth = -1
+	}
+}
+
+func (walker *htmlWalker) writeText(szText string) {
+	if walker.inSkipDepth >= 0 {
+		return
+	}
+
+	if walker.bTitle {
+		walker.sbTitle.WriteString(szText)
+		return
+	}
+
+	if walker.inPreDepth >= 0 {
+		walker.sbText.WriteString(szText)
+		return
+	}
+
+	// Collapse whitespace the way a browser renders it.
+	szCollapsed := strings.Join(strings.Fields(szText), " ")
+	if szCollapsed == "" {
+		if szText != "" && walker.sbText.Len() > 0 {
+			walker.writeSpace()
+		}
+		return
+	}
+
+	if isHTMLSpace(szText[0]) {
+		walker.writeSpace()
+	}
+	walker.sbText.WriteString(szCollapsed)
+	if isHTMLSpace(szText[len(szText)-1]) {
+		walker.writeSpace()
+	}
+}
+
+func (walker *htmlWalker) writeSpace() {
+	szCurrent := walker.sbText.String()
+	if szCurrent != "" && !strings.HasSuffix(szCurrent, " ") && !strings.HasSuffix(szCurrent, "\n") {
+		walker.sbText.WriteString(" ")
+	}
+}
+
+// flush ends the current paragraph, sending it to the open table cell if
+// there is one.
+func (walker *htmlWalker) flush() {
+	szText := strings.TrimSpace(walker.sbText.String())
+	walker.sbText.Reset()
+
+	block := textBlock{szText: szText, inHeadingLevel: walker.inHeadingLevel, bListItem: walker.bListItem}
+	if szText == "" {
+		return
+	}
+	walker.inHeadingLevel = 0
+	walker.bListItem = false
+
+	if len(walker.tables) > 0 {
+		walker.tables[len(walker.tables)-1].writeCell(szText)
+		return
+	}
+	walker.emit(block)
+}
+
+// flushPre keeps preformatted text as a fenced block so the chunker treats
+// it as code.
+func (walker *htmlWalker) flushPre() {
+	szText := strings.Trim(walker.sbText.String(), "\n")
+	walker.sbText.Reset()
+	if strings.TrimSpace(szText) == "" {
+		return
+	}
+
+	if len(walker.tables) > 0 {
+		walker.tables[len(walker.tables)-1].writeCell(strings.Join(strings.Fields(szText), " "))
+		return
+	}
+	walker.emit(textBlock{szText: "```\n" + szText + "\n```"})
+}
+
+func (walker *htmlWalker) emit(block textBlock) {
+	walker.blocks = append(walker.blocks, block)
+	if walker.inMainDepth >= 0 {
+		walker.mainBlocks = append(walker.mainBlocks, block)
+	}
+}
+
+// contentBlocks prefers the page's marked main content when it has any.
+func (walker *htmlWalker) contentBlocks() []textBlock {
+	if len(walker.mainBlocks) > 0 {
+		return walker.mainBlocks
+	}
+	return walker.blocks
+}
+
+func headingLevel(szName string) int {
+	if len(szName) == 2 && szName[0] == 'h' && szName[1] >= '1' && szName[1] <= '6' {
+		return int(szName[1] - '0')
+	}
+	return 0
+}
+
+func (walker *htmlWalker) isBoilerplate(token htmlToken) bool {
+	// An article's own header and footer hold its title and byline.
+	if (token.szName == "header" || token.szName == "footer") && walker.inMainDepth >= 0 {
+		return false
+	}
+
+	if boilerplateElements[token.szName] {
+		return true
+	}
+
+	if boilerplateRoles[strings.ToLower(token.attrMap["role"])] {
+		return true
+	}
+
+	if _, hidden := token.attrMap["hidden"]; hidden {
+		return true
+	}
+	if token.attrMap["aria-hidden"] == "true" {
+		return true
+	}
+
+	if contentElements[token.szName] {
+		return false
+	}
+	return boilerplateClassRegex.MatchString(token.attrMap["class"]) || boilerplateClassRegex.MatchString(token.attrMap["id"])
+}
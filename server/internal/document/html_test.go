@@ -0,0 +1,116 @@
+package document
+
+import (
+	"strings"
+	"testing"
+)
+
+const htmlArticlePage = `<!DOCTYPE html>
+<html><head>
+<title>  Backup   Guide | Example Docs </title>
+<style>body { color: red }</style>
+<script>var tracking = "should not appear";</script>
+</head>
+<body class="has-sidebar">
+<header><a href="/">Example Docs</a><nav><ul><li><a href="/a">Home</a></li><li>Blog</li></ul></nav></header>
+<div class="cookie-consent">We use cookies. <button>Accept</button></div>
+<aside>Related posts</aside>
+<main>
+<h1>Backup guide</h1>
+<p>Run the <a href="/tool">backup tool</a> every night.
+<p>Keep three copies &amp; test restores.</p>
+<h2 id="steps">Steps<a class="headerlink" href="#steps">¶</a></h2>
+<ul><li>Stop the service<li>Copy the data</ul>
+<table><tr><th>Host</th><th>Schedule</th></tr><tr><td>db1</td><td>02:00</td></tr></table>
+<pre>rsync -a /data  /backup
+  --delete</pre>
+</main>
+<div class="sidebar">Popular tags</div>
+<footer>© 2024 Example</footer>
+</body></html>`
+
+func TestHTMLBoilerplateStripping(t *testing.T) {
+	segments, err := HTMLExtractor{}.Extract([]byte(htmlArticlePage))
+	if err != nil {
+		t.Fatalf("Extract: %v", err)
+	}
+	if len(segments) != 1 {
+		t.Fatalf("got %d segments, want 1", len(segments))
+	}
+
+	if szTitle := segments[0].MetadataMap["title"]; szTitle != "Backup Guide | Example Docs" {
+		t.Errorf("title %q", szTitle)
+	}
+
+	szText := segments[0].SzText
+	for _, szWant := range []string{
+		"# Backup guide",
+		"Run the backup tool every night.",
+		"Keep three copies & test restores.",
+		"## Steps",
+		"- Stop the service",
+		"- Copy the data",
+		"Host: db1 | Schedule: 02:00",
+		"rsync -a /data  /backup\n  --delete",
+	} {
+		if !strings.Contains(szText, szWant) {
+			t.Errorf("missing %q in:\n%s", szWant, szText)
+		}
+	}
+	for _, szUnwanted := range []string{"tracking", "color: red", "Home", "Blog", "cookies", "Accept", "Related posts", "Popular tags", "2024", "¶"} {
+		if strings.Contains(szText, szUnwanted) {
+			t.Errorf("boilerplate %q kept in:\n%s", szUnwanted, szText)
+		}
+	}
+}
+
+func TestHTMLWithoutMain(t *testing.T) {
+	tests := []struct {
+		szName string
+		szHTML string
+		szWant string
+	}{
+		{
+			szName: "body text without landmarks",
+			szHTML: `<html><body><nav>Menu</nav><h3>Notes</h3><p>First<br>second line</p><div role="navigation">Skip</div></body></html>`,
+			szWant: "### Notes\n\nFirst\nsecond line",
+		},
+		{
+			szName: "unclosed tags and comments",
+			szHTML: `<p>One <!-- <p>hidden</p> --> two<p>Three<div>Four`,
+			szWant: "One two\n\nThree\n\nFour",
+		},
+		{
+			szName: "entities and whitespace",
+			szHTML: "<p>caf&eacute;&nbsp;&lt;ok&gt;\n\t  done &#x2713;</p>",
+			szWant: "café <ok> done ✓",
+		},
+		{
+			szName: "article wins over surrounding text",
+			szHTML: `<body><p>Teaser</p><article><p>Story</p></article><p>More links</p></body>`,
+			szWant: "Story",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.szName, func(t *testing.T) {
+			segments, err := HTMLExtractor{}.Extract([]byte(tt.szHTML))
+			if err != nil {
+				t.Fatalf("Extract: %v", err)
+			}
+			if segments[0].SzText != tt.szWant {
+				t.Errorf("text %q, want %q", segments[0].SzText, tt.szWant)
+			}
+		})
+	}
+}
+
+func TestHTMLWindows1252(t *testing.T) {
+	segments, err := HTMLExtractor{}.Extract([]byte("<p>Caf\xe9 \x93quoted\x94</p>"))
+	if err != nil {
+		t.Fatalf("Extract: %v", err)
+	}
+	if segments[0].SzText != "Café “quoted”" {
+		t.Errorf("text %q", segments[0].SzText)
+	}
+}
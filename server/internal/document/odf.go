@@ -0,0 +1,222 @@
+package document
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// maxRepeat caps the number-*-repeated attributes of ODF tables, which
+// spreadsheets use to pad rows and columns out to the sheet's full size.
+const maxRepeat = 1024
+
+func init() {
+	RegisterExtractor(".odt", OdtExtractor{})
+	RegisterExtractor(".ods", OdsExtractor{})
+}
+
+// OdtExtractor reads an OpenDocument text file the same way DocxExtractor
+// reads Word files.
+type OdtExtractor struct{}
+
+// OdsExtractor reads an OpenDocument spreadsheet, one segment per sheet
+// with its name in the "sheet" metadata, the same way XlsxExtractor does.
+type OdsExtractor struct{}
+
+func (OdtExtractor) Extract(data []byte) ([]Segment, error) {
+	blocks, err := readODFContent(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return []Segment{{SzText: renderBlocks(blocks)}}, nil
+}
+
+func (OdsExtractor) Extract(data []byte) ([]Segment, error) {
+	blocks, err := readODFContent(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var segments []Segment
+	for _, block := range blocks {
+		if block.tableRows == nil {
+			continue
+		}
+
+		szText := strings.Join(tableLines(block.tableRows), "\n\n")
+		if szText == "" {
+			continue
+		}
+
+		segments = append(segments, Segment{
+			SzText: szText,
+			MetadataMap: map[string]string{"sheet": block.szText},
+		})
+	}
+
+	return segments, nil
+}
+
+func readODFContent(data []byte) ([]textBlock, error) {
+	archive, err := openZipArchive(data)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := archive.read("content.xml")
+	if err != nil {
+		return nil, err
+	}
+
+	return parseODFBody(content)
+}
+
+// parseODFBody walks content.xml and returns its headings, paragraphs and
+// tables in reading order. Top-level table blocks carry the table name in
+// szText, which for spreadsheets is the sheet name.
+func parseODFBody(data []byte) ([]textBlock, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+
+	var blocks []textBlock
+	var tables []*tableBuilder
+	var tableNames []string
+	var paragraph *textBlock
+	var sbText strings.Builder
+	var cellRepeats []int
+	var rowRepeats []int
+	inNestedParagraphs := 0
+	inListItems := 0
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse content.xml: %w", err)
+		}
+
+		switch element := token.(type) {
+		case xml.StartElement:
+			switch element.Name.Local {
+			case "note", "annotation", "tracked-changes", "table-of-content", "shapes":
+				// Footnotes, comments and generated indexes would
+				// interrupt the running text.
+				if err := decoder.Skip(); err != nil {
+					return nil, fmt.Errorf("failed to parse content.xml: %w", err)
+				}
+			case "list-item":
+				inListItems++
+			case "p", "h":
+				if paragraph != nil {
+					inNestedParagraphs++
+					sbText.WriteString(" ")
+					continue
+				}
+				paragraph = &textBlock{bListItem: inListItems > 0}
+				if element.Name.Local == "h" {
+					paragraph.inHeadingLevel = 1
+					if inLevel, err := strconv.Atoi(xmlAttr(element, "outline-level")); err == nil && inLevel > 0 {
+						paragraph.inHeadingLevel = inLevel
+					}
+				}
+				sbText.Reset()
+			case "s":
+				inCount := 1
+				if szCount := xmlAttr(element, "c"); szCount != "" {
+					inCount, _ = strconv.Atoi(szCount)
+				}
+				sbText.WriteString(strings.Repeat(" ", max(1, min(inCount, maxRepeat))))
+			case "tab":
+				sbText.WriteString("\t")
+			case "line-break":
+				sbText.WriteString("\n")
+			case "table":
+				tables = append(tables, &tableBuilder{})
+				tableNames = append(tableNames, xmlAttr(element, "name"))
+			case "table-row":
+				rowRepeats = append(rowRepeats, repeatCount(element, "number-rows-repeated"))
+				if len(tables) > 0 {
+					tables[len(tables)-1].startRow()
+				}
+			case "table-cell", "covered-table-cell":
+				cellRepeats = append(cellRepeats, repeatCount(element, "number-columns-repeated"))
+				if len(tables) > 0 {
+					tables[len(tables)-1].startCell()
+				}
+			}
+
+		case xml.EndElement:
+			switch element.Name.Local {
+			case "list-item":
+				inListItems--
+			case "p", "h":
+				if inNestedParagraphs > 0 {
+					inNestedParagraphs--
+					continue
+				}
+				if paragraph == nil {
+					continue
+				}
+				paragraph.szText = sbText.String()
+				if len(tables) > 0 {
+					tables[len(tables)-1].writeCell(strings.TrimSpace(paragraph.szText))
+				} else {
+					blocks = append(blocks, *paragraph)
+				}
+				paragraph = nil
+			case "table-cell", "covered-table-cell":
+				inRepeat := popRepeat(&cellRepeats)
+				if len(tables) > 0 {
+					tables[len(tables)-1].endCell(inRepeat)
+				}
+			case "table-row":
+				inRepeat := popRepeat(&rowRepeats)
+				if len(tables) > 0 {
+					tables[len(tables)-1].endRow(inRepeat)
+				}
+			case "table":
+				if len(tables) == 0 {
+					continue
+				}
+				table := tables[len(tables)-1]
+				szName := tableNames[len(tableNames)-1]
+				tables = tables[:len(tables)-1]
+				tableNames = tableNames[:len(tableNames)-1]
+				if len(tables) > 0 {
+					tables[len(tables)-1].writeCell(table.flatten())
+				} else if len(table.rows) > 0 {
+					blocks = append(blocks, textBlock{szText: szName, tableRows: table.rows})
+				}
+			}
+
+		case xml.CharData:
+			if paragraph != nil {
+				sbText.Write(element)
+			}
+		}
+	}
+
+	return blocks, nil
+}
+
+func repeatCount(element xml.StartElement, szAttr string) int {
+	inCount, err := strconv.Atoi(xmlAttr(element, szAttr))
+	if err != nil || inCount < 1 {
+		return 1
+	}
+	return min(inCount, maxRepeat)
+}
+
+func popRepeat(repeats *[]int) int {
+	if len(*repeats) == 0 {
+		return 1
+	}
+	inRepeat := (*repeats)[len(*repeats)-1]
+	*repeats = (*repeats)[:len(*repeats)-1]
+	return inRepeat
+}
@@ -0,0 +1,272 @@
+package document
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// maxArchiveEntrySize caps how much of a single archive member is read so a
+// zip bomb cannot exhaust memory.
+const maxArchiveEntrySize = 256 << 20
+
+// maxHeaderSearchRows is how far down a table or sheet we look for the row
+// that holds the column headers.
+const maxHeaderSearchRows = 10
+
+type zipArchive struct {
+	fileMap map[string]*zip.File
+}
+
+func openZipArchive(data []byte) (*zipArchive, error) {
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("not a zip archive: %w", err)
+	}
+
+	archive := &zipArchive{fileMap: make(map[string]*zip.File)}
+	for _, file := range reader.File {
+		archive.fileMap[strings.TrimPrefix(file.Name, "/")] = file
+	}
+
+	return archive, nil
+}
+
+func (archive *zipArchive) has(szName string) bool {
+	_, exists := archive.fileMap[szName]
+	return exists
+}
+
+func (archive *zipArchive) read(szName string) ([]byte, error) {
+	file, exists := archive.fileMap[szName]
+	if !exists {
+		return nil, fmt.Errorf("%s is missing from the archive", szName)
+	}
+
+	reader, err := file.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", szName, err)
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(io.LimitReader(reader, maxArchiveEntrySize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", szName, err)
+	}
+	if len(data) > maxArchiveEntrySize {
+		return nil, fmt.Errorf("%s is larger than %d bytes", szName, maxArchiveEntrySize)
+	}
+
+	return data, nil
+}
+
+// textBlock is one paragraph, heading or table of a word-processing
+// document, in reading order.
+type textBlock struct {
+	inHeadingLevel int
+	bListItem bool
+	szText string
+	tableRows [][]string
+}
+
+// renderBlocks lays the blocks out the way ChunkText expects: headings as
+// markdown "#" lines and blank lines between paragraphs and table rows.
+func renderBlocks(blocks []textBlock) string {
+	var parts []string
+
+	for _, block := range blocks {
+		if block.tableRows != nil {
+			parts = append(parts, tableLines(block.tableRows)...)
+			continue
+		}
+
+		szText := strings.TrimSpace(block.szText)
+		if szText == "" {
+			continue
+		}
+
+		switch {
+		case block.inHeadingLevel > 0:
+			inLevel := min(block.inHeadingLevel, 6)
+			parts = append(parts, strings.Repeat("#", inLevel)+" "+strings.Join(strings.Fields(szText), " "))
+		case block.bListItem:
+			parts = append(parts, "- "+szText)
+		default:
+			parts = append(parts, szText)
+		}
+	}
+
+	return strings.Join(parts, "\n\n")
+}
+
+// tableLines renders every row of a table as its own line. When a header
+// row is found, each later cell is labelled with its column header
+// ("Amount: 120.00") so a row still makes sense after chunking separates it
+// from the header. Rows above the header, such as a sheet title, are kept
+// as plain lines.
+func tableLines(rows [][]string) []string {
+	inHeader := findHeaderRow(rows)
+
+	var lines []string
+	for i, row := range rows {
+		var cells []string
+		for j, szCell := range row {
+			szCell = strings.Join(strings.Fields(szCell), " ")
+			if szCell == "" {
+				continue
+			}
+
+			if inHeader >= 0 && i > inHeader {
+				szName := columnName(j)
+				if j < len(rows[inHeader]) && strings.TrimSpace(rows[inHeader][j]) != "" {
+					szName = strings.Join(strings.Fields(rows[inHeader][j]), " ")
+				}
+				szCell = szName + ": " + szCell
+			}
+			cells = append(cells, szCell)
+		}
+
+		if len(cells) == 0 {
+			continue
+		}
+
+		if i == inHeader {
+			lines = append(lines, "Columns: "+strings.Join(cells, " | "))
+		} else {
+			lines = append(lines, strings.Join(cells, " | "))
+		}
+	}
+
+	return lines
+}
+
+// findHeaderRow returns the index of the first row that has at least two
+// cells, all of them non-numeric, or -1 when there is none near the top.
+func findHeaderRow(rows [][]string) int {
+	for i := 0; i < len(rows) && i < maxHeaderSearchRows; i++ {
+		inFilled := 0
+		bHeader := true
+
+		for _, szCell := range rows[i] {
+			szCell = strings.TrimSpace(szCell)
+			if szCell == "" {
+				continue
+			}
+			inFilled++
+			if _, err := strconv.ParseFloat(strings.ReplaceAll(szCell, ",", ""), 64); err == nil {
+				bHeader = false
+			}
+		}
+
+		if inFilled >= 2 && bHeader && i < len(rows)-1 {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// columnName labels a zero-based column index the way spreadsheets do, e.g.
+// "Column C", for cells that have no header.
+func columnName(inIndex int) string {
+	szName := ""
+	for inIndex >= 0 {
+		szName = string(rune('A'+inIndex%26)) + szName
+		inIndex = inIndex/26 - 1
+	}
+	return "Column " + szName
+}
+
+// columnIndex parses the letters of a cell reference such as "AB12" into a
+// zero-based column index, or -1 when the reference has none.
+func columnIndex(szRef string) int {
+	inIndex := 0
+	inLetters := 0
+	for _, r := range strings.ToUpper(szRef) {
+		if r < 'A' || r > 'Z' {
+			break
+		}
+		inIndex = inIndex*26 + int(r-'A') + 1
+		inLetters++
+	}
+
+	if inLetters == 0 {
+		return -1
+	}
+	return inIndex - 1
+}
+
+func xmlAttr(element xml.StartElement, szLocal string) string {
+	for _, attr := range element.Attr {
+		if attr.Name.Local == szLocal {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// tableBuilder collects the rows of a table while its XML is walked.
+type tableBuilder struct {
+	rows [][]string
+	row []string
+	cell *strings.Builder
+}
+
+func (table *tableBuilder) startRow() {
+	table.row = []string{}
+}
+
+func (table *tableBuilder) startCell() {
+	table.cell = &strings.Builder{}
+}
+
+func (table *tableBuilder) writeCell(szText string) {
+	if table.cell == nil {
+		return
+	}
+	if table.cell.Len() > 0 && szText != "" {
+		table.cell.WriteString(" ")
+	}
+	table.cell.WriteString(szText)
+}
+
+func (table *tableBuilder) endCell(inRepeat int) {
+	if table.cell == nil {
+		return
+	}
+	szText := strings.TrimSpace(table.cell.String())
+	for i := 0; i < inRepeat; i++ {
+		table.row = append(table.row, szText)
+	}
+	table.cell = nil
+}
+
+func (table *tableBuilder) endRow(inRepeat int) {
+	for _, szCell := range table.row {
+		if szCell != "" {
+			for i := 0; i < inRepeat; i++ {
+				table.rows = append(table.rows, table.row)
+			}
+			break
+		}
+	}
+	table.row = nil
+}
+
+// flatten joins all cells into one line, used when a table is nested in
+// another table's cell.
+func (table *tableBuilder) flatten() string {
+	var cells []string
+	for _, row := range table.rows {
+		for _, szCell := range row {
+			if szCell != "" {
+				cells = append(cells, szCell)
+			}
+		}
+	}
+	return strings.Join(cells, " ")
+}
@@ -0,0 +1,236 @@
+package document
+
+import (
+	"archive/zip"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// zipFixture packs the given parts into an in-memory archive.
+func zipFixture(t *testing.T, partMap map[string]string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	writer := zip.NewWriter(&buf)
+	for szName, szContent := range partMap {
+		part, err := writer.Create(szName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := part.Write([]byte(szContent)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+const xlsxWorkbookXML = `<?xml version="1.0" encoding="UTF-8"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<workbookPr%s/>
+<sheets><sheet name="Invoices" sheetId="1" r:id="rId1"/><sheet name="Empty" sheetId="2" r:id="rId2"/></sheets>
+</workbook>`
+
+const xlsxRelsXML = `<?xml version="1.0" encoding="UTF-8"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>
+<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="/xl/worksheets/sheet2.xml"/>
+<Relationship Id="rId3" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>
+</Relationships>`
+
+const xlsxSharedStringsXML = `<?xml version="1.0" encoding="UTF-8"?>
+<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<si><t>Invoices 2024</t></si>
+<si><t>Date</t></si>
+<si><r><t>Cli</t></r><r><t>ent</t></r></si>
+<si><t>Amount</t></si>
+<si><t>Acme</t><rPh><t>アクメ</t></rPh></si>
+<si><t>Beta  Corp</t></si>
+</sst>`
+
+// Style 1 is a built-in date, 2 a custom date and time, 3 a number whose
+// format only mentions "d" inside quotes.
+const xlsxStylesXML = `<?xml version="1.0" encoding="UTF-8"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<numFmts><numFmt numFmtId="164" formatCode="yyyy-mm-dd hh:mm"/><numFmt numFmtId="165" formatCode="0.00&quot; d&quot;"/></numFmts>
+<cellStyleXfs><xf numFmtId="14"/></cellStyleXfs>
+<cellXfs><xf numFmtId="0"/><xf numFmtId="14"/><xf numFmtId="164"/><xf numFmtId="165"/></cellXfs>
+</styleSheet>`
+
+const xlsxSheetXML = `<?xml version="1.0" encoding="UTF-8"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>
+<row r="1"><c r="A1" t="s"><v>0</v></c></row>
+<row r="2"><c r="A2" t="s"><v>1</v></c><c r="B2" t="s"><v>2</v></c><c r="C2" t="s"><v>3</v></c></row>
+<row r="3"><c r="A3" s="1"><v>45292</v></c><c r="B3" t="s"><v>4</v></c><c r="C3"><v>120.5</v></c></row>
+<row r="4"><c r="A4" s="2"><v>45292.5</v></c><c r="B4" t="s"><v>5</v></c><c r="C4"><v>0.30000000000000004</v></c><c r="E4" t="inlineStr"><is><t>late</t></is></c></row>
+<row r="5"><c r="A5" s="1"><v>0.75</v></c><c r="C5" s="3"><v>7</v></c><c r="D5" t="b"><v>1</v></c></row>
+<row r="6"><c r="A6"><v></v></c></row>
+</sheetData></worksheet>`
+
+func xlsxFixture(t *testing.T, szWorkbookPr string) []byte {
+	return zipFixture(t, map[string]string{
+		"xl/workbook.xml": strings.Replace(xlsxWorkbookXML, "%s", szWorkbookPr, 1),
+		"xl/_rels/workbook.xml.rels": xlsxRelsXML,
+		"xl/sharedStrings.xml": xlsxSharedStringsXML,
+		"xl/styles.xml": xlsxStylesXML,
+		"xl/worksheets/sheet1.xml": xlsxSheetXML,
+		"xl/worksheets/sheet2.xml": `<worksheet><sheetData/></worksheet>`,
+	})
+}
+
+func TestXlsxHeadersAndDates(t *testing.T) {
+	segments, err := XlsxExtractor{}.Extract(xlsxFixture(t, ""))
+	if err != nil {
+		t.Fatalf("Extract: %v", err)
+	}
+	if len(segments) != 1 {
+		t.Fatalf("got %d segments, want only the non-empty sheet", len(segments))
+	}
+	if segments[0].MetadataMap["sheet"] != "Invoices" {
+		t.Errorf("sheet %q, want Invoices", segments[0].MetadataMap["sheet"])
+	}
+
+	wantLines := []string{
+		"Invoices 2024",
+		"Columns: Date | Client | Amount",
+		"Date: 2024-01-01 | Client: Acme | Amount: 120.5",
+		"Date: 2024-01-01 12:00 | Client: Beta Corp | Amount: 0.3 | Column E: late",
+		"Date: 18:00:00 | Amount: 7 | Column D: TRUE",
+	}
+	gotLines := strings.Split(segments[0].SzText, "\n\n")
+	if strings.Join(gotLines, "\n") != strings.Join(wantLines, "\n") {
+		t.Errorf("lines:\n%s\nwant:\n%s", strings.Join(gotLines, "\n"), strings.Join(wantLines, "\n"))
+	}
+}
+
+func TestXlsxDate1904(t *testing.T) {
+	segments, err := XlsxExtractor{}.Extract(xlsxFixture(t, ` date1904="1"`))
+	if err != nil {
+		t.Fatalf("Extract: %v", err)
+	}
+	if !strings.Contains(segments[0].SzText, "Date: 2028-01-02 | Client: Acme") {
+		t.Errorf("1904 dates not applied:\n%s", segments[0].SzText)
+	}
+}
+
+func TestXlsxInvalidArchive(t *testing.T) {
+	if _, err := (XlsxExtractor{}).Extract([]byte("not a zip")); err == nil {
+		t.Error("expected an error for data that is not an archive")
+	}
+	if _, err := (XlsxExtractor{}).Extract(zipFixture(t, map[string]string{"xl/workbook.xml": "<workbook/>"})); err == nil {
+		t.Error("expected an error for a workbook without relationships")
+	}
+}
+
+func TestIsDateFormat(t *testing.T) {
+	tests := []struct {
+		szFormat string
+		bWant bool
+	}{
+		{"yyyy-mm-dd", true},
+		{"h:mm AM/PM", true},
+		{"[$-409]d-mmm", true},
+		{"0.00", false},
+		{`0.00" days"`, false},
+		{`#,##0\d`, false},
+		{"[Red]0.00", false},
+		{"General", false},
+	}
+
+	for _, tt := range tests {
+		if bGot := isDateFormat(tt.szFormat); bGot != tt.bWant {
+			t.Errorf("isDateFormat(%q) = %v, want %v", tt.szFormat, bGot, tt.bWant)
+		}
+	}
+}
+
+func TestTableLines(t *testing.T) {
+	tests := []struct {
+		szName string
+		rows [][]string
+		wantLines []string
+	}{
+		{
+			szName: "header labels later rows",
+			rows: [][]string{{"Name", "Qty"}, {"Bolt", "4"}, {"Nut", ""}},
+			wantLines: []string{"Columns: Name | Qty", "Name: Bolt | Qty: 4", "Name: Nut"},
+		},
+		{
+			szName: "numeric first row is no header",
+			rows: [][]string{{"1", "2"}, {"3", "4"}},
+			wantLines: []string{"1 | 2", "3 | 4"},
+		},
+		{
+			szName: "single row has no header",
+			rows: [][]string{{"Only", "Row"}},
+			wantLines: []string{"Only | Row"},
+		},
+		{
+			szName: "missing header cell uses column letter",
+			rows: [][]string{{"Name", "", "Note"}, {"A", "B", "C"}},
+			wantLines: []string{"Columns: Name | Note", "Name: A | Column B: B | Note: C"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.szName, func(t *testing.T) {
+			if gotLines := tableLines(tt.rows); strings.Join(gotLines, "\n") != strings.Join(tt.wantLines, "\n") {
+				t.Errorf("tableLines = %q, want %q", gotLines, tt.wantLines)
+			}
+		})
+	}
+}
+
+func TestColumnNames(t *testing.T) {
+	for szRef, inWant := range map[string]int{"A1": 0, "Z9": 25, "AA10": 26, "ab3": 27, "XFD1": 16383, "12": -1} {
+		if inGot := columnIndex(szRef); inGot != inWant {
+			t.Errorf("columnIndex(%q) = %d, want %d", szRef, inGot, inWant)
+		}
+	}
+	for inIndex, szWant := range map[int]string{0: "Column A", 25: "Column Z", 26: "Column AA", 701: "Column ZZ", 702: "Column AAA"} {
+		if szGot := columnName(inIndex); szGot != szWant {
+			t.Errorf("columnName(%d) = %q, want %q", inIndex, szGot, szWant)
+		}
+	}
+}
+
+const docxStylesXML = `<w:styles xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">
+<w:style w:type="paragraph" w:styleId="Heading1"><w:name w:val="heading 1"/></w:style>
+<w:style w:type="paragraph" w:styleId="Ueberschrift2"><w:name w:val="Überschrift 2"/><w:basedOn w:val="Heading1"/><w:pPr><w:outlineLvl w:val="1"/></w:pPr></w:style>
+</w:styles>`
+
+const docxDocumentXML = `<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>
+<w:p><w:pPr><w:pStyle w:val="Heading1"/></w:pPr><w:r><w:t>Contract</w:t></w:r></w:p>
+<w:p><w:r><w:t xml:space="preserve">Signed by </w:t></w:r><w:r><w:t>both parties.</w:t></w:r></w:p>
+<w:p><w:pPr><w:pStyle w:val="Ueberschrift2"/></w:pPr><w:r><w:t>Fees</w:t></w:r></w:p>
+<w:p><w:pPr><w:numPr><w:ilvl w:val="0"/></w:numPr></w:pPr><w:r><w:t>Paid monthly</w:t></w:r></w:p>
+<w:tbl>
+<w:tr><w:tc><w:p><w:r><w:t>Item</w:t></w:r></w:p></w:tc><w:tc><w:p><w:r><w:t>Price</w:t></w:r></w:p></w:tc></w:tr>
+<w:tr><w:tc><w:p><w:r><w:t>Support</w:t></w:r></w:p></w:tc><w:tc><w:p><w:r><w:t>300</w:t></w:r></w:p></w:tc></w:tr>
+</w:tbl>
+</w:body></w:document>`
+
+func TestDocxHeadingsListsAndTables(t *testing.T) {
+	segments, err := DocxExtractor{}.Extract(zipFixture(t, map[string]string{
+		"word/document.xml": docxDocumentXML,
+		"word/styles.xml": docxStylesXML,
+	}))
+	if err != nil {
+		t.Fatalf("Extract: %v", err)
+	}
+
+	szWant := strings.Join([]string{
+		"# Contract",
+		"Signed by both parties.",
+		"## Fees",
+		"- Paid monthly",
+		"Columns: Item | Price",
+		"Item: Support | Price: 300",
+	}, "\n\n")
+	if len(segments) != 1 || segments[0].SzText != szWant {
+		t.Errorf("text:\n%q\nwant:\n%q", segments, szWant)
+	}
+}
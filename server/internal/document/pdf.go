@@ -0,0 +1,691 @@
+package document
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/zlib"
+	"encoding/ascii85"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	RegisterExtractor(".pdf", PDFExtractor{})
+}
+
+// PDFExtractor pulls the text of every page out of a PDF, one segment per
+// page with its 1-based number in the "page" metadata. It understands
+// classic and compressed object streams, Flate/ASCIIHex/ASCII85 filters and
+// ToUnicode font maps, which covers what office tools and scanners with OCR
+// produce. Encrypted documents are not supported.
+type PDFExtractor struct{}
+
+func (PDFExtractor) Extract(data []byte) ([]Segment, error) {
+	doc, err := parsePDF(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, encrypted := doc.trailer["Encrypt"]; encrypted {
+		return nil, fmt.Errorf("encrypted PDFs are not supported")
+	}
+
+	pages := doc.pages()
+	if len(pages) == 0 {
+		return nil, fmt.Errorf("no pages found")
+	}
+
+	segments := make([]Segment, 0, len(pages))
+	for i, page := range pages {
+		szText := strings.TrimSpace(doc.pageText(page))
+		if szText == "" {
+			continue
+		}
+
+		segments = append(segments, Segment{
+			SzText: szText,
+			MetadataMap: map[string]string{
+				"page": strconv.Itoa(i + 1),
+				"total_pages": strconv.Itoa(len(pages)),
+			},
+		})
+	}
+
+	return segments, nil
+}
+
+type pdfName string
+type pdfKeyword string
+type pdfString []byte
+type pdfArray []interface{}
+type pdfDict map[pdfName]interface{}
+
+type pdfRef struct {
+	inNum int
+	inGen int
+}
+
+type pdfStream struct {
+	dict pdfDict
+	data []byte
+}
+
+type pdfDocument struct {
+	objectMap map[int]interface{}
+	trailer pdfDict
+	// inInflated counts the bytes all streams decompressed to so far.
+	inInflated int
+}
+
+var pdfObjectRegex = regexp.MustCompile(`(\d+)\s+(\d+)\s+obj\b`)
+
+// parsePDF locates objects by scanning for "n g obj" headers instead of
+// trusting the xref table, which keeps it working on damaged files and on
+// incrementally updated ones (later definitions win).
+func parsePDF(data []byte) (*pdfDocument, error) {
+	if !bytes.HasPrefix(bytes.TrimLeft(data, "\x00\t\n\f\r "), []byte("%PDF")) {
+		return nil, fmt.Errorf("not a PDF file")
+	}
+
+	doc := &pdfDocument{
+		objectMap: make(map[int]interface{}),
+		trailer: pdfDict{},
+	}
+
+	for _, match := range pdfObjectRegex.FindAllSubmatchIndex(data, -1) {
+		inNum, _ := strconv.Atoi(string(data[match[2]:match[3]]))
+
+		lexer := &pdfLexer{data: data, inPos: match[1]}
+		value, err := lexer.parseValue()
+		if err != nil {
+			continue
+		}
+
+		if dict, ok := value.(pdfDict); ok {
+			if stream, ok := lexer.parseStreamBody(dict); ok {
+				value = stream
+			}
+		}
+
+		doc.objectMap[inNum] = value
+	}
+
+	doc.expandObjectStreams()
+	doc.readTrailer(data)
+
+	return doc, nil
+}
+
+// expandObjectStreams unpacks objects stored inside /Type /ObjStm streams.
+func (doc *pdfDocument) expandObjectStreams() {
+	var streams []pdfStream
+	for _, value := range doc.objectMap {
+		if stream, ok := value.(pdfStream); ok && stream.dict["Type"] == pdfName("ObjStm") {
+			streams = append(streams, stream)
+		}
+	}
+
+	for _, stream := range streams {
+		data, err := doc.decodeStream(stream)
+		if err != nil {
+			continue
+		}
+
+		inCount := doc.intValue(stream.dict["N"])
+		inFirst := doc.intValue(stream.dict["First"])
+		if inFirst < 0 || inFirst > len(data) {
+			continue
+		}
+
+		header := &pdfLexer{data: data[:inFirst]}
+		for i := 0; i < inCount; i++ {
+			numToken, _ := header.next()
+			offsetToken, _ := header.next()
+			inNum, ok1 := numToken.(float64)
+			inOffset, ok2 := offsetToken.(float64)
+			if !ok1 || !ok2 {
+				break
+			}
+
+			if _, exists := doc.objectMap[int(inNum)]; exists {
+				continue
+			}
+			if inOffset < 0 || inOffset >= float64(len(data)-inFirst) {
+				continue
+			}
+
+			lexer := &pdfLexer{data: data, inPos: inFirst + int(inOffset)}
+			value, err := lexer.parseValue()
+			if err == nil {
+				doc.objectMap[int(inNum)] = value
+			}
+		}
+	}
+}
+
+// readTrailer merges every trailer dictionary and cross-reference stream
+// dictionary so that /Root and /Encrypt can be found.
+func (doc *pdfDocument) readTrailer(data []byte) {
+	inOffset := 0
+	for {
+		inIndex := bytes.Index(data[inOffset:], []byte("trailer"))
+		if inIndex < 0 {
+			break
+		}
+
+		lexer := &pdfLexer{data: data, inPos: inOffset + inIndex + len("trailer")}
+		if value, err := lexer.parseValue(); err == nil {
+			if dict, ok := value.(pdfDict); ok {
+				for key, entry := range dict {
+					doc.trailer[key] = entry
+				}
+			}
+		}
+		inOffset += inIndex + len("trailer")
+	}
+
+	for _, value := range doc.objectMap {
+		if stream, ok := value.(pdfStream); ok && stream.dict["Type"] == pdfName("XRef") {
+			for _, key := range []pdfName{"Root", "Encrypt"} {
+				if entry, exists := stream.dict[key]; exists {
+					doc.trailer[key] = entry
+				}
+			}
+		}
+	}
+}
+
+func (doc *pdfDocument) resolve(value interface{}) interface{} {
+	for inDepth := 0; inDepth < 32; inDepth++ {
+		ref, ok := value.(pdfRef)
+		if !ok {
+			return value
+		}
+		value = doc.objectMap[ref.inNum]
+	}
+	return nil
+}
+
+func (doc *pdfDocument) dictValue(value interface{}) pdfDict {
+	switch resolved := doc.resolve(value).(type) {
+	case pdfDict:
+		return resolved
+	case pdfStream:
+		return resolved.dict
+	}
+	return nil
+}
+
+func (doc *pdfDocument) arrayValue(value interface{}) pdfArray {
+	array, _ := doc.resolve(value).(pdfArray)
+	return array
+}
+
+func (doc *pdfDocument) intValue(value interface{}) int {
+	number, _ := doc.resolve(value).(float64)
+	return int(number)
+}
+
+// pages walks the page tree from the catalog, passing inherited resources
+// down. Without a usable catalog every /Type /Page object is returned in
+// object number order.
+func (doc *pdfDocument) pages() []pdfDict {
+	var pages []pdfDict
+
+	root := doc.dictValue(doc.trailer["Root"])
+	if root == nil {
+		for _, value := range doc.objectMap {
+			if dict := doc.dictValue(value); dict != nil && dict["Type"] == pdfName("Catalog") {
+				root = dict
+				break
+			}
+		}
+	}
+
+	if root != nil {
+		visited := make(map[interface{}]bool)
+		doc.collectPages(root["Pages"], nil, visited, &pages)
+	}
+
+	if len(pages) > 0 {
+		return pages
+	}
+
+	var numbers []int
+	for inNum, value := range doc.objectMap {
+		if dict := doc.dictValue(value); dict != nil && dict["Type"] == pdfName("Page") {
+			numbers = append(numbers, inNum)
+		}
+	}
+	sort.Ints(numbers)
+
+	for _, inNum := range numbers {
+		pages = append(pages, doc.dictValue(doc.objectMap[inNum]))
+	}
+	return pages
+}
+
+func (doc *pdfDocument) collectPages(node interface{}, inheritedResources interface{}, visited map[interface{}]bool, pages *[]pdfDict) {
+	if ref, ok := node.(pdfRef); ok {
+		if visited[ref] {
+			return
+		}
+		visited[ref] = true
+	}
+
+	dict := doc.dictValue(node)
+	if dict == nil {
+		return
+	}
+
+	resources := inheritedResources
+	if own, exists := dict["Resources"]; exists {
+		resources = own
+	}
+
+	if dict["Type"] == pdfName("Page") || (dict["Kids"] == nil && dict["Contents"] != nil) {
+		page := pdfDict{}
+		for key, value := range dict {
+			page[key] = value
+		}
+		page["Resources"] = resources
+		*pages = append(*pages, page)
+		return
+	}
+
+	for _, kid := range doc.arrayValue(dict["Kids"]) {
+		doc.collectPages(kid, resources, visited, pages)
+	}
+}
+
+func (doc *pdfDocument) decodeStream(stream pdfStream) ([]byte, error) {
+	var filters []interface{}
+	switch filter := doc.resolve(stream.dict["Filter"]).(type) {
+	case pdfName:
+		filters = []interface{}{filter}
+	case pdfArray:
+		filters = filter
+	}
+
+	data := stream.data
+	for _, filter := range filters {
+		var err error
+		switch doc.resolve(filter) {
+		case pdfName("FlateDecode"), pdfName("Fl"):
+			data, err = inflate(data, maxInflatedSize-doc.inInflated)
+			doc.inInflated += len(data)
+		case pdfName("ASCIIHexDecode"), pdfName("AHx"):
+			data, err = decodeASCIIHex(data)
+		case pdfName("ASCII85Decode"), pdfName("A85"):
+			data, err = decodeASCII85(data)
+		default:
+			err = fmt.Errorf("unsupported filter %v", filter)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return data, nil
+}
+
+// maxInflatedSize caps how much the streams of one PDF may decompress to
+// in total, like maxArchiveEntrySize for archive members, so a small file
+// holding a deflate bomb cannot exhaust memory. It is a variable so tests
+// can lower it.
+var maxInflatedSize = maxArchiveEntrySize
+
+// inflate decodes zlib data and tolerates the truncated or raw deflate
+// streams some generators write. Data decoding to more than inLimit bytes
+// is an error.
+func inflate(data []byte, inLimit int) ([]byte, error) {
+	reader, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		reader = flate.NewReader(bytes.NewReader(data))
+	}
+	defer reader.Close()
+
+	decoded, err := io.ReadAll(io.LimitReader(reader, int64(max(inLimit, 0))+1))
+	if len(decoded) > inLimit {
+		return nil, fmt.Errorf("stream decompresses to more than %d bytes", maxInflatedSize)
+	}
+	if err != nil && len(decoded) == 0 {
+		return nil, err
+	}
+	return decoded, nil
+}
+
+func decodeASCIIHex(data []byte) ([]byte, error) {
+	if inEnd := bytes.IndexByte(data, '>'); inEnd >= 0 {
+		data = data[:inEnd]
+	}
+
+	cleaned := make([]byte, 0, len(data))
+	for _, b := range data {
+		if !isPDFWhitespace(b) {
+			cleaned = append(cleaned, b)
+		}
+	}
+	if len(cleaned)%2 == 1 {
+		cleaned = append(cleaned, '0')
+	}
+
+	decoded := make([]byte, len(cleaned)/2)
+	_, err := hex.Decode(decoded, cleaned)
+	return decoded, err
+}
+
+func decodeASCII85(data []byte) ([]byte, error) {
+	data = bytes.TrimSpace(data)
+	data = bytes.TrimPrefix(data, []byte("<~"))
+	if inEnd := bytes.Index(data, []byte("~>")); inEnd >= 0 {
+		data = data[:inEnd]
+	}
+
+	decoded := make([]byte, len(data)*4/5+4)
+	inDecoded, _, err := ascii85.Decode(decoded, data, true)
+	if err != nil {
+		return nil, err
+	}
+	return decoded[:inDecoded], nil
+}
+
+// pdfLexer tokenizes PDF object syntax and content streams. Delimiters and
+// operators are returned as pdfKeyword, numbers as float64.
+type pdfLexer struct {
+	data []byte
+	inPos int
+}
+
+func isPDFWhitespace(b byte) bool {
+	return b == 0 || b == '\t' || b == '\n' || b == '\f' || b == '\r' || b == ' '
+}
+
+func isPDFDelimiter(b byte) bool {
+	return strings.IndexByte("()<>[]{}/%", b) >= 0
+}
+
+func (lexer *pdfLexer) skipSpace() {
+	for lexer.inPos < len(lexer.data) {
+		b := lexer.data[lexer.inPos]
+		if isPDFWhitespace(b) {
+			lexer.inPos++
+			continue
+		}
+		if b == '%' {
+			for lexer.inPos < len(lexer.data) && lexer.data[lexer.inPos] != '\n' && lexer.data[lexer.inPos] != '\r' {
+				lexer.inPos++
+			}
+			continue
+		}
+		return
+	}
+}
+
+func (lexer *pdfLexer) next() (interface{}, error) {
+	lexer.skipSpace()
+	if lexer.inPos >= len(lexer.data) {
+		return nil, io.EOF
+	}
+
+	b := lexer.data[lexer.inPos]
+	switch {
+	case b == '[' || b == ']' || b == '{' || b == '}':
+		lexer.inPos++
+		return pdfKeyword(string(b)), nil
+	case b == '<':
+		if lexer.inPos+1 < len(lexer.data) && lexer.data[lexer.inPos+1] == '<' {
+			lexer.inPos += 2
+			return pdfKeyword("<<"), nil
+		}
+		return lexer.readHexString()
+	case b == '>':
+		if lexer.inPos+1 < len(lexer.data) && lexer.data[lexer.inPos+1] == '>' {
+			lexer.inPos += 2
+			return pdfKeyword(">>"), nil
+		}
+		lexer.inPos++
+		return pdfKeyword(">"), nil
+	case b == '(':
+		return lexer.readLiteralString()
+	case b == '/':
+		return lexer.readName(), nil
+	case b == ')':
+		lexer.inPos++
+		return pdfKeyword(")"), nil
+	}
+
+	inStart := lexer.inPos
+	for lexer.inPos < len(lexer.data) && !isPDFWhitespace(lexer.data[lexer.inPos]) && !isPDFDelimiter(lexer.data[lexer.inPos]) {
+		lexer.inPos++
+	}
+	szToken := string(lexer.data[inStart:lexer.inPos])
+
+	if flNumber, err := strconv.ParseFloat(szToken, 64); err == nil && strings.IndexFunc(szToken, isNumberRune) < 0 {
+		return flNumber, nil
+	}
+
+	return pdfKeyword(szToken), nil
+}
+
+func isNumberRune(r rune) bool {
+	return !(r >= '0' && r <= '9') && r != '.' && r != '-' && r != '+'
+}
+
+func (lexer *pdfLexer) readName() pdfName {
+	lexer.inPos++
+	var sbName strings.Builder
+
+	for lexer.inPos < len(lexer.data) {
+		b := lexer.data[lexer.inPos]
+		if isPDFWhitespace(b) || isPDFDelimiter(b) {
+			break
+		}
+		if b == '#' && lexer.inPos+2 < len(lexer.data) {
+			if decoded, err := hex.DecodeString(string(lexer.data[lexer.inPos+1 : lexer.inPos+3])); err == nil {
+				sbName.WriteByte(decoded[0])
+				lexer.inPos += 3
+				continue
+			}
+		}
+		sbName.WriteByte(b)
+		lexer.inPos++
+	}
+
+	return pdfName(sbName.String())
+}
+
+func (lexer *pdfLexer) readHexString() (interface{}, error) {
+	inEnd := bytes.IndexByte(lexer.data[lexer.inPos:], '>')
+	if inEnd < 0 {
+		return nil, fmt.Errorf("unterminated hex string")
+	}
+
+	decoded, err := decodeASCIIHex(lexer.data[lexer.inPos+1 : lexer.inPos+inEnd])
+	lexer.inPos += inEnd + 1
+	if err != nil {
+		return nil, err
+	}
+	return pdfString(decoded), nil
+}
+
+func (lexer *pdfLexer) readLiteralString() (interface{}, error) {
+	lexer.inPos++
+	var out []byte
+	inDepth := 1
+
+	for lexer.inPos < len(lexer.data) {
+		b := lexer.data[lexer.inPos]
+		lexer.inPos++
+
+		switch b {
+		case '(':
+			inDepth++
+		case ')':
+			inDepth--
+			if inDepth == 0 {
+				return pdfString(out), nil
+			}
+		case '\\':
+			if lexer.inPos >= len(lexer.data) {
+				return pdfString(out), nil
+			}
+			escaped := lexer.data[lexer.inPos]
+			lexer.inPos++
+
+			switch escaped {
+			case 'n':
+				out = append(out, '\n')
+			case 'r':
+				out = append(out, '\r')
+			case 't':
+				out = append(out, '\t')
+			case 'b':
+				out = append(out, '\b')
+			case 'f':
+				out = append(out, '\f')
+			case '\r':
+				if lexer.inPos < len(lexer.data) && lexer.data[lexer.inPos] == '\n' {
+					lexer.inPos++
+				}
+			case '\n':
+			default:
+				if escaped >= '0' && escaped <= '7' {
+					inValue := int(escaped - '0')
+					for i := 0; i < 2 && lexer.inPos < len(lexer.data); i++ {
+						digit := lexer.data[lexer.inPos]
+						if digit < '0' || digit > '7' {
+							break
+						}
+						inValue = inValue*8 + int(digit-'0')
+						lexer.inPos++
+					}
+					out = append(out, byte(inValue))
+				} else {
+					out = append(out, escaped)
+				}
+			}
+			continue
+		}
+
+		out = append(out, b)
+	}
+
+	return pdfString(out), nil
+}
+
+// parseValue reads one complete object, resolving "n g R" references and
+// nested arrays and dictionaries.
+func (lexer *pdfLexer) parseValue() (interface{}, error) {
+	token, err := lexer.next()
+	if err != nil {
+		return nil, err
+	}
+
+	switch value := token.(type) {
+	case pdfKeyword:
+		switch value {
+		case "[":
+			array := pdfArray{}
+			for {
+				element, err := lexer.parseValue()
+				if err != nil {
+					return nil, err
+				}
+				if element == pdfKeyword("]") {
+					return array, nil
+				}
+				array = append(array, element)
+			}
+		case "<<":
+			dict := pdfDict{}
+			for {
+				key, err := lexer.parseValue()
+				if err != nil {
+					return nil, err
+				}
+				if key == pdfKeyword(">>") {
+					return dict, nil
+				}
+				name, ok := key.(pdfName)
+				if !ok {
+					continue
+				}
+				entry, err := lexer.parseValue()
+				if err != nil {
+					return nil, err
+				}
+				dict[name] = entry
+			}
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		}
+		return value, nil
+	case float64:
+		if value != float64(int(value)) || value < 0 {
+			return value, nil
+		}
+
+		inSaved := lexer.inPos
+		generation, err := lexer.next()
+		if inGen, ok := generation.(float64); err == nil && ok && inGen == float64(int(inGen)) {
+			if keyword, err := lexer.next(); err == nil && keyword == pdfKeyword("R") {
+				return pdfRef{inNum: int(value), inGen: int(inGen)}, nil
+			}
+		}
+		lexer.inPos = inSaved
+		return value, nil
+	}
+
+	return token, nil
+}
+
+// parseStreamBody reads the stream data that follows a dictionary, if any.
+// /Length is trusted only when it lies within the data and "endstream"
+// follows it, otherwise the data runs up to the next "endstream" keyword.
+func (lexer *pdfLexer) parseStreamBody(dict pdfDict) (pdfStream, bool) {
+	inSaved := lexer.inPos
+	token, err := lexer.next()
+	if err != nil || token != pdfKeyword("stream") {
+		lexer.inPos = inSaved
+		return pdfStream{}, false
+	}
+
+	inStart := lexer.inPos
+	if inStart < len(lexer.data) && lexer.data[inStart] == '\r' {
+		inStart++
+	}
+	if inStart < len(lexer.data) && lexer.data[inStart] == '\n' {
+		inStart++
+	}
+
+	if flLength, ok := dict["Length"].(float64); ok && flLength >= 0 && flLength <= float64(len(lexer.data)-inStart) {
+		inEnd := inStart + int(flLength)
+		rest := bytes.TrimLeft(lexer.data[inEnd:min(inEnd+32, len(lexer.data))], "\x00\t\n\f\r ")
+		if bytes.HasPrefix(rest, []byte("endstream")) {
+			lexer.inPos = inEnd
+			return pdfStream{dict: dict, data: lexer.data[inStart:inEnd]}, true
+		}
+	}
+
+	inEnd := bytes.Index(lexer.data[inStart:], []byte("endstream"))
+	if inEnd < 0 {
+		return pdfStream{}, false
+	}
+
+	data := lexer.data[inStart : inStart+inEnd]
+	data = bytes.TrimSuffix(data, []byte("\n"))
+	data = bytes.TrimSuffix(data, []byte("\r"))
+	lexer.inPos = inStart + inEnd
+
+	return pdfStream{dict: dict, data: data}, true
+}
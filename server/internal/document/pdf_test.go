@@ -0,0 +1,156 @@
+package document
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+const pdfContent = "BT /F1 12 Tf 72 712 Td (Hello PDF) Tj ET"
+
+// buildPDF assembles a one page PDF whose content stream declares
+// szLength, followed by szExtra objects.
+func buildPDF(szLength string, szExtra string) []byte {
+	return []byte("%PDF-1.4\n" +
+		"1 0 obj << /Type /Catalog /Pages 2 0 R >> endobj\n" +
+		"2 0 obj << /Type /Pages /Kids [3 0 R] /Count 1 >> endobj\n" +
+		"3 0 obj << /Type /Page /Parent 2 0 R /Resources << /Font << /F1 5 0 R >> >> /Contents 4 0 R >> endobj\n" +
+		"4 0 obj << /Length " + szLength + " >> stream\n" + pdfContent + "\nendstream endobj\n" +
+		"5 0 obj << /Type /Font /Subtype /Type1 /BaseFont /Helvetica >> endobj\n" +
+		szExtra +
+		"trailer << /Root 1 0 R >>\n%%EOF\n")
+}
+
+// objectStream wraps szBody in an uncompressed /ObjStm with the given
+// /First.
+func objectStream(szFirst string, szBody string) string {
+	return fmt.Sprintf("6 0 obj << /Type /ObjStm /N 1 /First %s /Length %d >> stream\n%s\nendstream endobj\n", szFirst, len(szBody), szBody)
+}
+
+func TestPDFExtractText(t *testing.T) {
+	segments, err := PDFExtractor{}.Extract(buildPDF(fmt.Sprint(len(pdfContent)), ""))
+	if err != nil {
+		t.Fatalf("Extract: %v", err)
+	}
+	if len(segments) != 1 || !strings.Contains(segments[0].SzText, "Hello PDF") {
+		t.Fatalf("segments %+v, want one page with Hello PDF", segments)
+	}
+	if segments[0].MetadataMap["page"] != "1" {
+		t.Errorf("page %q, want 1", segments[0].MetadataMap["page"])
+	}
+}
+
+func TestPDFMalformedLengths(t *testing.T) {
+	tests := []struct {
+		szName string
+		data []byte
+		bWantText bool
+	}{
+		{"negative length", buildPDF("-50", ""), true},
+		{"length past the end", buildPDF("100000", ""), true},
+		{"huge length", buildPDF("1e300", ""), true},
+		{"negative huge length", buildPDF("-1e300", ""), true},
+		{"wrong length", buildPDF("3", ""), true},
+		{"negative object stream first", buildPDF(fmt.Sprint(len(pdfContent)), objectStream("-1", "7 0 << /A 1 >>")), true},
+		{"object stream first past the end", buildPDF(fmt.Sprint(len(pdfContent)), objectStream("9999", "7 0 << /A 1 >>")), true},
+		{"negative object stream offset", buildPDF(fmt.Sprint(len(pdfContent)), objectStream("6", "7 -40 << /A 1 >>")), true},
+		{"object stream offset past the end", buildPDF(fmt.Sprint(len(pdfContent)), objectStream("6", "7 900 << /A 1 >>")), true},
+		{"truncated file", buildPDF(fmt.Sprint(len(pdfContent)), "")[:200], false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.szName, func(t *testing.T) {
+			segments, err := PDFExtractor{}.Extract(tt.data)
+			if !tt.bWantText {
+				return
+			}
+			if err != nil {
+				t.Fatalf("Extract: %v", err)
+			}
+			if len(segments) != 1 || !strings.Contains(segments[0].SzText, "Hello PDF") {
+				t.Errorf("segments %+v, want the page text", segments)
+			}
+		})
+	}
+}
+
+// flatePDF assembles a one page PDF whose contents are the given streams,
+// each compressed with FlateDecode.
+func flatePDF(streams [][]byte) []byte {
+	var sbObjects strings.Builder
+	var refs []string
+	for i, stream := range streams {
+		var compressed bytes.Buffer
+		writer := zlib.NewWriter(&compressed)
+		writer.Write(stream)
+		writer.Close()
+
+		refs = append(refs, fmt.Sprintf("%d 0 R", 6+i))
+		fmt.Fprintf(&sbObjects, "%d 0 obj << /Length %d /Filter /FlateDecode >> stream\n%s\nendstream endobj\n", 6+i, compressed.Len(), compressed.Bytes())
+	}
+
+	return []byte("%PDF-1.4\n" +
+		"1 0 obj << /Type /Catalog /Pages 2 0 R >> endobj\n" +
+		"2 0 obj << /Type /Pages /Kids [3 0 R] /Count 1 >> endobj\n" +
+		"3 0 obj << /Type /Page /Parent 2 0 R /Resources << /Font << /F1 5 0 R >> >> /Contents [" + strings.Join(refs, " ") + "] >> endobj\n" +
+		"5 0 obj << /Type /Font /Subtype /Type1 /BaseFont /Helvetica >> endobj\n" +
+		sbObjects.String() +
+		"trailer << /Root 1 0 R >>\n%%EOF\n")
+}
+
+func TestPDFDeflateBomb(t *testing.T) {
+	defer func(inSize int) { maxInflatedSize = inSize }(maxInflatedSize)
+	maxInflatedSize = 64 << 10
+
+	// Zeros are a comment in a content stream, so the bomb decodes to
+	// valid but useless content.
+	bomb := append([]byte("%"), make([]byte, 1<<20)...)
+	text := []byte(pdfContent + "\n")
+	// Leaves less of the budget than the text needs.
+	filler := append([]byte("%"), make([]byte, maxInflatedSize-len(text)/2)...)
+
+	tests := []struct {
+		szName string
+		streams [][]byte
+		bWantText bool
+	}{
+		{szName: "small stream", streams: [][]byte{text}, bWantText: true},
+		{szName: "bomb skipped", streams: [][]byte{bomb}, bWantText: false},
+		{szName: "text next to bomb kept", streams: [][]byte{text, bomb}, bWantText: true},
+		{szName: "limit spans streams", streams: [][]byte{filler, text}, bWantText: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.szName, func(t *testing.T) {
+			data := flatePDF(tt.streams)
+			if len(data) > 64<<10 {
+				t.Fatalf("fixture is %d bytes, expected it to compress", len(data))
+			}
+
+			segments, _ := PDFExtractor{}.Extract(data)
+			bText := len(segments) == 1 && strings.Contains(segments[0].SzText, "Hello PDF")
+			if bText != tt.bWantText {
+				t.Errorf("segments %+v, want text %v", segments, tt.bWantText)
+			}
+		})
+	}
+}
+
+func TestInflateLimit(t *testing.T) {
+	var compressed bytes.Buffer
+	writer := zlib.NewWriter(&compressed)
+	writer.Write(make([]byte, 1000))
+	writer.Close()
+
+	if decoded, err := inflate(compressed.Bytes(), 1000); err != nil || len(decoded) != 1000 {
+		t.Errorf("inflate at the limit = %d bytes, %v; want 1000 bytes", len(decoded), err)
+	}
+	if _, err := inflate(compressed.Bytes(), 999); err == nil {
+		t.Error("inflate past the limit succeeded")
+	}
+	if _, err := inflate(compressed.Bytes(), -5); err == nil {
+		t.Error("inflate with the budget used up succeeded")
+	}
+}
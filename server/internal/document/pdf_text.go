@@ -0,0 +1,464 @@
+package document
+
+import (
+	"bytes"
+	"strings"
+	"unicode/utf16"
+)
+
+// Thousandths of a text space unit in a TJ array that are read as a gap
+// between words rather than kerning.
+const pdfWordGap = -200
+
+// Form XObjects may nest; deeper nesting than this is treated as a loop.
+const pdfMaxFormDepth = 8
+
+type pdfFont struct {
+	toUnicodeMap map[uint32]string
+	inCodeLength int
+	bComposite bool
+}
+
+// decode maps the bytes of a shown string to text using the font's
+// ToUnicode map when present and WinAnsi otherwise. Composite fonts without
+// a ToUnicode map hold glyph ids only, which cannot be mapped to text.
+func (font *pdfFont) decode(data []byte) string {
+	if font == nil {
+		return decodeWinAnsi(data)
+	}
+
+	if font.toUnicodeMap == nil {
+		if font.bComposite {
+			return ""
+		}
+		return decodeWinAnsi(data)
+	}
+
+	var sbText strings.Builder
+	inStep := max(font.inCodeLength, 1)
+
+	for i := 0; i+inStep <= len(data); i += inStep {
+		var code uint32
+		for _, b := range data[i : i+inStep] {
+			code = code<<8 | uint32(b)
+		}
+
+		if szMapped, exists := font.toUnicodeMap[code]; exists {
+			sbText.WriteString(szMapped)
+		} else if inStep == 1 {
+			sbText.WriteString(decodeWinAnsi(data[i : i+1]))
+		}
+	}
+
+	return sbText.String()
+}
+
+type pdfTextWriter struct {
+	sbText strings.Builder
+	lastByte byte
+	flLastY float64
+	bHasY bool
+}
+
+func (writer *pdfTextWriter) write(szText string) {
+	if szText == "" {
+		return
+	}
+	writer.sbText.WriteString(szText)
+	writer.lastByte = szText[len(szText)-1]
+}
+
+func (writer *pdfTextWriter) newline() {
+	if writer.sbText.Len() > 0 && writer.lastByte != '\n' {
+		writer.write("\n")
+	}
+}
+
+func (writer *pdfTextWriter) space() {
+	if writer.sbText.Len() > 0 && writer.lastByte != ' ' && writer.lastByte != '\n' {
+		writer.write(" ")
+	}
+}
+
+func (writer *pdfTextWriter) moveTo(flY float64) {
+	if writer.bHasY && flY != writer.flLastY {
+		writer.newline()
+	}
+	writer.flLastY = flY
+	writer.bHasY = true
+}
+
+func (doc *pdfDocument) pageText(page pdfDict) string {
+	var content []byte
+	switch contents := doc.resolve(page["Contents"]).(type) {
+	case pdfStream:
+		content, _ = doc.decodeStream(contents)
+	case pdfArray:
+		for _, part := range contents {
+			if stream, ok := doc.resolve(part).(pdfStream); ok {
+				if data, err := doc.decodeStream(stream); err == nil {
+					content = append(content, data...)
+					content = append(content, '\n')
+				}
+			}
+		}
+	}
+
+	writer := &pdfTextWriter{}
+	doc.extractContent(content, doc.dictValue(page["Resources"]), writer, 0)
+
+	return cleanExtractedText(writer.sbText.String())
+}
+
+// extractContent interprets the text operators of a content stream and
+// recurses into form XObjects.
+func (doc *pdfDocument) extractContent(content []byte, resources pdfDict, writer *pdfTextWriter, inDepth int) {
+	if inDepth > pdfMaxFormDepth {
+		return
+	}
+
+	fontCache := make(map[pdfName]*pdfFont)
+	var currentFont *pdfFont
+	var operands []interface{}
+
+	lexer := &pdfLexer{data: content}
+	for {
+		value, err := lexer.parseValue()
+		if err != nil {
+			break
+		}
+
+		operator, isOperator := value.(pdfKeyword)
+		if !isOperator {
+			operands = append(operands, value)
+			continue
+		}
+
+		switch operator {
+		case "BI":
+			skipInlineImage(lexer)
+		case "BT":
+			writer.bHasY = false
+		case "ET":
+			writer.newline()
+		case "Tf":
+			if len(operands) >= 2 {
+				if name, ok := operands[len(operands)-2].(pdfName); ok {
+					currentFont = doc.loadFont(resources, name, fontCache)
+				}
+			}
+		case "Td", "TD":
+			if len(operands) >= 2 {
+				flX, _ := operands[len(operands)-2].(float64)
+				flY, _ := operands[len(operands)-1].(float64)
+				if flY != 0 {
+					writer.newline()
+				} else if flX > 0 {
+					writer.space()
+				}
+			}
+		case "Tm":
+			if len(operands) >= 6 {
+				if flY, ok := operands[5].(float64); ok {
+					writer.moveTo(flY)
+				}
+			}
+		case "T*":
+			writer.newline()
+		case "Tj":
+			if len(operands) >= 1 {
+				if str, ok := operands[len(operands)-1].(pdfString); ok {
+					writer.write(currentFont.decode(str))
+				}
+			}
+		case "'", "\"":
+			writer.newline()
+			if len(operands) >= 1 {
+				if str, ok := operands[len(operands)-1].(pdfString); ok {
+					writer.write(currentFont.decode(str))
+				}
+			}
+		case "TJ":
+			if len(operands) >= 1 {
+				if array, ok := operands[len(operands)-1].(pdfArray); ok {
+					for _, element := range array {
+						switch item := element.(type) {
+						case pdfString:
+							writer.write(currentFont.decode(item))
+						case float64:
+							if item < pdfWordGap {
+								writer.space()
+							}
+						}
+					}
+				}
+			}
+		case "Do":
+			if len(operands) >= 1 {
+				if name, ok := operands[len(operands)-1].(pdfName); ok {
+					doc.extractForm(resources, name, writer, inDepth)
+				}
+			}
+		}
+
+		operands = operands[:0]
+	}
+}
+
+func (doc *pdfDocument) extractForm(resources pdfDict, name pdfName, writer *pdfTextWriter, inDepth int) {
+	xobjects := doc.dictValue(resources["XObject"])
+	if xobjects == nil {
+		return
+	}
+
+	stream, ok := doc.resolve(xobjects[name]).(pdfStream)
+	if !ok || stream.dict["Subtype"] != pdfName("Form") {
+		return
+	}
+
+	data, err := doc.decodeStream(stream)
+	if err != nil {
+		return
+	}
+
+	formResources := doc.dictValue(stream.dict["Resources"])
+	if formResources == nil {
+		formResources = resources
+	}
+
+	doc.extractContent(data, formResources, writer, inDepth+1)
+}
+
+func (doc *pdfDocument) loadFont(resources pdfDict, name pdfName, fontCache map[pdfName]*pdfFont) *pdfFont {
+	if font, exists := fontCache[name]; exists {
+		return font
+	}
+
+	font := &pdfFont{inCodeLength: 1}
+	fontCache[name] = font
+
+	fonts := doc.dictValue(resources["Font"])
+	if fonts == nil {
+		return font
+	}
+
+	fontDict := doc.dictValue(fonts[name])
+	if fontDict == nil {
+		return font
+	}
+
+	if fontDict["Subtype"] == pdfName("Type0") {
+		font.bComposite = true
+		font.inCodeLength = 2
+	}
+
+	if stream, ok := doc.resolve(fontDict["ToUnicode"]).(pdfStream); ok {
+		if data, err := doc.decodeStream(stream); err == nil {
+			font.toUnicodeMap, font.inCodeLength = parseToUnicodeCMap(data, font.inCodeLength)
+		}
+	}
+
+	return font
+}
+
+// parseToUnicodeCMap reads the bfchar and bfrange sections of a ToUnicode
+// CMap. The code length comes from the first codespace range.
+func parseToUnicodeCMap(data []byte, inDefaultLength int) (map[uint32]string, int) {
+	toUnicodeMap := make(map[uint32]string)
+	inCodeLength := 0
+
+	lexer := &pdfLexer{data: data}
+	for {
+		token, err := lexer.next()
+		if err != nil {
+			break
+		}
+
+		switch token {
+		case pdfKeyword("begincodespacerange"):
+			for {
+				low, err := lexer.next()
+				if err != nil || low == pdfKeyword("endcodespacerange") {
+					break
+				}
+				lexer.next()
+				if str, ok := low.(pdfString); ok && inCodeLength == 0 {
+					inCodeLength = len(str)
+				}
+			}
+		case pdfKeyword("beginbfchar"):
+			for {
+				source, err := lexer.next()
+				if err != nil || source == pdfKeyword("endbfchar") {
+					break
+				}
+				target, _ := lexer.next()
+
+				sourceStr, ok1 := source.(pdfString)
+				targetStr, ok2 := target.(pdfString)
+				if ok1 && ok2 {
+					toUnicodeMap[bytesToCode(sourceStr)] = decodeUTF16BE(targetStr)
+				}
+			}
+		case pdfKeyword("beginbfrange"):
+			for {
+				low, err := lexer.next()
+				if err != nil || low == pdfKeyword("endbfrange") {
+					break
+				}
+				high, _ := lexer.next()
+				target, _ := lexer.parseValueAfter()
+
+				lowStr, ok1 := low.(pdfString)
+				highStr, ok2 := high.(pdfString)
+				if !ok1 || !ok2 {
+					continue
+				}
+
+				addBFRange(toUnicodeMap, bytesToCode(lowStr), bytesToCode(highStr), target)
+			}
+		}
+	}
+
+	if inCodeLength == 0 {
+		inCodeLength = inDefaultLength
+	}
+
+	return toUnicodeMap, inCodeLength
+}
+
+// parseValueAfter is parseValue without reference detection, which would
+// misread the numbers that occur inside CMaps.
+func (lexer *pdfLexer) parseValueAfter() (interface{}, error) {
+	token, err := lexer.next()
+	if err != nil {
+		return nil, err
+	}
+
+	if token != pdfKeyword("[") {
+		return token, nil
+	}
+
+	array := pdfArray{}
+	for {
+		element, err := lexer.next()
+		if err != nil {
+			return array, err
+		}
+		if element == pdfKeyword("]") {
+			return array, nil
+		}
+		array = append(array, element)
+	}
+}
+
+// Ranges wider than this are almost certainly corrupt.
+const maxBFRange = 1 << 16
+
+func addBFRange(toUnicodeMap map[uint32]string, low uint32, high uint32, target interface{}) {
+	if high < low || high-low > maxBFRange {
+		return
+	}
+
+	switch value := target.(type) {
+	case pdfString:
+		runes := utf16.Decode(bytesToUTF16(value))
+		if len(runes) == 0 {
+			return
+		}
+		for code := low; code <= high; code++ {
+			mapped := append([]rune{}, runes...)
+			mapped[len(mapped)-1] += rune(code - low)
+			toUnicodeMap[code] = string(mapped)
+		}
+	case pdfArray:
+		for i, element := range value {
+			if uint32(i) > high-low {
+				break
+			}
+			if str, ok := element.(pdfString); ok {
+				toUnicodeMap[low+uint32(i)] = decodeUTF16BE(str)
+			}
+		}
+	}
+}
+
+func bytesToCode(data []byte) uint32 {
+	var code uint32
+	for _, b := range data {
+		code = code<<8 | uint32(b)
+	}
+	return code
+}
+
+func bytesToUTF16(data []byte) []uint16 {
+	units := make([]uint16, 0, len(data)/2)
+	for i := 0; i+1 < len(data); i += 2 {
+		units = append(units, uint16(data[i])<<8|uint16(data[i+1]))
+	}
+	return units
+}
+
+func decodeUTF16BE(data []byte) string {
+	if len(data) == 1 {
+		return string(rune(data[0]))
+	}
+	return string(utf16.Decode(bytesToUTF16(data)))
+}
+
+// cp1252 characters for bytes 0x80-0x9F; the rest of WinAnsi matches Latin-1.
+var winAnsiHigh = [32]rune{
+	'€', 0, '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', 0, 'Ž', 0,
+	0, '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', 0, 'ž', 'Ÿ',
+}
+
+func decodeWinAnsi(data []byte) string {
+	var sbText strings.Builder
+	for _, b := range data {
+		switch {
+		case b >= 0x80 && b <= 0x9f:
+			if r := winAnsiHigh[b-0x80]; r != 0 {
+				sbText.WriteRune(r)
+			}
+		case b == '\t' || b == '\n' || b == '\r' || b >= 0x20:
+			sbText.WriteRune(rune(b))
+		}
+	}
+	return sbText.String()
+}
+
+func skipInlineImage(lexer *pdfLexer) {
+	inStart := bytes.Index(lexer.data[lexer.inPos:], []byte("ID"))
+	if inStart < 0 {
+		lexer.inPos = len(lexer.data)
+		return
+	}
+
+	inPos := lexer.inPos + inStart + 2
+	for inPos+2 < len(lexer.data) {
+		if isPDFWhitespace(lexer.data[inPos]) && lexer.data[inPos+1] == 'E' && lexer.data[inPos+2] == 'I' &&
+			(inPos+3 >= len(lexer.data) || isPDFWhitespace(lexer.data[inPos+3])) {
+			lexer.inPos = inPos + 3
+			return
+		}
+		inPos++
+	}
+
+	lexer.inPos = len(lexer.data)
+}
+
+// cleanExtractedText collapses runs of spaces and drops blank lines so that
+// paragraph detection in ChunkText is not thrown off by layout artefacts.
+func cleanExtractedText(szText string) string {
+	lines := strings.Split(szText, "\n")
+	cleaned := make([]string, 0, len(lines))
+
+	for _, szLine := range lines {
+		szLine = strings.Join(strings.Fields(szLine), " ")
+		if szLine != "" {
+			cleaned = append(cleaned, szLine)
+		}
+	}
+
+	return strings.Join(cleaned, "\n")
+}
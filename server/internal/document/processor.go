@@ -1,10 +1,139 @@
 package document
 
 import (
+	"fmt"
 	"regexp"
 	"strings"
+	"unicode/utf8"
 )
 
+// DefaultTargetTokens is the chunk size used when a profile sets none,
+// about the 500 bytes chunks used to be.
+const DefaultTargetTokens = 128
+
+// ChunkerVersion goes up whenever extraction or chunking changes the
+// chunks it makes of the same file, so files indexed before are redone.
+const ChunkerVersion = 1
+
+// ChunkOptions selects how the text of a file is cut into chunks. Sizes are
+// in approximate tokens (see EstimateTokens).
+type ChunkOptions struct {
+	BCodeAware bool
+	InTargetTokens int
+	InOverlapTokens int
+	InParentTokens int
+}
+
+// Version identifies the chunker together with the options that shape its
+// chunks.
+func (options ChunkOptions) Version() string {
+	return fmt.Sprintf("%d:target=%d:overlap=%d:parent=%d:code=%t",
+		ChunkerVersion, options.targetTokens(), options.overlapTokens(), max(options.InParentTokens, 0), options.BCodeAware)
+}
+
+func (options ChunkOptions) targetTokens() int {
+	if options.InTargetTokens <= 0 {
+		return DefaultTargetTokens
+	}
+	return options.InTargetTokens
+}
+
+// overlapTokens keeps the overlap below half a chunk so every chunk still
+// brings mostly new text.
+func (options ChunkOptions) overlapTokens() int {
+	if options.InOverlapTokens <= 0 {
+		return 0
+	}
+	return min(options.InOverlapTokens, options.targetTokens()/2)
+}
+
+// ChunkSegment cuts an extracted segment into chunks that each carry the
+// segment's metadata. Source files are split on declarations when
+// BCodeAware is set, everything else goes through ChunkTextTokens.
+func ChunkSegment(szExtension string, segment Segment, options ChunkOptions) []Segment {
+	var chunks []Segment
+	if options.BCodeAware && IsSourceFile(szExtension) {
+		chunks = ChunkCode(szExtension, segment.SzText, options.targetTokens())
+	} else {
+		for _, szChunk := range ChunkTextTokens(segment.SzText, options.targetTokens(), options.overlapTokens()) {
+			chunks = append(chunks, Segment{SzText: szChunk})
+		}
+	}
+
+	for i := range chunks {
+		if len(segment.MetadataMap) == 0 {
+			continue
+		}
+		metadataMap := make(map[string]string, len(segment.MetadataMap)+len(chunks[i].MetadataMap))
+		for szKey, szValue := range segment.MetadataMap {
+			metadataMap[szKey] = szValue
+		}
+		for szKey, szValue := range chunks[i].MetadataMap {
+			metadataMap[szKey] = szValue
+		}
+		chunks[i].MetadataMap = metadataMap
+	}
+
+	return chunks
+}
+
+// ParentSections cuts a segment into the parent sections used for parent
+// document retrieval, each carrying the segment's metadata. It returns nil
+// when InParentTokens is unset or the file is chunked as source code, whose
+// declarations already make self-contained chunks.
+func ParentSections(szExtension string, segment Segment, options ChunkOptions) []Segment {
+	if options.InParentTokens <= 0 || (options.BCodeAware && IsSourceFile(szExtension)) {
+		return nil
+	}
+
+	var sections []Segment
+	for _, szSection := range SplitSections(segment.SzText, max(options.InParentTokens, options.targetTokens())) {
+		sections = append(sections, Segment{SzText: szSection, MetadataMap: segment.MetadataMap})
+	}
+	return sections
+}
+
+var markdownHeaderRegex = regexp.MustCompile(`(?m)^#{1,6}\s+.+$`)
+
+// SplitSections cuts text at its markdown headers, keeping each header with
+// the text under it. Sections longer than inMaxTokens are cut further and
+// every piece after the first repeats the section's header.
+func SplitSections(szText string, inMaxTokens int) []string {
+	var sections []string
+
+	addSection := func(szSection string) {
+		szSection = strings.TrimSpace(szSection)
+		if szSection == "" {
+			return
+		}
+		if EstimateTokens(szSection) <= inMaxTokens {
+			sections = append(sections, szSection)
+			return
+		}
+
+		szHeader := ""
+		if loc := markdownHeaderRegex.FindStringIndex(szSection); loc != nil && loc[0] == 0 {
+			szHeader = szSection[:loc[1]]
+		}
+		inBudget := max(inMaxTokens-EstimateTokens(szHeader), inMaxTokens/2)
+		for i, szPiece := range ChunkTextTokens(szSection, inBudget, 0) {
+			if i > 0 && szHeader != "" {
+				szPiece = szHeader + "\n\n" + szPiece
+			}
+			sections = append(sections, szPiece)
+		}
+	}
+
+	lastIndex := 0
+	for _, indices := range markdownHeaderRegex.FindAllStringIndex(szText, -1) {
+		addSection(szText[lastIndex:indices[0]])
+		lastIndex = indices[0]
+	}
+	addSection(szText[lastIndex:])
+
+	return sections
+}
+
 func ChunkText(szText string, inMaxChunkSize int) []string {	
 	szText = strings.TrimSpace(szText)
 	
@@ -57,6 +186,87 @@ func ChunkText(szText string, inMaxChunkSize int) []string {
 
 }
 
+// ChunkTextTokens works like ChunkText but measures chunks in approximate
+// tokens, and starts every chunk after the first with the last
+// inOverlapTokens tokens of the one before, so a passage cut by a boundary
+// can still be matched from either side. The overlap counts towards
+// inTargetTokens.
+func ChunkTextTokens(szText string, inTargetTokens int, inOverlapTokens int) []string {
+	szText = strings.TrimSpace(szText)
+	if szText == "" {
+		return []string{}
+	}
+
+	inOverlapTokens = max(0, min(inOverlapTokens, inTargetTokens/2))
+	inBudget := inTargetTokens - inOverlapTokens
+
+	var chunks []string
+	var currentChunk strings.Builder
+	inCurrentTokens := 0
+
+	for _, part := range smartSplit(szText) {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		inPartTokens := EstimateTokens(part)
+
+		if inPartTokens > inBudget {
+			if currentChunk.Len() > 0 {
+				chunks = append(chunks, strings.TrimSpace(currentChunk.String()))
+				currentChunk.Reset()
+				inCurrentTokens = 0
+			}
+
+			chunks = append(chunks, ChunkByTokens(part, inBudget)...)
+			continue
+		}
+
+		if currentChunk.Len() > 0 && inCurrentTokens+inPartTokens > inBudget {
+			chunks = append(chunks, strings.TrimSpace(currentChunk.String()))
+			currentChunk.Reset()
+			inCurrentTokens = 0
+		}
+
+		if currentChunk.Len() > 0 {
+			currentChunk.WriteString("\n\n")
+		}
+		currentChunk.WriteString(part)
+		inCurrentTokens += inPartTokens
+	}
+
+	if currentChunk.Len() > 0 {
+		chunks = append(chunks, strings.TrimSpace(currentChunk.String()))
+	}
+
+	if inOverlapTokens == 0 {
+		return chunks
+	}
+
+	overlapped := make([]string, len(chunks))
+	for i, szChunk := range chunks {
+		overlapped[i] = szChunk
+		if i > 0 {
+			if szTail := strings.TrimSpace(tailTokens(chunks[i-1], inOverlapTokens)); szTail != "" {
+				overlapped[i] = szTail + overlapSeparator(szTail, szChunk) + szChunk
+			}
+		}
+	}
+
+	return overlapped
+}
+
+// overlapSeparator joins an overlap to its chunk with a space, except
+// between CJK characters and punctuation, which are written without one.
+func overlapSeparator(szTail string, szChunk string) string {
+	rLast, _ := utf8.DecodeLastRuneInString(szTail)
+	rFirst, _ := utf8.DecodeRuneInString(szChunk)
+	if isCJKWriting(rLast) && isCJKWriting(rFirst) {
+		return ""
+	}
+	return " "
+}
+
 func smartSplit(szText string) []string {
 	var parts []string
 
@@ -150,13 +360,22 @@ func ChunkBySize(szText string, inMaxChunkSize int) []string {
 	}
 
 	var chunks []string
-	for i := 0; i < len(szText); i += inMaxChunkSize {
+	for i := 0; i < len(szText); {
 		end := i + inMaxChunkSize
 		if end > len(szText) {
 			end = len(szText)
 		}
+		// Never cut inside a multi-byte UTF-8 sequence.
+		for end < len(szText) && end > i && !utf8.RuneStart(szText[end]) {
+			end--
+		}
+		if end == i {
+			_, inWidth := utf8.DecodeRuneInString(szText[i:])
+			end = i + inWidth
+		}
 		chunk := szText[i:end]
 		chunks = append(chunks, strings.TrimSpace(chunk))
+		i = end
 	}
 
 	return chunks
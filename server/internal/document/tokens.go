@@ -0,0 +1,150 @@
+package document
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxRunesPerToken is how many letters or digits of a word count as one
+// token. Subword tokenizers average about four characters per token on
+// English text.
+const maxRunesPerToken = 4
+
+// tokenSpan is the byte range of one approximate token.
+type tokenSpan struct {
+	inStart int
+	inEnd int
+}
+
+// EstimateTokens approximates how many tokens an embedding or chat model
+// would see in the text, without loading a real vocabulary: words count
+// one token per four letters, every CJK character, punctuation mark or
+// emoji counts one, and whitespace is free.
+func EstimateTokens(szText string) int {
+	return len(tokenSpans(szText))
+}
+
+// tokenSpans cuts the text into approximate tokens. Boundaries always fall
+// between runes, and combining marks, emoji modifiers, zero-width-joiner
+// sequences and flag pairs stay with the rune before them, so cutting the
+// text at a span boundary never breaks a character apart.
+func tokenSpans(szText string) []tokenSpan {
+	var spans []tokenSpan
+	inWordRunes := 0
+	bJoinNext := false
+	bOpenFlag := false
+
+	for inPos := 0; inPos < len(szText); {
+		r, inWidth := utf8.DecodeRuneInString(szText[inPos:])
+		inEnd := inPos + inWidth
+
+		switch {
+		case len(spans) > 0 && (bJoinNext || isJoiningRune(r) || (bOpenFlag && isRegionalIndicator(r))):
+			spans[len(spans)-1].inEnd = inEnd
+			bJoinNext = r == '\u200d'
+			bOpenFlag = false
+		case unicode.IsSpace(r):
+			inWordRunes = 0
+			bOpenFlag = false
+		case isCJK(r):
+			spans = append(spans, tokenSpan{inStart: inPos, inEnd: inEnd})
+			inWordRunes = 0
+			bOpenFlag = false
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_':
+			if inWordRunes > 0 && inWordRunes < maxRunesPerToken {
+				spans[len(spans)-1].inEnd = inEnd
+				inWordRunes++
+			} else {
+				spans = append(spans, tokenSpan{inStart: inPos, inEnd: inEnd})
+				inWordRunes = 1
+			}
+			bOpenFlag = false
+		default:
+			spans = append(spans, tokenSpan{inStart: inPos, inEnd: inEnd})
+			inWordRunes = 0
+			bOpenFlag = isRegionalIndicator(r)
+		}
+
+		inPos = inEnd
+	}
+
+	return spans
+}
+
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
+
+// isCJKWriting also counts the ideographic punctuation and full-width
+// forms used in CJK text.
+func isCJKWriting(r rune) bool {
+	return isCJK(r) || (r >= 0x3000 && r <= 0x303f) || (r >= 0xff00 && r <= 0xffef)
+}
+
+// isJoiningRune reports runes that render as part of the previous one.
+func isJoiningRune(r rune) bool {
+	return unicode.In(r, unicode.Mn, unicode.Me) ||
+		r == '\u200d' || (r >= 0xfe00 && r <= 0xfe0f) ||
+		(r >= 0x1f3fb && r <= 0x1f3ff) || (r >= 0xe0020 && r <= 0xe007f)
+}
+
+func isRegionalIndicator(r rune) bool {
+	return r >= 0x1f1e6 && r <= 0x1f1ff
+}
+
+// ChunkByTokens cuts text into pieces of at most inMaxTokens approximate
+// tokens, preferring to cut between words. It is the token-counting
+// counterpart of ChunkBySize.
+func ChunkByTokens(szText string, inMaxTokens int) []string {
+	szText = strings.TrimSpace(szText)
+	spans := tokenSpans(szText)
+	if len(spans) <= inMaxTokens || inMaxTokens <= 0 {
+		return []string{szText}
+	}
+
+	var chunks []string
+	for inFirst := 0; inFirst < len(spans); {
+		inCut := inFirst + inMaxTokens
+		if inCut >= len(spans) {
+			chunks = append(chunks, strings.TrimSpace(szText[spans[inFirst].inStart:]))
+			break
+		}
+
+		// Step back to the closest word start in the second half of
+		// the piece; text with no spaces, like CJK, is cut anywhere.
+		for k := inCut; k > inFirst+inMaxTokens/2; k-- {
+			if spans[k].inStart > spans[k-1].inEnd {
+				inCut = k
+				break
+			}
+		}
+
+		chunks = append(chunks, strings.TrimSpace(szText[spans[inFirst].inStart:spans[inCut].inStart]))
+		inFirst = inCut
+	}
+
+	return chunks
+}
+
+// tailTokens returns roughly the last inTokens tokens of the text, starting
+// at a word boundary when one is available.
+func tailTokens(szText string, inTokens int) string {
+	spans := tokenSpans(szText)
+	if inTokens <= 0 || len(spans) == 0 {
+		return ""
+	}
+	if len(spans) <= inTokens {
+		return szText
+	}
+
+	inFirst := len(spans) - inTokens
+	for k := inFirst; k < len(spans)-inTokens/2; k++ {
+		if spans[k].inStart > spans[k-1].inEnd {
+			inFirst = k
+			break
+		}
+	}
+
+	return szText[spans[inFirst].inStart:]
+}
@@ -0,0 +1,225 @@
+package document
+
+import (
+	"strings"
+	"testing"
+	"unicode"
+	"unicode/utf8"
+)
+
+var unicodeSamples = map[string]string{
+	"cjk": strings.Repeat("東京都の天気は晴れです。明日は雨が降るでしょう。한국어 문장도 있습니다. ", 6),
+	"emoji": strings.Repeat("Great job 👍🏽🎉 see you 🇯🇵🇫🇷 soon ❤️ ", 6),
+	"zwj": strings.Repeat("👨‍👩‍👧‍👦👩🏽‍💻🏳️‍🌈 ", 12),
+	"combining": strings.Repeat("Café naïve ã́o ", 10),
+	"mixed": strings.Repeat("Report 報告書 🧾 total ₩12,000 été ", 6),
+}
+
+func removeSpaces(szText string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, szText)
+}
+
+// checkBoundaries fails when a chunk is invalid UTF-8 or splits a
+// character from the marks or joiners that belong to it.
+func checkBoundaries(t *testing.T, szName string, chunks []string) {
+	t.Helper()
+
+	for i, szChunk := range chunks {
+		if !utf8.ValidString(szChunk) {
+			t.Errorf("%s: chunk %d is not valid UTF-8: %q", szName, i, szChunk)
+			continue
+		}
+		if szChunk == "" {
+			continue
+		}
+		rFirst, _ := utf8.DecodeRuneInString(szChunk)
+		rLast, _ := utf8.DecodeLastRuneInString(szChunk)
+		if isJoiningRune(rFirst) {
+			t.Errorf("%s: chunk %d starts with joining rune %U: %q", szName, i, rFirst, szChunk)
+		}
+		if rLast == '‍' {
+			t.Errorf("%s: chunk %d ends with a zero width joiner: %q", szName, i, szChunk)
+		}
+	}
+}
+
+func TestEstimateTokens(t *testing.T) {
+	tests := []struct {
+		szText string
+		inWant int
+	}{
+		{"", 0},
+		{"   \n\t", 0},
+		{"word", 1},
+		{"hello", 2},
+		{"a, b.", 4},
+		{"日本語", 3},
+		{"한국", 2},
+		{"👍", 1},
+		{"👍🏽", 1},
+		{"❤️", 1},
+		{"👨‍👩‍👧‍👦", 1},
+		{"🇯🇵🇫🇷", 2},
+		{"é", 1},
+		{"cafés", 2},
+	}
+
+	for _, tt := range tests {
+		if inGot := EstimateTokens(tt.szText); inGot != tt.inWant {
+			t.Errorf("EstimateTokens(%q) = %d, want %d", tt.szText, inGot, tt.inWant)
+		}
+	}
+}
+
+func TestChunkByTokensUnicode(t *testing.T) {
+	for szName, szText := range unicodeSamples {
+		for inMax := 1; inMax <= 9; inMax++ {
+			chunks := ChunkByTokens(szText, inMax)
+			checkBoundaries(t, szName, chunks)
+
+			for i, szChunk := range chunks {
+				if inTokens := EstimateTokens(szChunk); inTokens > inMax {
+					t.Errorf("%s max %d: chunk %d has %d tokens: %q", szName, inMax, i, inTokens, szChunk)
+				}
+			}
+			if removeSpaces(strings.Join(chunks, "")) != removeSpaces(szText) {
+				t.Errorf("%s max %d: chunks do not add up to the text", szName, inMax)
+			}
+		}
+	}
+}
+
+func TestChunkByTokensPrefersWordBoundaries(t *testing.T) {
+	chunks := ChunkByTokens("alpha beta gamma delta epsilon zeta", 5)
+	for _, szChunk := range chunks {
+		for _, szWord := range strings.Fields(szChunk) {
+			if !strings.Contains(" alpha beta gamma delta epsilon zeta ", " "+szWord+" ") {
+				t.Errorf("word cut apart: %q in %q", szWord, chunks)
+			}
+		}
+	}
+}
+
+func TestChunkTextTokensBudget(t *testing.T) {
+	for szName, szText := range unicodeSamples {
+		szDocument := "# Title\n\n" + szText + "\n\n" + szText
+		for _, inTarget := range []int{8, 16, 40} {
+			for _, inOverlap := range []int{0, 3, inTarget} {
+				chunks := ChunkTextTokens(szDocument, inTarget, inOverlap)
+				checkBoundaries(t, szName, chunks)
+
+				for i, szChunk := range chunks {
+					if inTokens := EstimateTokens(szChunk); inTokens > inTarget {
+						t.Errorf("%s target %d overlap %d: chunk %d has %d tokens", szName, inTarget, inOverlap, i, inTokens)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestChunkTextTokensOverlap(t *testing.T) {
+	tests := []struct {
+		szName string
+		szText string
+		szSeparator string
+	}{
+		{
+			szName: "english",
+			szText: "The first paragraph talks about backups and how often they run.\n\n" +
+				"The second paragraph explains restores and who is allowed to start them.\n\n" +
+				"The third paragraph lists the hosts that take part in the rotation.",
+			szSeparator: " ",
+		},
+		{
+			szName: "cjk",
+			szText: "東京都の天気は晴れです。明日は雨が降るでしょう。週末は雪になるかもしれません。来週は暖かくなる予報です。",
+			szSeparator: "",
+		},
+		{
+			szName: "emoji",
+			szText: strings.Repeat("👨‍👩‍👧‍👦 family 🇯🇵 trip 👍🏽 ", 8),
+			szSeparator: " ",
+		},
+	}
+
+	const inTarget, inOverlap = 16, 4
+	for _, tt := range tests {
+		t.Run(tt.szName, func(t *testing.T) {
+			// Without overlap the budget is the same, so these are the
+			// chunks the overlap is added to.
+			base := ChunkTextTokens(tt.szText, inTarget-inOverlap, 0)
+			overlapped := ChunkTextTokens(tt.szText, inTarget, inOverlap)
+			if len(base) < 2 || len(base) != len(overlapped) {
+				t.Fatalf("got %d base and %d overlapped chunks", len(base), len(overlapped))
+			}
+			checkBoundaries(t, tt.szName, overlapped)
+
+			if overlapped[0] != base[0] {
+				t.Errorf("first chunk changed: %q", overlapped[0])
+			}
+			for i := 1; i < len(base); i++ {
+				szTail := strings.TrimSpace(tailTokens(base[i-1], inOverlap))
+				if szTail == "" || !strings.HasSuffix(base[i-1], szTail) {
+					t.Fatalf("tail %q is not the end of %q", szTail, base[i-1])
+				}
+				if inTokens := EstimateTokens(szTail); inTokens > inOverlap {
+					t.Errorf("tail %q has %d tokens, more than %d", szTail, inTokens, inOverlap)
+				}
+				if szWant := szTail + tt.szSeparator + base[i]; overlapped[i] != szWant {
+					t.Errorf("chunk %d = %q, want %q", i, overlapped[i], szWant)
+				}
+			}
+		})
+	}
+}
+
+func TestTailTokens(t *testing.T) {
+	tests := []struct {
+		szText string
+		inTokens int
+		szWant string
+	}{
+		{"one two three four five", 3, "four five"},
+		{"one two three four", 10, "one two three four"},
+		{"one two", 0, ""},
+		{"東京都の天気", 2, "天気"},
+		{"go 👨‍👩‍👧‍👦", 1, "👨‍👩‍👧‍👦"},
+		{"le cafe\u0301", 1, "cafe\u0301"},
+	}
+
+	for _, tt := range tests {
+		if szGot := tailTokens(tt.szText, tt.inTokens); szGot != tt.szWant {
+			t.Errorf("tailTokens(%q, %d) = %q, want %q", tt.szText, tt.inTokens, szGot, tt.szWant)
+		}
+	}
+}
+
+func TestChunkBySizeUnicode(t *testing.T) {
+	for szName, szText := range unicodeSamples {
+		for _, inMax := range []int{1, 2, 3, 5, 7, 16, 64} {
+			chunks := ChunkBySize(szText, inMax)
+			for i, szChunk := range chunks {
+				if !utf8.ValidString(szChunk) {
+					t.Errorf("%s max %d: chunk %d is not valid UTF-8: %q", szName, inMax, i, szChunk)
+				}
+				// A chunk only exceeds the size when one rune does.
+				if len(szChunk) > inMax && utf8.RuneCountInString(szChunk) > 1 {
+					t.Errorf("%s max %d: chunk %d has %d bytes", szName, inMax, i, len(szChunk))
+				}
+			}
+			if removeSpaces(strings.Join(chunks, "")) != removeSpaces(szText) {
+				t.Errorf("%s max %d: chunks do not add up to the text", szName, inMax)
+			}
+		}
+	}
+
+	if chunks := ChunkBySize("short", 100); len(chunks) != 1 || chunks[0] != "short" {
+		t.Errorf("short text split: %q", chunks)
+	}
+}
@@ -0,0 +1,398 @@
+package document
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func init() {
+	RegisterExtractor(".xlsx", XlsxExtractor{})
+}
+
+// XlsxExtractor reads every worksheet of an Excel workbook, one segment per
+// sheet with its name in the "sheet" metadata. Each row becomes one line
+// whose cells are labelled with the sheet's column headers, and cells
+// formatted as dates are written as dates rather than serial numbers.
+type XlsxExtractor struct{}
+
+type xlsxSheet struct {
+	szName string
+	szPath string
+}
+
+type xlsxWorkbook struct {
+	archive *zipArchive
+	sharedStrings []string
+	dateStyleMap map[int]bool
+	bDate1904 bool
+}
+
+func (XlsxExtractor) Extract(data []byte) ([]Segment, error) {
+	archive, err := openZipArchive(data)
+	if err != nil {
+		return nil, err
+	}
+
+	workbook := &xlsxWorkbook{archive: archive, dateStyleMap: map[int]bool{}}
+
+	sheets, err := workbook.readSheets()
+	if err != nil {
+		return nil, err
+	}
+
+	if archive.has("xl/sharedStrings.xml") {
+		if content, err := archive.read("xl/sharedStrings.xml"); err == nil {
+			workbook.sharedStrings = parseSharedStrings(content)
+		}
+	}
+	if archive.has("xl/styles.xml") {
+		if content, err := archive.read("xl/styles.xml"); err == nil {
+			workbook.dateStyleMap = parseDateStyles(content)
+		}
+	}
+
+	var segments []Segment
+	for _, sheet := range sheets {
+		content, err := archive.read(sheet.szPath)
+		if err != nil {
+			return nil, err
+		}
+
+		rows, err := workbook.parseSheet(content)
+		if err != nil {
+			return nil, fmt.Errorf("sheet %q: %w", sheet.szName, err)
+		}
+
+		szText := strings.Join(tableLines(rows), "\n\n")
+		if szText == "" {
+			continue
+		}
+
+		segments = append(segments, Segment{
+			SzText: szText,
+			MetadataMap: map[string]string{"sheet": sheet.szName},
+		})
+	}
+
+	return segments, nil
+}
+
+// readSheets lists the worksheets in workbook order, resolving each one's
+// relationship id to its part inside the archive.
+func (workbook *xlsxWorkbook) readSheets() ([]xlsxSheet, error) {
+	content, err := workbook.archive.read("xl/workbook.xml")
+	if err != nil {
+		return nil, err
+	}
+	rels, err := workbook.archive.read("xl/_rels/workbook.xml.rels")
+	if err != nil {
+		return nil, err
+	}
+
+	targetMap := make(map[string]string)
+	decoder := xml.NewDecoder(bytes.NewReader(rels))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			break
+		}
+		if element, ok := token.(xml.StartElement); ok && element.Name.Local == "Relationship" {
+			if !strings.HasSuffix(xmlAttr(element, "Type"), "/worksheet") {
+				continue
+			}
+			szTarget := xmlAttr(element, "Target")
+			if strings.HasPrefix(szTarget, "/") {
+				szTarget = strings.TrimPrefix(szTarget, "/")
+			} else {
+				szTarget = path.Join("xl", szTarget)
+			}
+			targetMap[xmlAttr(element, "Id")] = szTarget
+		}
+	}
+
+	var sheets []xlsxSheet
+	decoder = xml.NewDecoder(bytes.NewReader(content))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			break
+		}
+		element, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		switch element.Name.Local {
+		case "workbookPr":
+			szDate1904 := xmlAttr(element, "date1904")
+			workbook.bDate1904 = szDate1904 == "1" || szDate1904 == "true"
+		case "sheet":
+			// The relationship id is the "id" attribute in the
+			// relationships namespace, not the plain sheetId.
+			for _, attr := range element.Attr {
+				if attr.Name.Local == "id" && attr.Name.Space != "" {
+					if szPath, exists := targetMap[attr.Value]; exists {
+						sheets = append(sheets, xlsxSheet{szName: xmlAttr(element, "name"), szPath: szPath})
+					}
+				}
+			}
+		}
+	}
+
+	if len(sheets) == 0 {
+		return nil, fmt.Errorf("no worksheets found")
+	}
+
+	return sheets, nil
+}
+
+// parseSharedStrings returns the workbook's string table. Phonetic runs
+// are left out since they repeat the text in another script.
+func parseSharedStrings(data []byte) []string {
+	var sharedStrings []string
+	var sbText strings.Builder
+	bInText := false
+
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			break
+		}
+
+		switch element := token.(type) {
+		case xml.StartElement:
+			switch element.Name.Local {
+			case "si":
+				sbText.Reset()
+			case "rPh":
+				decoder.Skip()
+			case "t":
+				bInText = true
+			}
+		case xml.EndElement:
+			switch element.Name.Local {
+			case "si":
+				sharedStrings = append(sharedStrings, sbText.String())
+			case "t":
+				bInText = false
+			}
+		case xml.CharData:
+			if bInText {
+				sbText.Write(element)
+			}
+		}
+	}
+
+	return sharedStrings
+}
+
+// parseDateStyles returns the cell style indexes whose number format shows
+// a date or time.
+func parseDateStyles(data []byte) map[int]bool {
+	customFormatMap := make(map[int]string)
+	dateStyleMap := make(map[int]bool)
+	inStyle := 0
+	bInCellXfs := false
+
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			break
+		}
+
+		switch element := token.(type) {
+		case xml.StartElement:
+			switch element.Name.Local {
+			case "numFmt":
+				if inId, err := strconv.Atoi(xmlAttr(element, "numFmtId")); err == nil {
+					customFormatMap[inId] = xmlAttr(element, "formatCode")
+				}
+			case "cellXfs":
+				bInCellXfs = true
+			case "xf":
+				if !bInCellXfs {
+					continue
+				}
+				inFormat, _ := strconv.Atoi(xmlAttr(element, "numFmtId"))
+				if szFormat, exists := customFormatMap[inFormat]; exists {
+					dateStyleMap[inStyle] = isDateFormat(szFormat)
+				} else {
+					dateStyleMap[inStyle] = isBuiltinDateFormat(inFormat)
+				}
+				inStyle++
+			}
+		case xml.EndElement:
+			if element.Name.Local == "cellXfs" {
+				bInCellXfs = false
+			}
+		}
+	}
+
+	return dateStyleMap
+}
+
+func isBuiltinDateFormat(inFormat int) bool {
+	return (inFormat >= 14 && inFormat <= 22) || (inFormat >= 27 && inFormat <= 36) ||
+		(inFormat >= 45 && inFormat <= 47) || (inFormat >= 50 && inFormat <= 58)
+}
+
+// isDateFormat reports whether a custom number format contains date or
+// time placeholders, ignoring quoted literals, escapes and [Color] blocks.
+func isDateFormat(szFormat string) bool {
+	bQuoted := false
+	bBracket := false
+	bEscaped := false
+
+	for _, r := range strings.ToLower(szFormat) {
+		switch {
+		case bEscaped:
+			bEscaped = false
+		case r == '\\':
+			bEscaped = true
+		case r == '"':
+			bQuoted = !bQuoted
+		case bQuoted:
+		case r == '[':
+			bBracket = true
+		case r == ']':
+			bBracket = false
+		case bBracket:
+		case strings.ContainsRune("dmyhs", r):
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseSheet returns the sheet's rows with every cell placed at its column.
+func (workbook *xlsxWorkbook) parseSheet(data []byte) ([][]string, error) {
+	var rows [][]string
+	var row []string
+	var sbValue strings.Builder
+	szType := ""
+	inStyle := 0
+	inColumn := -1
+	bInValue := false
+
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch element := token.(type) {
+		case xml.StartElement:
+			switch element.Name.Local {
+			case "row":
+				row = nil
+			case "c":
+				szType = xmlAttr(element, "t")
+				inStyle, _ = strconv.Atoi(xmlAttr(element, "s"))
+				inColumn = columnIndex(xmlAttr(element, "r"))
+				if inColumn < 0 {
+					inColumn = len(row)
+				}
+				sbValue.Reset()
+			case "v", "t":
+				bInValue = true
+			case "rPh":
+				decoder.Skip()
+			}
+		case xml.EndElement:
+			switch element.Name.Local {
+			case "v", "t":
+				bInValue = false
+			case "c":
+				szValue := workbook.cellText(szType, inStyle, sbValue.String())
+				if szValue == "" || inColumn > 16383 {
+					continue
+				}
+				for len(row) <= inColumn {
+					row = append(row, "")
+				}
+				row[inColumn] = szValue
+			case "row":
+				if len(row) > 0 {
+					rows = append(rows, row)
+				}
+			}
+		case xml.CharData:
+			if bInValue {
+				sbValue.Write(element)
+			}
+		}
+	}
+
+	return rows, nil
+}
+
+func (workbook *xlsxWorkbook) cellText(szType string, inStyle int, szValue string) string {
+	szValue = strings.TrimSpace(szValue)
+	if szValue == "" {
+		return ""
+	}
+
+	switch szType {
+	case "s":
+		inIndex, err := strconv.Atoi(szValue)
+		if err != nil || inIndex < 0 || inIndex >= len(workbook.sharedStrings) {
+			return ""
+		}
+		return strings.TrimSpace(workbook.sharedStrings[inIndex])
+	case "b":
+		if szValue == "1" {
+			return "TRUE"
+		}
+		return "FALSE"
+	case "inlineStr", "str", "e":
+		return szValue
+	}
+
+	flValue, err := strconv.ParseFloat(szValue, 64)
+	if err != nil {
+		return szValue
+	}
+
+	if workbook.dateStyleMap[inStyle] {
+		return workbook.formatDate(flValue)
+	}
+
+	// Round away binary noise such as 0.30000000000000004.
+	flValue, _ = strconv.ParseFloat(strconv.FormatFloat(flValue, 'g', 15, 64), 64)
+	return strconv.FormatFloat(flValue, 'f', -1, 64)
+}
+
+// formatDate turns a spreadsheet serial date into text. Whole numbers are
+// dates, values below one are times of day.
+func (workbook *xlsxWorkbook) formatDate(flSerial float64) string {
+	tmEpoch := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+	if workbook.bDate1904 {
+		tmEpoch = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+
+	flDays, flFraction := math.Modf(flSerial)
+	tmValue := tmEpoch.AddDate(0, 0, int(flDays)).Add(time.Duration(math.Round(flFraction*86400)) * time.Second)
+
+	switch {
+	case flFraction == 0:
+		return tmValue.Format("2006-01-02")
+	case flDays == 0:
+		return tmValue.Format("15:04:05")
+	default:
+		return tmValue.Format("2006-01-02 15:04")
+	}
+}
@@ -4,4 +4,6 @@ import "context"
 
 type EmbeddingInterface interface {
 	EmbedText(ctx context.Context, szText string) ([]float32, error)
+	EmbedTexts(ctx context.Context, texts []string) ([][]float32, error)
+	ModelName() string
 }
@@ -6,19 +6,22 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"time"
 )
 
 type OllamaEmbedding struct {
 	SzModel string
 	SzHost string
 	Client *http.Client
+	TmTimeout time.Duration
 }
 
-func NewOllamaEmbedding(szModel, szHost string) *OllamaEmbedding {
+func NewOllamaEmbedding(szModel, szHost string, tmTimeout time.Duration) *OllamaEmbedding {
 	return &OllamaEmbedding{
 		SzModel: szModel,
 		SzHost: szHost,
 		Client: &http.Client{},
+		TmTimeout: tmTimeout,
 	}
 }
 
@@ -31,10 +34,35 @@ type ollamaEmbedResponse struct {
 	SzEmbedding [][]float32 `json:"embeddings"`
 }
 
+func (ollamaEmbed *OllamaEmbedding) ModelName() string {
+	return ollamaEmbed.SzModel
+}
+
 func (ollamaEmbed *OllamaEmbedding) EmbedText(ctx context.Context, szText string) ([]float32, error) {
+	vectors, err := ollamaEmbed.EmbedTexts(ctx, []string{szText})
+	if err != nil {
+		return nil, err
+	}
+
+	return vectors[0], nil
+}
+
+// EmbedTexts embeds several texts in one /api/embed call. The vectors come
+// back in the order of the texts.
+func (ollamaEmbed *OllamaEmbedding) EmbedTexts(ctx context.Context, texts []string) ([][]float32, error) {
+	if len(texts) == 0 {
+		return nil, nil
+	}
+
+	if ollamaEmbed.TmTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, ollamaEmbed.TmTimeout)
+		defer cancel()
+	}
+
 	reqBody, _ := json.Marshal(ollamaEmbedRequest{
 		SzModel: ollamaEmbed.SzModel,
-		SzInput: []string{szText},
+		SzInput: texts,
 	})
 
 	req, err := http.NewRequestWithContext(ctx, "POST", fmt.Sprintf("%s/api/embed", ollamaEmbed.SzHost), bytes.NewBuffer(reqBody))
@@ -59,6 +87,9 @@ func (ollamaEmbed *OllamaEmbedding) EmbedText(ctx context.Context, szText string
 	if len(res.SzEmbedding) == 0 {
 		return nil, fmt.Errorf("no embeddings returned")
 	}
+	if len(res.SzEmbedding) != len(texts) {
+		return nil, fmt.Errorf("got %d embeddings for %d texts", len(res.SzEmbedding), len(texts))
+	}
 
-	return res.SzEmbedding[0], nil
+	return res.SzEmbedding, nil
 }
@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"chak-server/internal/memory"
+	"chak-server/internal/prompt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// SnippetLength is the most bytes of a document chunk returned as its
+// snippet.
+const SnippetLength = 240
+
+var citationRegex = regexp.MustCompile(`\[(\d+)\]`)
+
+// DocumentSource is a document chunk the answer was generated from. Marker
+// is the n of the [n] citation the prompt gave it, and Cited tells whether
+// the response actually cites it.
+type DocumentSource struct {
+	Marker int `json:"marker"`
+	Path string `json:"path"`
+	Filename string `json:"filename"`
+	ChunkID string `json:"chunk_id,omitempty"`
+	SectionID string `json:"section_id,omitempty"`
+	Score float64 `json:"score"`
+	Snippet string `json:"snippet"`
+	Cited bool `json:"cited"`
+}
+
+// documentSources lists the document memories placed into the prompt,
+// numbered the way BuildChat numbers them.
+func documentSources(memories []memory.MemoryEntry, szResponse string) []DocumentSource {
+	citedMap := make(map[int]bool)
+	for _, match := range citationRegex.FindAllStringSubmatch(szResponse, -1) {
+		if inMarker, err := strconv.Atoi(match[1]); err == nil {
+			citedMap[inMarker] = true
+		}
+	}
+
+	var sources []DocumentSource
+	for i, mem := range memories {
+		if !prompt.IsDocument(mem) {
+			continue
+		}
+
+		sources = append(sources, DocumentSource{
+			Marker: i + 1,
+			Path: mem.MetadataMap["filepath"],
+			Filename: mem.MetadataMap["filename"],
+			ChunkID: mem.MetadataMap["chunk_id"],
+			SectionID: mem.MetadataMap["section_id"],
+			Score: mem.FlScore,
+			Snippet: snippet(mem.SzContent),
+			Cited: citedMap[i+1],
+		})
+	}
+	return sources
+}
+
+func snippet(szText string) string {
+	szText = strings.Join(strings.Fields(szText), " ")
+	if len(szText) <= SnippetLength {
+		return szText
+	}
+
+	inEnd := SnippetLength
+	for inEnd > 0 && !utf8.RuneStart(szText[inEnd]) {
+		inEnd--
+	}
+	if inSpace := strings.LastIndexByte(szText[:inEnd], ' '); inSpace > SnippetLength/2 {
+		inEnd = inSpace
+	}
+	return szText[:inEnd] + "..."
+}
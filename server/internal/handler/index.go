@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"chak-server/internal/indexer"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// IndexHandler serves the indexer status and rebuild endpoints. The
+// indexer is looked up on every request because switching profiles
+// replaces it.
+type IndexHandler struct {
+	getIndexer func() indexer.ManagerInterface
+}
+
+type RebuildRequest struct {
+	BForce bool `json:"force"`
+}
+
+func NewIndexHandler(getIndexer func() indexer.ManagerInterface) *IndexHandler {
+	return &IndexHandler{
+		getIndexer: getIndexer,
+	}
+}
+
+func (idxHandler *IndexHandler) HandleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(idxHandler.getIndexer().Status())
+}
+
+// HandleRebuild starts a full scan of the active profile, or with
+// {"force": true} a re-index of every file, and returns at once.
+func (idxHandler *IndexHandler) HandleRebuild(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req RebuildRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := idxHandler.getIndexer().Rebuild(req.BForce); err != nil {
+		if errors.Is(err, indexer.ErrRebuildPending) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "started",
+		"force": req.BForce,
+	})
+}
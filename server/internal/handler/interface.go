@@ -11,3 +11,19 @@ type ProfileHandlerInterface interface {
 	HandleGetActiveProfile(w http.ResponseWriter, r *http.Request)
 	HandleSwitchProfile(w http.ResponseWriter, r *http.Request)
 }
+
+type SessionHandlerInterface interface {
+	HandleSessions(w http.ResponseWriter, r *http.Request)
+	HandleSession(w http.ResponseWriter, r *http.Request)
+}
+
+type MemoryHandlerInterface interface {
+	HandleMemories(w http.ResponseWriter, r *http.Request)
+	HandleSearch(w http.ResponseWriter, r *http.Request)
+	HandleMemory(w http.ResponseWriter, r *http.Request)
+}
+
+type IndexHandlerInterface interface {
+	HandleStatus(w http.ResponseWriter, r *http.Request)
+	HandleRebuild(w http.ResponseWriter, r *http.Request)
+}
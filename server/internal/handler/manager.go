@@ -1,52 +1,81 @@
 package handler
 
 import (
+	"chak-server/internal/config"
 	"chak-server/internal/memory"
 	"chak-server/internal/ollama"
 	"chak-server/internal/prompt"
+	"chak-server/internal/rerank"
 	"chak-server/internal/search"
+	"chak-server/internal/session"
 	"chak-server/internal/types"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
-	"time"
 )
 
 const MaxRememberedMessages = 10
 
+// ChatRequest carries the whole conversation, or with a SessionID only the
+// new turns, which are appended to the stored session once answered.
 type ChatRequest struct {
     MessageList []types.Message `json:"messages"`
     Search bool   `json:"search"`
     Model  string `json:"model"`
 	Rag bool `json:"rag"`
+	Stream bool `json:"stream"`
+	SessionID string `json:"session_id,omitempty"`
 }
 
 type ChatResponse struct {
     Response string                `json:"response"`
     Sources  []search.SearchResultData `json:"sources,omitempty"`
+    Documents []DocumentSource `json:"documents,omitempty"`
+    SessionID string `json:"session_id,omitempty"`
     Tokens   int                   `json:"tokens"`
     Time     float64               `json:"time"`
 }
 
+type StreamToken struct {
+	Token string `json:"token"`
+}
+
+type StreamError struct {
+	Error string `json:"error"`
+}
+
 type ChatHandlerManager struct {
 	searchManager search.SearchInterface
 	promptManager prompt.PromptInterface
 	ollamaManager ollama.OllamaInterface
 	memoryManager memory.MemoryInterface
+	rerankManager rerank.RerankInterface
+	sessionManager session.SessionInterface
+	timeouts config.TimeoutConfig
+	retrieval config.RetrievalConfig
 }
 
-func NewChatHandlerManager(sm search.SearchInterface, pm prompt.PromptInterface, om ollama.OllamaInterface, mm memory.MemoryInterface) *ChatHandlerManager {
+// NewChatHandlerManager builds the chat handler. rm may be nil, in which case
+// the top memories by retrieval score go straight into the prompt.
+func NewChatHandlerManager(sm search.SearchInterface, pm prompt.PromptInterface, om ollama.OllamaInterface, mm memory.MemoryInterface, rm rerank.RerankInterface, ssm session.SessionInterface, timeouts config.TimeoutConfig, retrieval config.RetrievalConfig) *ChatHandlerManager {
 	return &ChatHandlerManager{
 		searchManager: sm,
 		promptManager: pm,
 		ollamaManager: om,
 		memoryManager: mm,
+		rerankManager: rm,
+		sessionManager: ssm,
+		timeouts: timeouts,
+		retrieval: retrieval,
 	}
 }
 
 func (chatManager *ChatHandlerManager) buildContext(messages []types.Message) []types.Message {
-	if len(messages) - 1 > MaxRememberedMessages {
-		messages = messages[len(messages)-MaxRememberedMessages:len(messages)-1]
+	if len(messages) > MaxRememberedMessages {
+		messages = messages[len(messages)-MaxRememberedMessages:]
 	}
 	return messages
 }
@@ -67,58 +96,194 @@ func (chatManager *ChatHandlerManager) HandleChat(w http.ResponseWriter, r *http
 		return
 	}
 
+	if req.SessionID != "" {
+		current, err := chatManager.sessionManager.Get(req.SessionID)
+		if errors.Is(err, session.ErrNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Session error", http.StatusInternalServerError)
+			return
+		}
+		messages = append(current.MessageList, messages...)
+	}
+
 	messages = chatManager.buildContext(messages)
+	ctx := r.Context()
+
+	systemMessage, turns, searchResultData, memories, err := chatManager.prepareChat(ctx, req, messages)
+	if err != nil {
+		http.Error(w, "Search error", http.StatusInternalServerError)
+		return
+	}
+
+	if req.Stream {
+		chatManager.streamChat(w, ctx, req, systemMessage, turns, searchResultData, memories)
+		return
+	}
 
+	genCtx, cancel := context.WithTimeout(ctx, chatManager.timeouts.Generate())
+	defer cancel()
+
+	ollamaResp, err := chatManager.ollamaManager.Chat(genCtx, req.Model, systemMessage, turns)
+	if err != nil {
+		log.Printf("Generation error: %v", err)
+		http.Error(w, "Ollama error", http.StatusInternalServerError)
+		return
+	}
+
+	chatManager.saveExchange(ctx, req, ollamaResp.SzResponse)
+	chatManager.appendToSession(req, ollamaResp.SzResponse)
+
+	json.NewEncoder(w).Encode(newChatResponse(req, ollamaResp, searchResultData, memories))
+}
+
+func (chatManager *ChatHandlerManager) prepareChat(ctx context.Context, req ChatRequest, messages []types.Message) (types.Message, []types.Message, []search.SearchResultData, []memory.MemoryEntry, error) {
 	szLastMessage := messages[len(messages)-1].SzContent
-	ctx := r.Context()
 
-	szFilterType := "conversation"
+	szFilterType := memory.TypeConversation
 	if req.Rag {
-		szFilterType = "document"
+		szFilterType = memory.TypeDocument
+	}
+
+	relevantMemories := chatManager.retrieveMemories(ctx, szLastMessage, szFilterType)
+
+	var searchResultData []search.SearchResultData
+
+	if req.Search {
+		searchCtx, cancel := context.WithTimeout(ctx, chatManager.timeouts.Search())
+		result, err := chatManager.searchManager.Search(searchCtx, szLastMessage)
+		cancel()
+		if err != nil {
+			return types.Message{}, nil, nil, nil, fmt.Errorf("search failed: %w", err)
+		}
+		searchResultData = result
 	}
 
-	relevantMemories, err := chatManager.memoryManager.RetrieveRelevantContext(ctx, szLastMessage, 3, szFilterType)
+	systemMessage, turns := chatManager.promptManager.BuildChat(messages, searchResultData, relevantMemories)
+	return systemMessage, turns, searchResultData, relevantMemories, nil
+}
+
+// retrieveMemories fetches a wide candidate set and narrows it to the
+// configured top N, through the reranker when one is configured.
+func (chatManager *ChatHandlerManager) retrieveMemories(ctx context.Context, szQuery string, szFilterType string) []memory.MemoryEntry {
+	iTopN := chatManager.retrieval.TopN()
+
+	candidates, err := chatManager.memoryManager.RetrieveRelevantContext(ctx, szQuery, chatManager.retrieval.Candidates(), szFilterType)
 	if err != nil {
 		log.Printf("Memory retrieval error: %v", err)
+		return nil
 	}
 
-	var searchResultData []search.SearchResultData
-	
-	if req.Search && len(messages) > 0 {
-		lastMsg := messages[len(messages)-1].SzContent
-
-		if result, err := chatManager.searchManager.Search(lastMsg); err == nil {
-			searchResultData = result
-		} else {
-			http.Error(w, "Search error", http.StatusInternalServerError)
-			return
+	// Chunks linked to a parent section are swapped for the section before
+	// narrowing, so the top N counts distinct sections.
+	candidates = chatManager.memoryManager.ResolveParents(candidates)
+
+	if chatManager.rerankManager != nil && len(candidates) > 1 {
+		rerankCtx, cancel := context.WithTimeout(ctx, chatManager.timeouts.Rerank())
+		reranked, err := chatManager.rerankManager.Rerank(rerankCtx, szQuery, candidates, iTopN)
+		cancel()
+		if err == nil {
+			return chatManager.memoryManager.ResolveExchanges(reranked)
 		}
+		log.Printf("Rerank error, using retrieval order: %v", err)
 	}
 
-	szFinalPrompt := chatManager.promptManager.Build(messages, searchResultData, relevantMemories)
+	if len(candidates) > iTopN {
+		candidates = candidates[:iTopN]
+	}
 
-	ollamaResp, err := chatManager.ollamaManager.Generate(req.Model, szFinalPrompt)	
-	if err != nil {
-		http.Error(w, "Ollama error", http.StatusInternalServerError)
+	// A question or answer that made the cut brings the other half of its
+	// exchange along, so the prompt sees each exchange whole.
+	return chatManager.memoryManager.ResolveExchanges(candidates)
+}
+
+// streamChat relays generated tokens as Server-Sent Events. Each token is a
+// "token" event, the final "done" event carries the same payload as a
+// regular ChatResponse and failures are reported as an "error" event.
+func (chatManager *ChatHandlerManager) streamChat(w http.ResponseWriter, ctx context.Context, req ChatRequest, systemMessage types.Message, turns []types.Message, searchResultData []search.SearchResultData, memories []memory.MemoryEntry) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
 		return
 	}
 
-	metadata := map[string]string {
-		"type":"conversation",
-		"role":"assistant",
-		"timestamp": time.Now().Format(time.RFC3339),
-	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	genCtx, cancel := context.WithTimeout(ctx, chatManager.timeouts.Generate())
+	defer cancel()
 
-	if err := chatManager.memoryManager.SaveMemory(ctx, ollamaResp.SzResponse, metadata); err != nil {
-		log.Printf("Error saving assistant memory: %v", err)
+	ollamaResp, err := chatManager.ollamaManager.ChatStream(genCtx, req.Model, systemMessage, turns, func(szToken string) error {
+		return writeEvent(w, flusher, "token", StreamToken{Token: szToken})
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			log.Printf("Client disconnected, generation cancelled")
+			return
+		}
+		log.Printf("Streaming error: %v", err)
+		writeEvent(w, flusher, "error", StreamError{Error: "Ollama error"})
+		return
 	}
 
-	resp := ChatResponse {
+	chatManager.saveExchange(ctx, req, ollamaResp.SzResponse)
+	chatManager.appendToSession(req, ollamaResp.SzResponse)
+
+	writeEvent(w, flusher, "done", newChatResponse(req, ollamaResp, searchResultData, memories))
+}
+
+// newChatResponse pairs the answer with its web sources and the documents
+// its citation markers refer to.
+func newChatResponse(req ChatRequest, ollamaResp ollama.GenerateResponse, searchResultData []search.SearchResultData, memories []memory.MemoryEntry) ChatResponse {
+	return ChatResponse{
 		Response: ollamaResp.SzResponse,
 		Sources: searchResultData,
+		Documents: documentSources(memories, ollamaResp.SzResponse),
+		SessionID: req.SessionID,
 		Tokens: ollamaResp.ITotalTokens,
 		Time: ollamaResp.FTotalTime,
 	}
+}
+
+// appendToSession stores the new turns of a session together with the
+// answer. Nothing is stored when generation fails, so the request can be
+// retried.
+func (chatManager *ChatHandlerManager) appendToSession(req ChatRequest, szResponse string) {
+	if req.SessionID == "" {
+		return
+	}
+
+	turns := append(req.MessageList[:len(req.MessageList):len(req.MessageList)], types.Message{SzRole: prompt.RoleAssistant, SzContent: szResponse})
+	if _, err := chatManager.sessionManager.AppendMessages(req.SessionID, turns); err != nil {
+		log.Printf("Error saving session %s: %v", req.SessionID, err)
+	}
+}
+
+// saveExchange remembers the last message of the request together with
+// the answer it got.
+func (chatManager *ChatHandlerManager) saveExchange(ctx context.Context, req ChatRequest, szResponse string) {
+	szQuestion := req.MessageList[len(req.MessageList)-1].SzContent
+
+	if _, err := chatManager.memoryManager.SaveExchange(ctx, szQuestion, szResponse, req.SessionID); err != nil {
+		log.Printf("Error saving exchange memory: %v", err)
+	}
+}
+
+func writeEvent(w http.ResponseWriter, flusher http.Flusher, szEvent string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", szEvent, data); err != nil {
+		return err
+	}
+	flusher.Flush()
 
-	json.NewEncoder(w).Encode(resp)
+	return nil
 }
@@ -0,0 +1,234 @@
+package handler
+
+import (
+	"chak-server/internal/config"
+	"chak-server/internal/memory"
+	"chak-server/internal/ollama"
+	"chak-server/internal/search"
+	"chak-server/internal/session"
+	"chak-server/internal/types"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// fakeMemory answers retrieval with nothing and records saved exchanges.
+type fakeMemory struct {
+	memory.MemoryInterface
+	sessionIDs []string
+}
+
+func (memoryMgr *fakeMemory) RetrieveRelevantContext(ctx context.Context, szQuery string, iTopK int, szFilterType string) ([]memory.MemoryEntry, error) {
+	return nil, nil
+}
+
+func (memoryMgr *fakeMemory) ResolveParents(entries []memory.MemoryEntry) []memory.MemoryEntry {
+	return entries
+}
+
+func (memoryMgr *fakeMemory) ResolveExchanges(entries []memory.MemoryEntry) []memory.MemoryEntry {
+	return entries
+}
+
+func (memoryMgr *fakeMemory) SaveExchange(ctx context.Context, szQuestion string, szAnswer string, szSessionID string) (string, error) {
+	memoryMgr.sessionIDs = append(memoryMgr.sessionIDs, szSessionID)
+	return "exchange", nil
+}
+
+// fakePrompt passes the conversation through unchanged.
+type fakePrompt struct{}
+
+func (promptMgr fakePrompt) Build(messageList []types.Message, searchResultData []search.SearchResultData, memories []memory.MemoryEntry) string {
+	return ""
+}
+
+func (promptMgr fakePrompt) BuildChat(messageList []types.Message, searchResultData []search.SearchResultData, memories []memory.MemoryEntry) (types.Message, []types.Message) {
+	return types.Message{SzRole: "system"}, messageList
+}
+
+// fakeOllama answers every chat with szAnswer and keeps the turns it got.
+type fakeOllama struct {
+	szAnswer string
+	turnsList [][]types.Message
+}
+
+func (ollamaMgr *fakeOllama) Generate(ctx context.Context, szModel string, szPrompt string) (ollama.GenerateResponse, error) {
+	return ollama.GenerateResponse{SzResponse: ollamaMgr.szAnswer}, nil
+}
+
+func (ollamaMgr *fakeOllama) GenerateStream(ctx context.Context, szModel string, szPrompt string, onToken func(szToken string) error) (ollama.GenerateResponse, error) {
+	return ollamaMgr.Generate(ctx, szModel, szPrompt)
+}
+
+func (ollamaMgr *fakeOllama) Chat(ctx context.Context, szModel string, systemMessage types.Message, messageList []types.Message) (ollama.GenerateResponse, error) {
+	ollamaMgr.turnsList = append(ollamaMgr.turnsList, messageList)
+	return ollama.GenerateResponse{SzResponse: ollamaMgr.szAnswer}, nil
+}
+
+func (ollamaMgr *fakeOllama) ChatStream(ctx context.Context, szModel string, systemMessage types.Message, messageList []types.Message, onToken func(szToken string) error) (ollama.GenerateResponse, error) {
+	for _, szToken := range strings.SplitAfter(ollamaMgr.szAnswer, " ") {
+		if err := onToken(szToken); err != nil {
+			return ollama.GenerateResponse{}, err
+		}
+	}
+	return ollamaMgr.Chat(ctx, szModel, systemMessage, messageList)
+}
+
+func newTestChatHandler(t *testing.T) (*ChatHandlerManager, *session.SessionManager, *fakeOllama, *fakeMemory) {
+	t.Helper()
+
+	sessionMgr := session.NewSessionManager(t.TempDir())
+	ollamaMgr := &fakeOllama{szAnswer: "Use a starter."}
+	memoryMgr := &fakeMemory{}
+	chatManager := NewChatHandlerManager(nil, fakePrompt{}, ollamaMgr, memoryMgr, nil, sessionMgr, config.TimeoutConfig{}, config.RetrievalConfig{})
+
+	return chatManager, sessionMgr, ollamaMgr, memoryMgr
+}
+
+func postChat(chatManager *ChatHandlerManager, req ChatRequest) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(req)
+	recorder := httptest.NewRecorder()
+	chatManager.HandleChat(recorder, httptest.NewRequest(http.MethodPost, "/chat", strings.NewReader(string(body))))
+	return recorder
+}
+
+func TestChatSession(t *testing.T) {
+	for _, bStream := range []bool{false, true} {
+		szName := "json"
+		if bStream {
+			szName = "stream"
+		}
+
+		t.Run(szName, func(t *testing.T) {
+			chatManager, sessionMgr, ollamaMgr, memoryMgr := newTestChatHandler(t)
+
+			created, err := sessionMgr.Create("")
+			if err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+
+			for i, szQuestion := range []string{"How do I bake bread?", "And rye?"} {
+				recorder := postChat(chatManager, ChatRequest{
+					MessageList: []types.Message{{SzRole: "user", SzContent: szQuestion}},
+					SessionID: created.SzID,
+					Stream: bStream,
+				})
+				if recorder.Code != http.StatusOK {
+					t.Fatalf("request %d: status %d: %s", i, recorder.Code, recorder.Body.String())
+				}
+				if !strings.Contains(recorder.Body.String(), `"session_id":"`+created.SzID+`"`) {
+					t.Errorf("request %d: response does not carry the session id: %s", i, recorder.Body.String())
+				}
+			}
+
+			// The second request only sent its new turn; the model still
+			// saw the whole conversation.
+			turns := ollamaMgr.turnsList[1]
+			if len(turns) != 3 || turns[0].SzContent != "How do I bake bread?" || turns[1].SzContent != "Use a starter." || turns[2].SzContent != "And rye?" {
+				t.Errorf("model got %+v, want the stored turns followed by the new one", turns)
+			}
+
+			stored, err := sessionMgr.Get(created.SzID)
+			if err != nil {
+				t.Fatalf("Get: %v", err)
+			}
+			if len(stored.MessageList) != 4 || stored.MessageList[3].SzRole != "assistant" {
+				t.Errorf("stored %+v, want two questions with their answers", stored.MessageList)
+			}
+			if stored.SzTitle != "How do I bake bread?" {
+				t.Errorf("title %q, want the first question", stored.SzTitle)
+			}
+			if len(memoryMgr.sessionIDs) != 2 || memoryMgr.sessionIDs[0] != created.SzID {
+				t.Errorf("exchanges saved for sessions %v, want %s twice", memoryMgr.sessionIDs, created.SzID)
+			}
+		})
+	}
+}
+
+func TestChatUnknownSession(t *testing.T) {
+	chatManager, sessionMgr, ollamaMgr, memoryMgr := newTestChatHandler(t)
+
+	recorder := postChat(chatManager, ChatRequest{
+		MessageList: []types.Message{{SzRole: "user", SzContent: "hello"}},
+		SessionID: "sess_missing",
+	})
+	if recorder.Code != http.StatusNotFound {
+		t.Errorf("status %d, want %d", recorder.Code, http.StatusNotFound)
+	}
+	if len(ollamaMgr.turnsList) != 0 || len(memoryMgr.sessionIDs) != 0 {
+		t.Error("unknown session still reached the model")
+	}
+	if len(sessionMgr.List()) != 0 {
+		t.Error("unknown session was created")
+	}
+}
+
+func TestChatWithoutSession(t *testing.T) {
+	chatManager, sessionMgr, ollamaMgr, _ := newTestChatHandler(t)
+
+	messages := []types.Message{
+		{SzRole: "user", SzContent: "How do I bake bread?"},
+		{SzRole: "assistant", SzContent: "Knead it."},
+		{SzRole: "user", SzContent: "And rye?"},
+	}
+	recorder := postChat(chatManager, ChatRequest{MessageList: messages})
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	if len(ollamaMgr.turnsList) != 1 || len(ollamaMgr.turnsList[0]) != len(messages) {
+		t.Errorf("model got %+v, want the client's conversation", ollamaMgr.turnsList)
+	}
+	if len(sessionMgr.List()) != 0 {
+		t.Error("a session was stored for a request without session_id")
+	}
+	if strings.Contains(recorder.Body.String(), "session_id") {
+		t.Errorf("response carries a session id: %s", recorder.Body.String())
+	}
+}
+
+func TestSessionEndpoints(t *testing.T) {
+	sessionMgr := session.NewSessionManager(t.TempDir())
+	sessHandler := NewSessionHandler(func() session.SessionInterface { return sessionMgr })
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/sessions", sessHandler.HandleSessions)
+	mux.HandleFunc("/sessions/{id}", sessHandler.HandleSession)
+
+	serve := func(szMethod string, szPath string, szBody string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, httptest.NewRequest(szMethod, szPath, strings.NewReader(szBody)))
+		return recorder
+	}
+
+	recorder := serve(http.MethodPost, "/sessions", `{"title": "bread"}`)
+	if recorder.Code != http.StatusCreated {
+		t.Fatalf("create: status %d", recorder.Code)
+	}
+	var created session.Session
+	if err := json.Unmarshal(recorder.Body.Bytes(), &created); err != nil || created.SzTitle != "bread" {
+		t.Fatalf("create returned %s (%v)", recorder.Body.String(), err)
+	}
+
+	if recorder := serve(http.MethodPatch, "/sessions/"+created.SzID, `{"title": "rye"}`); recorder.Code != http.StatusOK || !strings.Contains(recorder.Body.String(), `"title":"rye"`) {
+		t.Errorf("rename: status %d: %s", recorder.Code, recorder.Body.String())
+	}
+	if recorder := serve(http.MethodGet, "/sessions", ""); !strings.Contains(recorder.Body.String(), created.SzID) {
+		t.Errorf("list does not contain %s: %s", created.SzID, recorder.Body.String())
+	}
+	if recorder := serve(http.MethodDelete, "/sessions/"+created.SzID, ""); recorder.Code != http.StatusNoContent {
+		t.Errorf("delete: status %d", recorder.Code)
+	}
+
+	for _, szMethod := range []string{http.MethodGet, http.MethodDelete} {
+		if recorder := serve(szMethod, "/sessions/"+created.SzID, ""); recorder.Code != http.StatusNotFound {
+			t.Errorf("%s of a deleted session: status %d, want %d", szMethod, recorder.Code, http.StatusNotFound)
+		}
+	}
+	if recorder := serve(http.MethodPatch, "/sessions/sess_missing", `{"title": "x"}`); recorder.Code != http.StatusNotFound {
+		t.Errorf("rename of an unknown session: status %d, want %d", recorder.Code, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,210 @@
+package handler
+
+import (
+	"chak-server/internal/memory"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	DefaultMemoryPageSize = 50
+	MaxMemoryPageSize = 500
+	DefaultMemorySearchTopK = 10
+)
+
+// MemoryHandler lets users browse, search, correct and delete the memories
+// of the active profile. The memory manager is looked up on every request
+// because switching profiles replaces it.
+type MemoryHandler struct {
+	getMemory func() memory.MemoryInterface
+}
+
+// MemoryView is a memory as the API shows it, without its vector.
+type MemoryView struct {
+	ID string `json:"id"`
+	Content string `json:"content"`
+	Metadata map[string]string `json:"metadata"`
+	Score *float64 `json:"score,omitempty"`
+}
+
+type MemoryListResponse struct {
+	Total int `json:"total"`
+	Offset int `json:"offset"`
+	Limit int `json:"limit"`
+	Memories []MemoryView `json:"memories"`
+}
+
+type MemorySearchRequest struct {
+	SzQuery string `json:"query"`
+	InTopK int `json:"top_k"`
+	FilterMap map[string]string `json:"filter"`
+}
+
+type MemoryUpdateRequest struct {
+	SzContent string `json:"content"`
+}
+
+func NewMemoryHandler(getMemory func() memory.MemoryInterface) *MemoryHandler {
+	return &MemoryHandler{
+		getMemory: getMemory,
+	}
+}
+
+// HandleMemories pages through the memories on GET and deletes them on
+// DELETE. Query parameters other than offset and limit filter on metadata,
+// e.g. ?type=conversation&role=assistant; deleting requires at least one.
+func (memHandler *MemoryHandler) HandleMemories(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filterMap := make(map[string]string)
+	for szKey, values := range query {
+		if szKey != "offset" && szKey != "limit" && len(values) > 0 {
+			filterMap[szKey] = values[0]
+		}
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		inOffset, err := queryInt(query.Get("offset"), 0)
+		if err != nil || inOffset < 0 {
+			http.Error(w, "Invalid offset", http.StatusBadRequest)
+			return
+		}
+		inLimit, err := queryInt(query.Get("limit"), DefaultMemoryPageSize)
+		if err != nil || inLimit <= 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		inLimit = min(inLimit, MaxMemoryPageSize)
+
+		memories, inTotal := memHandler.getMemory().ListMemories(filterMap, inOffset, inLimit)
+		writeJSON(w, http.StatusOK, MemoryListResponse{
+			Total: inTotal,
+			Offset: inOffset,
+			Limit: inLimit,
+			Memories: memoryViews(memories, false),
+		})
+	case http.MethodDelete:
+		if len(filterMap) == 0 {
+			http.Error(w, "At least one metadata filter is required", http.StatusBadRequest)
+			return
+		}
+
+		inDeleted, err := memHandler.getMemory().DeleteMemoriesByFilter(filterMap)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"deleted": inDeleted,
+		})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// HandleSearch runs a semantic search over the memories and returns them
+// with their retrieval scores.
+func (memHandler *MemoryHandler) HandleSearch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req MemorySearchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.SzQuery) == "" {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	if req.InTopK <= 0 {
+		req.InTopK = DefaultMemorySearchTopK
+	}
+	req.InTopK = min(req.InTopK, MaxMemoryPageSize)
+
+	memories, err := memHandler.getMemory().SearchMemories(r.Context(), req.SzQuery, req.InTopK, req.FilterMap)
+	if err != nil {
+		http.Error(w, "Embedding error", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, memoryViews(memories, true))
+}
+
+// HandleMemory fetches one memory on GET, replaces its content on PUT or
+// PATCH with {"content": ...}, embedding it again, and deletes it on
+// DELETE.
+func (memHandler *MemoryHandler) HandleMemory(w http.ResponseWriter, r *http.Request) {
+	szID := r.PathValue("id")
+	memoryMgr := memHandler.getMemory()
+
+	switch r.Method {
+	case http.MethodGet:
+		found, err := memoryMgr.GetMemory(szID)
+		if err != nil {
+			writeMemoryError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, newMemoryView(found, false))
+	case http.MethodPut, http.MethodPatch:
+		var req MemoryUpdateRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.SzContent) == "" {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+
+		updated, err := memoryMgr.UpdateMemory(r.Context(), szID, req.SzContent)
+		if err != nil {
+			writeMemoryError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, newMemoryView(updated, false))
+	case http.MethodDelete:
+		if err := memoryMgr.DeleteMemory(szID); err != nil {
+			writeMemoryError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func newMemoryView(mem memory.MemoryEntry, bScore bool) MemoryView {
+	view := MemoryView{
+		ID: mem.SzId,
+		Content: mem.SzContent,
+		Metadata: mem.MetadataMap,
+	}
+	if view.Metadata == nil {
+		view.Metadata = map[string]string{}
+	}
+	if bScore {
+		flScore := mem.FlScore
+		view.Score = &flScore
+	}
+	return view
+}
+
+func memoryViews(memories []memory.MemoryEntry, bScore bool) []MemoryView {
+	views := make([]MemoryView, 0, len(memories))
+	for _, mem := range memories {
+		views = append(views, newMemoryView(mem, bScore))
+	}
+	return views
+}
+
+func writeMemoryError(w http.ResponseWriter, err error) {
+	if errors.Is(err, memory.ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
+
+func queryInt(szValue string, inDefault int) (int, error) {
+	if szValue == "" {
+		return inDefault, nil
+	}
+	return strconv.Atoi(szValue)
+}
@@ -0,0 +1,102 @@
+package handler
+
+import (
+	"chak-server/internal/session"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// SessionHandler serves the conversation endpoints. Sessions belong to a
+// profile, so the manager is looked up on every request.
+type SessionHandler struct {
+	getSessions func() session.SessionInterface
+}
+
+type SessionRequest struct {
+	SzTitle string `json:"title"`
+}
+
+func NewSessionHandler(getSessions func() session.SessionInterface) *SessionHandler {
+	return &SessionHandler{
+		getSessions: getSessions,
+	}
+}
+
+// HandleSessions lists the sessions on GET and creates one on POST, with
+// an optional {"title": ...}.
+func (sessHandler *SessionHandler) HandleSessions(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, sessHandler.getSessions().List())
+	case http.MethodPost:
+		var req SessionRequest
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "Invalid request", http.StatusBadRequest)
+				return
+			}
+		}
+
+		created, err := sessHandler.getSessions().Create(req.SzTitle)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusCreated, created)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// HandleSession fetches a session with its messages on GET, renames it on
+// PATCH with {"title": ...} and deletes it on DELETE.
+func (sessHandler *SessionHandler) HandleSession(w http.ResponseWriter, r *http.Request) {
+	szID := r.PathValue("id")
+	sessions := sessHandler.getSessions()
+
+	switch r.Method {
+	case http.MethodGet:
+		found, err := sessions.Get(szID)
+		if err != nil {
+			writeSessionError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, found)
+	case http.MethodPatch:
+		var req SessionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+
+		renamed, err := sessions.Rename(szID, req.SzTitle)
+		if err != nil {
+			writeSessionError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, renamed)
+	case http.MethodDelete:
+		if err := sessions.Delete(szID); err != nil {
+			writeSessionError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func writeSessionError(w http.ResponseWriter, err error) {
+	if errors.Is(err, session.ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
+
+func writeJSON(w http.ResponseWriter, inStatus int, payload interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(inStatus)
+	json.NewEncoder(w).Encode(payload)
+}
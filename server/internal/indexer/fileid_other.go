@@ -0,0 +1,21 @@
+//go:build !unix
+
+package indexer
+
+import (
+	"os"
+	"path/filepath"
+)
+
+func deviceOf(info os.FileInfo) (uint64, bool) {
+	return 0, false
+}
+
+// fileKey identifies a file by its resolved path where inodes are not
+// available.
+func fileKey(szPath string, info os.FileInfo) string {
+	if szResolved, err := filepath.EvalSymlinks(szPath); err == nil {
+		return szResolved
+	}
+	return szPath
+}
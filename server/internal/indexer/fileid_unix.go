@@ -0,0 +1,27 @@
+//go:build unix
+
+package indexer
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+func deviceOf(info os.FileInfo) (uint64, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return uint64(stat.Dev), true
+}
+
+// fileKey identifies a file by device and inode, so a directory reached
+// through several links is recognised.
+func fileKey(szPath string, info os.FileInfo) string {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return szPath
+	}
+	return fmt.Sprintf("%d:%d", uint64(stat.Dev), uint64(stat.Ino))
+}
@@ -0,0 +1,138 @@
+package indexer
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/binary"
+	"hash"
+	"math/bits"
+)
+
+const (
+	HashMD5 = "md5"
+	HashSHA256 = "sha256"
+	HashXXHash64 = "xxhash64"
+)
+
+// newHasher returns the hash constructor for an algorithm name, or false
+// when the name is unknown.
+func newHasher(szAlgorithm string) (func() hash.Hash, bool) {
+	switch szAlgorithm {
+	case HashMD5:
+		return md5.New, true
+	case HashSHA256:
+		return sha256.New, true
+	case HashXXHash64:
+		return func() hash.Hash { return newXXHash64() }, true
+	}
+	return nil, false
+}
+
+const (
+	xxPrime1 uint64 = 11400714785074694791
+	xxPrime2 uint64 = 14029467366897019727
+	xxPrime3 uint64 = 1609587929392839161
+	xxPrime4 uint64 = 9650029242287828579
+	xxPrime5 uint64 = 2870177450012600261
+)
+
+// xxHash64 is the 64-bit xxHash with seed 0. It is not cryptographic, but
+// several times faster than MD5 on large files.
+type xxHash64 struct {
+	acc [4]uint64
+	buffer [32]byte
+	inBuffered int
+	inTotal uint64
+}
+
+func newXXHash64() *xxHash64 {
+	digest := &xxHash64{}
+	digest.Reset()
+	return digest
+}
+
+func (digest *xxHash64) Reset() {
+	var seed uint64
+	digest.acc = [4]uint64{seed + xxPrime1 + xxPrime2, seed + xxPrime2, seed, seed - xxPrime1}
+	digest.inBuffered = 0
+	digest.inTotal = 0
+}
+
+func (digest *xxHash64) Size() int { return 8 }
+
+func (digest *xxHash64) BlockSize() int { return 32 }
+
+func (digest *xxHash64) Write(data []byte) (int, error) {
+	inLen := len(data)
+	digest.inTotal += uint64(inLen)
+
+	if digest.inBuffered > 0 {
+		inCopied := copy(digest.buffer[digest.inBuffered:], data)
+		digest.inBuffered += inCopied
+		data = data[inCopied:]
+		if digest.inBuffered < 32 {
+			return inLen, nil
+		}
+		digest.stripe(digest.buffer[:])
+		digest.inBuffered = 0
+	}
+
+	for ; len(data) >= 32; data = data[32:] {
+		digest.stripe(data)
+	}
+
+	digest.inBuffered = copy(digest.buffer[:], data)
+	return inLen, nil
+}
+
+func (digest *xxHash64) stripe(data []byte) {
+	for i := range digest.acc {
+		digest.acc[i] = xxRound(digest.acc[i], binary.LittleEndian.Uint64(data[i*8:]))
+	}
+}
+
+func (digest *xxHash64) Sum64() uint64 {
+	var h uint64
+	if digest.inTotal >= 32 {
+		h = bits.RotateLeft64(digest.acc[0], 1) + bits.RotateLeft64(digest.acc[1], 7) +
+			bits.RotateLeft64(digest.acc[2], 12) + bits.RotateLeft64(digest.acc[3], 18)
+		for _, acc := range digest.acc {
+			h = (h^xxRound(0, acc))*xxPrime1 + xxPrime4
+		}
+	} else {
+		h = xxPrime5
+	}
+	h += digest.inTotal
+
+	data := digest.buffer[:digest.inBuffered]
+	for ; len(data) >= 8; data = data[8:] {
+		h ^= xxRound(0, binary.LittleEndian.Uint64(data))
+		h = bits.RotateLeft64(h, 27)*xxPrime1 + xxPrime4
+	}
+	if len(data) >= 4 {
+		h ^= uint64(binary.LittleEndian.Uint32(data)) * xxPrime1
+		h = bits.RotateLeft64(h, 23)*xxPrime2 + xxPrime3
+		data = data[4:]
+	}
+	for _, b := range data {
+		h ^= uint64(b) * xxPrime5
+		h = bits.RotateLeft64(h, 11) * xxPrime1
+	}
+
+	h ^= h >> 33
+	h *= xxPrime2
+	h ^= h >> 29
+	h *= xxPrime3
+	h ^= h >> 32
+	return h
+}
+
+func (digest *xxHash64) Sum(data []byte) []byte {
+	return binary.BigEndian.AppendUint64(data, digest.Sum64())
+}
+
+func xxRound(acc uint64, input uint64) uint64 {
+	acc += input * xxPrime2
+	acc = bits.RotateLeft64(acc, 31)
+	return acc * xxPrime1
+}
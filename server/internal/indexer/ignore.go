@@ -0,0 +1,188 @@
+package indexer
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// ignoreFileNames are read in every scanned directory, in this order, so
+// .chakignore can re-include what .gitignore excludes.
+var ignoreFileNames = []string{".gitignore", ".chakignore"}
+
+func isIgnoreFile(szPath string) bool {
+	szName := filepath.Base(szPath)
+	for _, szIgnoreName := range ignoreFileNames {
+		if szName == szIgnoreName {
+			return true
+		}
+	}
+	return false
+}
+
+type ignorePattern struct {
+	regex *regexp.Regexp
+	bNegate bool
+	bDirOnly bool
+}
+
+// ignoreRules are the patterns of one ignore file, or of a profile's
+// exclude list, matched against paths relative to szBase.
+type ignoreRules struct {
+	szBase string
+	patterns []ignorePattern
+}
+
+// compileIgnorePatterns parses lines with gitignore syntax: "#" comments,
+// "!" negation, a trailing "/" for directories only, a leading or inner
+// "/" anchoring the pattern to the base, and "*", "?", "[...]" and "**"
+// wildcards. Invalid lines are skipped.
+func compileIgnorePatterns(lines []string) []ignorePattern {
+	var patterns []ignorePattern
+	for _, szLine := range lines {
+		if pattern, ok := compileIgnorePattern(szLine); ok {
+			patterns = append(patterns, pattern)
+		}
+	}
+	return patterns
+}
+
+func compileIgnorePattern(szLine string) (ignorePattern, bool) {
+	var pattern ignorePattern
+
+	szLine = strings.TrimSuffix(szLine, "\r")
+	for strings.HasSuffix(szLine, " ") && !strings.HasSuffix(szLine, "\\ ") {
+		szLine = szLine[:len(szLine)-1]
+	}
+	if szLine == "" || strings.HasPrefix(szLine, "#") {
+		return pattern, false
+	}
+
+	if strings.HasPrefix(szLine, "!") {
+		pattern.bNegate = true
+		szLine = szLine[1:]
+	} else if strings.HasPrefix(szLine, "\\!") || strings.HasPrefix(szLine, "\\#") {
+		szLine = szLine[1:]
+	}
+
+	if strings.HasSuffix(szLine, "/") {
+		pattern.bDirOnly = true
+		szLine = strings.TrimRight(szLine, "/")
+	}
+	if szLine == "" {
+		return pattern, false
+	}
+
+	// A slash anywhere but the end ties the pattern to the base directory;
+	// without one it matches a name at any depth.
+	szPrefix := "(?:.*/)?"
+	if strings.Contains(szLine, "/") {
+		szPrefix = ""
+		szLine = strings.TrimPrefix(szLine, "/")
+	}
+
+	regex, err := regexp.Compile("^" + szPrefix + globToRegex(szLine) + "$")
+	if err != nil {
+		return pattern, false
+	}
+	pattern.regex = regex
+
+	return pattern, true
+}
+
+func globToRegex(szGlob string) string {
+	var sbRegex strings.Builder
+
+	for i := 0; i < len(szGlob); i++ {
+		c := szGlob[i]
+		switch {
+		case c == '*' && strings.HasPrefix(szGlob[i:], "**") && (i == 0 || szGlob[i-1] == '/'):
+			bSegmentEnd := i+2 == len(szGlob) || szGlob[i+2] == '/'
+			switch {
+			case bSegmentEnd && i+2 == len(szGlob):
+				sbRegex.WriteString(".*")
+				i++
+			case bSegmentEnd:
+				sbRegex.WriteString("(?:.*/)?")
+				i += 2
+			default:
+				sbRegex.WriteString("[^/]*")
+				i++
+			}
+		case c == '*':
+			sbRegex.WriteString("[^/]*")
+		case c == '?':
+			sbRegex.WriteString("[^/]")
+		case c == '[':
+			inEnd := strings.IndexByte(szGlob[i+1:], ']')
+			if inEnd < 0 {
+				sbRegex.WriteString(`\[`)
+				continue
+			}
+			szClass := szGlob[i+1 : i+1+inEnd]
+			if strings.HasPrefix(szClass, "!") {
+				szClass = "^" + szClass[1:]
+			}
+			sbRegex.WriteString("[" + strings.ReplaceAll(szClass, `\`, `\\`) + "]")
+			i += inEnd + 1
+		case c == '\\' && i+1 < len(szGlob):
+			i++
+			sbRegex.WriteString(regexp.QuoteMeta(string(szGlob[i])))
+		default:
+			sbRegex.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	return sbRegex.String()
+}
+
+// match reports whether any pattern applies to the path and, if so,
+// whether the last one that does ignores it.
+func (rules ignoreRules) match(szPath string, bDir bool) (bool, bool) {
+	szRel, err := filepath.Rel(rules.szBase, szPath)
+	if err != nil || szRel == "." || strings.HasPrefix(szRel, "..") {
+		return false, false
+	}
+	szRel = filepath.ToSlash(szRel)
+
+	bMatched, bIgnored := false, false
+	for _, pattern := range rules.patterns {
+		if pattern.bDirOnly && !bDir {
+			continue
+		}
+		if pattern.regex.MatchString(szRel) {
+			bMatched = true
+			bIgnored = !pattern.bNegate
+		}
+	}
+	return bMatched, bIgnored
+}
+
+// isIgnored applies rule sets from the outermost to the innermost
+// directory; the last matching pattern decides, as in git.
+func isIgnored(ruleSets []ignoreRules, szPath string, bDir bool) bool {
+	bIgnored := false
+	for _, rules := range ruleSets {
+		if bMatched, bRuleIgnored := rules.match(szPath, bDir); bMatched {
+			bIgnored = bRuleIgnored
+		}
+	}
+	return bIgnored
+}
+
+// readIgnoreRules loads the ignore files of one directory.
+func readIgnoreRules(szDir string) []ignoreRules {
+	var ruleSets []ignoreRules
+	for _, szName := range ignoreFileNames {
+		data, err := os.ReadFile(filepath.Join(szDir, szName))
+		if err != nil {
+			continue
+		}
+		patterns := compileIgnorePatterns(strings.Split(string(data), "\n"))
+		if len(patterns) > 0 {
+			ruleSets = append(ruleSets, ignoreRules{szBase: szDir, patterns: patterns})
+		}
+	}
+	return ruleSets
+}
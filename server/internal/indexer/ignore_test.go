@@ -0,0 +1,190 @@
+package indexer
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// writeTree creates the files of fileMap, keyed by slash separated paths
+// relative to the returned directory.
+func writeTree(t *testing.T, fileMap map[string]string) string {
+	t.Helper()
+
+	szRoot := t.TempDir()
+	for szRel, szContent := range fileMap {
+		szPath := filepath.Join(szRoot, filepath.FromSlash(szRel))
+		if err := os.MkdirAll(filepath.Dir(szPath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(szPath, []byte(szContent), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return szRoot
+}
+
+func scannedPaths(t *testing.T, scanner *DirectoryScanner, szRoot string) []string {
+	t.Helper()
+
+	files, err := scanner.ScanDirectories()
+	if err != nil {
+		t.Fatalf("ScanDirectories: %v", err)
+	}
+
+	paths := make([]string, len(files))
+	for i, file := range files {
+		szRel, err := filepath.Rel(szRoot, file.SzPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		paths[i] = filepath.ToSlash(szRel)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func TestIgnorePatternMatch(t *testing.T) {
+	tests := []struct {
+		szName string
+		patterns []string
+		szRel string
+		bDir bool
+		bWantIgnored bool
+	}{
+		{szName: "unanchored name at top", patterns: []string{"*.log"}, szRel: "app.log", bWantIgnored: true},
+		{szName: "unanchored name nested", patterns: []string{"*.log"}, szRel: "a/b/app.log", bWantIgnored: true},
+		{szName: "wildcard stays in segment", patterns: []string{"*.log"}, szRel: "app.log/readme.txt", bWantIgnored: false},
+		{szName: "leading slash anchors", patterns: []string{"/build"}, szRel: "build", bDir: true, bWantIgnored: true},
+		{szName: "leading slash not nested", patterns: []string{"/build"}, szRel: "src/build", bDir: true, bWantIgnored: false},
+		{szName: "inner slash anchors", patterns: []string{"docs/*.md"}, szRel: "docs/a.md", bWantIgnored: true},
+		{szName: "inner slash not nested", patterns: []string{"docs/*.md"}, szRel: "src/docs/a.md", bWantIgnored: false},
+		{szName: "double star at any depth", patterns: []string{"**/cache"}, szRel: "a/b/cache", bDir: true, bWantIgnored: true},
+		{szName: "double star below dir", patterns: []string{"logs/**"}, szRel: "logs/a/b.txt", bWantIgnored: true},
+		{szName: "dir pattern matches dir", patterns: []string{"tmp/"}, szRel: "src/tmp", bDir: true, bWantIgnored: true},
+		{szName: "dir pattern skips file", patterns: []string{"tmp/"}, szRel: "src/tmp", bDir: false, bWantIgnored: false},
+		{szName: "negation re-includes", patterns: []string{"*.log", "!keep.log"}, szRel: "keep.log", bWantIgnored: false},
+		{szName: "last pattern wins", patterns: []string{"!keep.log", "*.log"}, szRel: "keep.log", bWantIgnored: true},
+		{szName: "comment and escaped hash", patterns: []string{"# notes", `\#notes`}, szRel: "#notes", bWantIgnored: true},
+		{szName: "character class", patterns: []string{"file[0-9].txt"}, szRel: "file7.txt", bWantIgnored: true},
+		{szName: "negated character class", patterns: []string{"file[!0-9].txt"}, szRel: "file7.txt", bWantIgnored: false},
+	}
+
+	szBase := filepath.FromSlash("/base")
+	for _, tt := range tests {
+		t.Run(tt.szName, func(t *testing.T) {
+			rules := ignoreRules{szBase: szBase, patterns: compileIgnorePatterns(tt.patterns)}
+			szPath := filepath.Join(szBase, filepath.FromSlash(tt.szRel))
+			if bIgnored := isIgnored([]ignoreRules{rules}, szPath, tt.bDir); bIgnored != tt.bWantIgnored {
+				t.Errorf("isIgnored(%q) = %v, want %v", tt.szRel, bIgnored, tt.bWantIgnored)
+			}
+		})
+	}
+}
+
+func TestScannerIgnoreFiles(t *testing.T) {
+	szRoot := writeTree(t, map[string]string{
+		".gitignore": "*.log\nbuild/\n/secret.txt\ndraft.md\n",
+		".chakignore": "!important.log\n",
+		"a.txt": "a",
+		"a.log": "a",
+		"important.log": "a",
+		"secret.txt": "a",
+		"draft.md": "a",
+		"build/out.txt": "a",
+		"sub/.chakignore": "!debug.log\n!draft.md\nnotes.txt\n",
+		"sub/secret.txt": "a",
+		"sub/debug.log": "a",
+		"sub/other.log": "a",
+		"sub/notes.txt": "a",
+		"sub/draft.md": "a",
+		"sub/build": "a file, not a directory",
+		"sub/deeper/notes.txt": "a",
+		"sub/deeper/debug.log": "a",
+	})
+
+	// Without an extension filter the ignore files would be indexed too;
+	// "" keeps the extensionless sub/build.
+	scanner := NewDirectoryScanner([]string{szRoot}, []string{".txt", ".log", ".md", ""}, 1<<20, "", ScanOptions{})
+	paths := scannedPaths(t, scanner, szRoot)
+
+	wantPaths := []string{
+		"a.txt",
+		"important.log",
+		"sub/build",
+		"sub/debug.log",
+		"sub/deeper/debug.log",
+		"sub/draft.md",
+		"sub/secret.txt",
+	}
+	if strings.Join(paths, ",") != strings.Join(wantPaths, ",") {
+		t.Errorf("scanned\n%v\nwant\n%v", paths, wantPaths)
+	}
+
+	// Watcher events are checked one path at a time and must agree with
+	// the walk.
+	for _, tt := range []struct {
+		szRel string
+		bDir bool
+		bWantIgnored bool
+	}{
+		{szRel: "build", bDir: true, bWantIgnored: true},
+		{szRel: "build/new.txt", bWantIgnored: true},
+		{szRel: "a.log", bWantIgnored: true},
+		{szRel: "important.log", bWantIgnored: false},
+		{szRel: "sub/debug.log", bWantIgnored: false},
+		{szRel: "sub/deeper/notes.txt", bWantIgnored: true},
+		{szRel: "sub/draft.md", bWantIgnored: false},
+		{szRel: "draft.md", bWantIgnored: true},
+	} {
+		szPath := filepath.Join(szRoot, filepath.FromSlash(tt.szRel))
+		if bIgnored := scanner.IsIgnored(szPath, tt.bDir); bIgnored != tt.bWantIgnored {
+			t.Errorf("IsIgnored(%q) = %v, want %v", tt.szRel, bIgnored, tt.bWantIgnored)
+		}
+	}
+}
+
+func TestScannerIncludeExclude(t *testing.T) {
+	szRoot := writeTree(t, map[string]string{
+		"readme.md": "a",
+		"docs/a.md": "a",
+		"docs/b.tmp": "a",
+		"docs/private.md": "a",
+		"docs/guide/c.md": "a",
+		"src/docs/d.md": "a",
+		".chakignore": "docs/guide/\n",
+	})
+
+	scanner := NewDirectoryScanner([]string{szRoot}, nil, 1<<20, "", ScanOptions{
+		Include: []string{"docs/**", "!docs/private.md"},
+		Exclude: []string{"*.tmp"},
+	})
+	paths := scannedPaths(t, scanner, szRoot)
+
+	wantPaths := []string{"docs/a.md"}
+	if strings.Join(paths, ",") != strings.Join(wantPaths, ",") {
+		t.Errorf("scanned %v, want %v", paths, wantPaths)
+	}
+
+	// A single changed file goes through the same filters.
+	for _, tt := range []struct {
+		szRel string
+		inWant int
+	}{
+		{szRel: "docs/a.md", inWant: 1},
+		{szRel: "docs/private.md", inWant: 0},
+		{szRel: "docs/b.tmp", inWant: 0},
+		{szRel: "docs/guide/c.md", inWant: 0},
+		{szRel: "readme.md", inWant: 0},
+	} {
+		files, err := scanner.ScanPath(filepath.Join(szRoot, filepath.FromSlash(tt.szRel)))
+		if err != nil {
+			t.Fatalf("ScanPath(%q): %v", tt.szRel, err)
+		}
+		if len(files) != tt.inWant {
+			t.Errorf("ScanPath(%q) returned %d files, want %d", tt.szRel, len(files), tt.inWant)
+		}
+	}
+}
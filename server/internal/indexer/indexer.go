@@ -8,13 +8,23 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type IndexedFile struct {
 	SzPath string `json:"path"`
 	SzHash string `json:"hash"`
-	TmIndexedTime time.Time `json:"indexed_at`
+	InSize int64 `json:"size"`
+	TmModTime time.Time `json:"mod_time"`
+	TmIndexedTime time.Time `json:"indexed_at"`
+	SzEmbedModel string `json:"embed_model,omitempty"`
+	InEmbedDim int `json:"embed_dim,omitempty"`
+	SzChunker string `json:"chunker,omitempty"`
 }
 
 type IndexerManager struct {
@@ -22,54 +32,53 @@ type IndexerManager struct {
 	memoryMgr memory.MemoryInterface
 	indexedFilesMap map[string]IndexedFile
 	szIndexFilePath string
+	chunkOptions document.ChunkOptions
+	indexOptions IndexOptions
+	szEmbedModel string
+	szChunker string
 	ticker *time.Ticker
 	stopChan chan struct{}
+	mu sync.Mutex
+	filesMu sync.Mutex
+	status runStatus
+	statusMu sync.Mutex
+	bRebuildPending atomic.Bool
 }
 
-func NewIndexerManager(scannerMgr ScannerInterface, memoryMgr memory.MemoryInterface, szIndexFile string) *IndexerManager {
+func NewIndexerManager(scannerMgr ScannerInterface, memoryMgr memory.MemoryInterface, szIndexFile string, chunkOptions document.ChunkOptions, indexOptions IndexOptions) *IndexerManager {
 	idxMgr := &IndexerManager{
 		scannerMgr: scannerMgr,
 		memoryMgr: memoryMgr,
 		indexedFilesMap: make(map[string]IndexedFile),
 		szIndexFilePath: szIndexFile,
+		chunkOptions: chunkOptions,
+		indexOptions: indexOptions,
+		szEmbedModel: memoryMgr.EmbeddingModel(),
+		szChunker: chunkOptions.Version(),
 		stopChan: make(chan struct{}),
+		status: runStatus{errorMap: make(map[string]FileError)},
 	}
 
 	idxMgr.loadIndexState()
+	idxMgr.status.inIndexedFiles = len(idxMgr.indexedFilesMap)
 
 	return idxMgr
 }
 
-func (idxMgr *IndexerManager) StartWatcher(tmInterval time.Duration) {
-	idxMgr.ticker = time.NewTicker(tmInterval)
-
-	go func() {
-		for {
-			select {
-			case <-idxMgr.ticker.C:
-				log.Printf("Auto indexing check...")
-				if err := idxMgr.IndexAll(); err != nil {
-					log.Printf("Auto indexing error: %v \n", err)
-				}
-			case <-idxMgr.stopChan:
-				log.Println("Stopping indexer watcher.")
-				return
-			}
-		}
-	}()
-
-	log.Printf("Watcher watching every %v\n", tmInterval)
+func (idxMgr *IndexerManager) IndexAll() error {
+	return idxMgr.indexAll(RunFull)
 }
 
-func (idxMgr *IndexerManager) StopWatcher() {
-	if idxMgr.ticker != nil {
-		idxMgr.ticker.Stop()
-		close(idxMgr.stopChan)
-		log.Println("Indexer watcher stopped")
-	}
-}
+// indexAll scans every directory; a RunRebuild re-indexes unchanged files
+// too.
+func (idxMgr *IndexerManager) indexAll(szRun string) error {
+	idxMgr.mu.Lock()
+	defer idxMgr.mu.Unlock()
+
+	idxMgr.beginRun(szRun)
+	bCompleted := false
+	defer func() { idxMgr.endRun(bCompleted) }()
 
-func (idxMgr *IndexerManager) IndexAll() error {
 	log.Println("Scanning files...")
 
 	files, err := idxMgr.scannerMgr.ScanDirectories()
@@ -82,54 +91,189 @@ func (idxMgr *IndexerManager) IndexAll() error {
 		existingPaths[file.SzPath] = true
 	}
 
+	// Files the scanner could not reach are kept until it can again.
+	scanErrors := idxMgr.scannerMgr.Errors()
+
 	var deletedPaths []string
 	for indexedPath := range idxMgr.indexedFilesMap {
-		if !existingPaths[indexedPath] {
+		if !existingPaths[indexedPath] && !isUnreachable(indexedPath, scanErrors) {
 			deletedPaths = append(deletedPaths, indexedPath)
 		}
 	}
 
 	for _, path := range deletedPaths {
-		log.Printf("Cleaning up deleted file %s", path)
-		if err := idxMgr.memoryMgr.DeleteMemoriesByMetadata("filepath", path); err != nil {
-			log.Printf("Failed to delete memory %s: %v \n", path, err)
-		}
-		delete(idxMgr.indexedFilesMap, path)
+		idxMgr.removeFile(path)
 	}
 
 	log.Printf("Found %d files\n", len(files))
+	if len(scanErrors) > 0 {
+		log.Printf("Could not scan %d paths, see /index/status\n", len(scanErrors))
+	}
 
 	if len(files) == 0 {
 		log.Println("No files to index")
+		bCompleted = true
 		return nil 
 	}
 
-	inIndexed := 0
-	inSkipped := 0
-
-	ctx := context.Background()
-
+	var pending []FileInfo
 	for _, file := range files {
-		if idxMgr.shouldIndex(file) {
-			if err := idxMgr.indexFile(ctx, file); err != nil {
-				log.Printf("Error indexing %s: %v", file.SzName, err)
-				continue
-			}
-			inIndexed++
-		} else {
-			inSkipped++
+		if idxMgr.shouldIndex(&file, szRun == RunRebuild) {
+			pending = append(pending, file)
 		}
 	}
 
+	inIndexed := idxMgr.indexFiles(context.Background(), pending)
+	inSkipped := len(files) - len(pending)
+
 	log.Printf("Indexed: %d files, Skipped: %d files (unchanged)\n", inIndexed, inSkipped)
 	
 	if err := idxMgr.saveIndexState(); err != nil {
 		log.Printf("Warning: Failed to save index state: %v\n", err)
+		return nil
 	}
 
+	bCompleted = true
 	return nil
 }
 
+// IndexPaths brings only the given files or directories up to date, as
+// reported by the watcher: new and changed files are indexed, and indexed
+// files at or under a path that is gone or no longer qualifies are removed.
+func (idxMgr *IndexerManager) IndexPaths(paths []string) error {
+	idxMgr.mu.Lock()
+	defer idxMgr.mu.Unlock()
+
+	idxMgr.beginRun(RunChanges)
+	defer idxMgr.endRun(true)
+
+	var pending []FileInfo
+	inRemoved := 0
+
+	for _, szPath := range paths {
+		// A changed ignore file can add or drop anything next to it.
+		if isIgnoreFile(szPath) {
+			szPath = filepath.Dir(szPath)
+		}
+
+		files, err := idxMgr.scannerMgr.ScanPath(szPath)
+		if err != nil {
+			log.Printf("Error scanning %s: %v\n", szPath, err)
+			continue
+		}
+
+		existingPaths := make(map[string]bool, len(files))
+		for _, file := range files {
+			existingPaths[file.SzPath] = true
+			if idxMgr.shouldIndex(&file, false) {
+				pending = append(pending, file)
+			}
+		}
+
+		scanErrors := idxMgr.scannerMgr.Errors()
+
+		var deletedPaths []string
+		for indexedPath := range idxMgr.indexedFilesMap {
+			if !existingPaths[indexedPath] && isWithinPath(indexedPath, szPath) && !isUnreachable(indexedPath, scanErrors) {
+				deletedPaths = append(deletedPaths, indexedPath)
+			}
+		}
+		sort.Strings(deletedPaths)
+
+		for _, path := range deletedPaths {
+			idxMgr.removeFile(path)
+			inRemoved++
+		}
+	}
+
+	inIndexed := idxMgr.indexFiles(context.Background(), pending)
+	if inIndexed == 0 && inRemoved == 0 {
+		return nil
+	}
+
+	log.Printf("Indexed: %d files, Removed: %d files\n", inIndexed, inRemoved)
+
+	if err := idxMgr.saveIndexState(); err != nil {
+		log.Printf("Warning: Failed to save index state: %v\n", err)
+	}
+
+	return nil
+}
+
+// indexFiles indexes the files on up to InWorkers goroutines and returns
+// how many succeeded.
+func (idxMgr *IndexerManager) indexFiles(ctx context.Context, files []FileInfo) int {
+	jobs := make(chan FileInfo)
+	var inIndexed atomic.Int64
+	var wg sync.WaitGroup
+
+	idxMgr.queueFiles(len(files))
+
+	for range min(idxMgr.indexOptions.workers(), len(files)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for file := range jobs {
+				idxMgr.startFile(file.SzPath)
+				err := idxMgr.indexFileRecovered(ctx, file)
+				idxMgr.finishFile(file.SzPath, err)
+				if err != nil {
+					log.Printf("Error indexing %s: %v", file.SzName, err)
+					continue
+				}
+				inIndexed.Add(1)
+			}
+		}()
+	}
+
+	for _, file := range files {
+		jobs <- file
+	}
+	close(jobs)
+	wg.Wait()
+
+	return int(inIndexed.Load())
+}
+
+// indexFileRecovered indexes one file and turns a panic in an extractor
+// into an error, so a malformed file cannot take the server down.
+func (idxMgr *IndexerManager) indexFileRecovered(ctx context.Context, file FileInfo) (err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("panic while indexing: %v", recovered)
+		}
+	}()
+
+	return idxMgr.indexFile(ctx, file)
+}
+
+func (idxMgr *IndexerManager) removeFile(szPath string) {
+	log.Printf("Cleaning up deleted file %s", szPath)
+	if err := idxMgr.memoryMgr.DeleteMemoriesByMetadata("filepath", szPath); err != nil {
+		log.Printf("Failed to delete memory %s: %v \n", szPath, err)
+	}
+	delete(idxMgr.indexedFilesMap, szPath)
+	idxMgr.forgetFile(szPath)
+}
+
+// isWithinPath reports whether szPath is szRoot itself or lies below it.
+func isWithinPath(szPath string, szRoot string) bool {
+	szPath = filepath.Clean(szPath)
+	szRoot = filepath.Clean(szRoot)
+	return szPath == szRoot || strings.HasPrefix(szPath, szRoot+string(filepath.Separator))
+}
+
+// isUnreachable reports whether szPath lies at or below a path the scanner
+// failed on.
+func isUnreachable(szPath string, scanErrors []FileError) bool {
+	for _, scanError := range scanErrors {
+		if isWithinPath(szPath, scanError.SzPath) {
+			return true
+		}
+	}
+	return false
+}
+
 func (idxMgr *IndexerManager) saveIndexState() error {
 	data, err := json.MarshalIndent(idxMgr.indexedFilesMap, "", "  ")
 	if err != nil {
@@ -151,23 +295,64 @@ func (idxMgr *IndexerManager) indexFile(ctx context.Context, file FileInfo) erro
 	if err != nil {
 		return fmt.Errorf("Failed to read file: %w", err)
 	}
+	log.Printf("    Read %d bytes from %s\n", len(content), file.SzName)
 
-	text := string(content)
-	log.Printf("    Read %d bytes from file\n", len(text))
+	segments, err := document.ExtractorFor(file.SzExtension).Extract(content)
+	if err != nil {
+		return fmt.Errorf("Failed to extract text: %w", err)
+	}
 
+	// Sections are saved together once the file is split, so chunks
+	// remember the position of their parent until its id is known.
+	var chunks []document.Segment
+	var parents []memory.MemoryEntry
+	var chunkParents []int
+	for _, segment := range segments {
+		sections := document.ParentSections(file.SzExtension, segment, idxMgr.chunkOptions)
+		if sections == nil {
+			for _, chunk := range document.ChunkSegment(file.SzExtension, segment, idxMgr.chunkOptions) {
+				chunks = append(chunks, chunk)
+				chunkParents = append(chunkParents, -1)
+			}
+			continue
+		}
 
-	chunks := document.ChunkText(text, 500)
-	log.Printf("     Chunked into %d pieces\n", len(chunks))
+		for _, section := range sections {
+			for _, chunk := range document.ChunkSegment(file.SzExtension, section, idxMgr.chunkOptions) {
+				chunks = append(chunks, chunk)
+				chunkParents = append(chunkParents, len(parents))
+			}
+			parents = append(parents, idxMgr.parentEntry(file, section, len(parents)))
+		}
+	}
+
+	inSections := len(parents)
+	if err := idxMgr.memoryMgr.SaveParentMemories(parents); err != nil {
+		return fmt.Errorf("Error saving %d sections: %w", inSections, err)
+	}
+	for i, inParent := range chunkParents {
+		if inParent < 0 {
+			continue
+		}
+		if chunks[i].MetadataMap == nil {
+			chunks[i].MetadataMap = make(map[string]string)
+		}
+		chunks[i].MetadataMap[memory.MetadataParentID] = parents[inParent].SzId
+	}
+	if inSections > 0 {
+		log.Printf("     Split %s into %d sections\n", file.SzName, inSections)
+	}
+	log.Printf("     Chunked %s into %d pieces\n", file.SzName, len(chunks))
 
 	if len(chunks) == 0 {
 		log.Printf("No chunks created")
 		return nil
 	}
 
+	entries := make([]memory.MemoryEntry, len(chunks))
 	for i, chunk := range chunks {
-		log.Printf("   💾 Saving chunk %d/%d (length: %d)\n", i+1, len(chunks), len(chunk))
 		metadata := map[string]string {
-			"type":         "document",
+			"type":         memory.TypeDocument,
 			"source":       "filesystem",
 			"filepath":     file.SzPath,
 			"filename":     file.SzName,
@@ -175,36 +360,73 @@ func (idxMgr *IndexerManager) indexFile(ctx context.Context, file FileInfo) erro
 			"chunk_id":     fmt.Sprintf("%d", i),
 			"total_chunks": fmt.Sprintf("%d", len(chunks)),
 			"indexed_at":   time.Now().Format(time.RFC3339),
+			"chunker":      idxMgr.szChunker,
+		}
+		for szKey, szValue := range chunk.MetadataMap {
+			metadata[szKey] = szValue
 		}
+		entries[i] = memory.MemoryEntry{SzContent: chunk.SzText, MetadataMap: metadata}
+	}
 
-		err := idxMgr.memoryMgr.SaveMemory(ctx, chunk, metadata)
-		if err != nil {
-			log.Printf("Error saving memory %d: %v\n", i, err)
-			return fmt.Errorf("Error saving memory %d: %w", i, err)
+	inBatchSize := idxMgr.indexOptions.batchSize()
+	for inStart := 0; inStart < len(entries); inStart += inBatchSize {
+		inEnd := min(inStart+inBatchSize, len(entries))
+		log.Printf("   💾 Saving chunks %d-%d/%d of %s\n", inStart+1, inEnd, len(entries), file.SzName)
+
+		if err := idxMgr.memoryMgr.SaveMemories(ctx, entries[inStart:inEnd]); err != nil {
+			log.Printf("Error saving chunks %d-%d of %s: %v\n", inStart+1, inEnd, file.SzName, err)
+			return fmt.Errorf("Error saving chunks %d-%d: %w", inStart+1, inEnd, err)
 		}
-		log.Println("Successfully saved memory")
 	}
 
+	idxMgr.filesMu.Lock()
+	defer idxMgr.filesMu.Unlock()
+
 	idxMgr.indexedFilesMap[file.SzPath] = IndexedFile{
 		SzPath: file.SzPath,
 		SzHash: file.SzHash,
+		InSize: file.InSize,
+		TmModTime: file.TmModTime,
 		TmIndexedTime: time.Now(),
+		SzEmbedModel: idxMgr.szEmbedModel,
+		InEmbedDim: len(entries[0].FlVector),
+		SzChunker: idxMgr.szChunker,
 	}
 	
 	return nil 
 }
 
-func (idxMgr *IndexerManager) shouldIndex(file FileInfo) bool {
+// shouldIndex compares a scanned file with its indexed state. Contents are
+// only hashed, filling in file.SzHash, when the size or modification time
+// changed or bForce is set; a file touched without changing keeps its
+// memories unless forced. Files indexed with another embedding model or
+// chunker are always redone.
+func (idxMgr *IndexerManager) shouldIndex(file *FileInfo, bForce bool) bool {
 	existing, exists := idxMgr.indexedFilesMap[file.SzPath]
+	if exists && idxMgr.isOutdated(existing) {
+		bForce = true
+	}
 
-	if !exists {
-		return true
+	if !bForce && exists && existing.InSize == file.InSize && existing.TmModTime.Equal(file.TmModTime) {
+		return false
+	}
+
+	szHash, err := idxMgr.scannerMgr.HashFile(file.SzPath)
+	if err != nil {
+		log.Printf("Failed to hash %s: %v\n", file.SzPath, err)
+		idxMgr.failFile(file.SzPath, err)
+		return false
 	}
+	file.SzHash = szHash
 
-	if existing.SzHash != file.SzHash {
+	if bForce || !exists || existing.SzHash != file.SzHash {
 		return true
 	}
 
+	existing.InSize = file.InSize
+	existing.TmModTime = file.TmModTime
+	idxMgr.indexedFilesMap[file.SzPath] = existing
+
 	return false
 }
 
@@ -223,7 +445,43 @@ func (idxMgr *IndexerManager) loadIndexState() error {
 	}
 
 	log.Printf("Index loaded: %d files were previously indexed.", len(idxMgr.indexedFilesMap))
+
+	inOutdated := 0
+	for _, indexedFile := range idxMgr.indexedFilesMap {
+		if idxMgr.isOutdated(indexedFile) {
+			inOutdated++
+		}
+	}
+	if inOutdated > 0 {
+		log.Printf("%d files were indexed with another embedding model or chunker and will be indexed again (now %s, chunker %s)\n", inOutdated, idxMgr.szEmbedModel, idxMgr.szChunker)
+	}
+
 	return nil
 }
 
+// isOutdated reports whether a file was indexed with another embedding
+// model or chunker than the current ones, or before they were recorded.
+func (idxMgr *IndexerManager) isOutdated(indexedFile IndexedFile) bool {
+	return indexedFile.SzEmbedModel != idxMgr.szEmbedModel || indexedFile.SzChunker != idxMgr.szChunker
+}
+
+// parentEntry builds the memory for a section that the chunks cut from it
+// link back to, so retrieval can return the whole section when one of them
+// matches.
+func (idxMgr *IndexerManager) parentEntry(file FileInfo, section document.Segment, inSection int) memory.MemoryEntry {
+	metadata := map[string]string {
+		"type":       memory.TypeDocumentParent,
+		"source":     "filesystem",
+		"filepath":   file.SzPath,
+		"filename":   file.SzName,
+		"extension":  file.SzExtension,
+		"section_id": fmt.Sprintf("%d", inSection),
+		"indexed_at": time.Now().Format(time.RFC3339),
+		"chunker":    idxMgr.szChunker,
+	}
+	for szKey, szValue := range section.MetadataMap {
+		metadata[szKey] = szValue
+	}
 
+	return memory.MemoryEntry{SzContent: section.SzText, MetadataMap: metadata}
+}
@@ -13,11 +13,35 @@ type FileInfo struct {
 
 type ScannerInterface interface {
 	ScanDirectories() ([]FileInfo, error)
+	ScanPath(szPath string) ([]FileInfo, error)
+	HashFile(szPath string) (string, error)
+	IsIgnored(szPath string, bDir bool) bool
+	Directories() []string
+	Errors() []FileError
 }
 
 type ManagerInterface interface {
 	IndexAll() error
-	StartWatcher(tmInterval time.Duration)
+	IndexPaths(paths []string) error
+	StartWatcher(tmFullScan time.Duration, tmDebounce time.Duration)
 	StopWatcher()
+	Status() IndexStatus
+	Rebuild(bForce bool) error
 }
 
+
+// IndexOptions sets how much indexing runs at once: up to InWorkers files
+// are read, chunked and embedded in parallel, and their chunks are embedded
+// InBatchSize per request. Values below 1 count as 1.
+type IndexOptions struct {
+	InWorkers int
+	InBatchSize int
+}
+
+func (options IndexOptions) workers() int {
+	return max(options.InWorkers, 1)
+}
+
+func (options IndexOptions) batchSize() int {
+	return max(options.InBatchSize, 1)
+}
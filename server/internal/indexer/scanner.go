@@ -1,26 +1,84 @@
 package indexer
 
 import (
-	"crypto/md5"
 	"fmt"
+	"hash"
 	"io"
+	"log"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 )
 
 
+// ScanOptions narrows down what a DirectoryScanner picks up. Include and
+// Exclude hold gitignore-style patterns relative to each watched
+// directory: Exclude works like a .chakignore at the top of every
+// directory, and when Include is set only files matching it are indexed.
+// Symlinks are skipped unless BFollowSymlinks is set, BSkipHidden leaves
+// out dotfiles and dot directories, and BOneFilesystem keeps the walk on
+// the device of the watched directory.
+type ScanOptions struct {
+	Include []string
+	Exclude []string
+	BFollowSymlinks bool
+	BSkipHidden bool
+	BOneFilesystem bool
+}
+
 type DirectoryScanner struct {
 	watchedDirs []string
 	allowedExts []string
 	maxFileSize int64
+	szHashAlgorithm string
+	newHash func() hash.Hash
+	includePatterns []ignorePattern
+	excludePatterns []ignorePattern
+	options ScanOptions
+	errorMap map[string]FileError
+	errorsMu sync.Mutex
+}
+
+// scanState is the bookkeeping of one walk below a watched directory.
+type scanState struct {
+	szRoot string
+	inRootDevice uint64
+	bRootDevice bool
+	visitedMap map[string]bool
+	files []FileInfo
 }
 
-func NewDirectoryScanner(dirs []string, exts []string, fileSize int64) *DirectoryScanner {
+// NewDirectoryScanner lists the files to index. Scans only stat files;
+// contents are hashed on demand with szHashAlgorithm (md5, sha256 or
+// xxhash64), falling back to MD5 for unknown names. Besides the profile's
+// patterns, .gitignore and .chakignore files are honoured while walking,
+// and ignored directories are never entered.
+func NewDirectoryScanner(dirs []string, exts []string, fileSize int64, szHashAlgorithm string, options ScanOptions) *DirectoryScanner {
+	szHashAlgorithm = strings.ToLower(szHashAlgorithm)
+	if szHashAlgorithm == "" {
+		szHashAlgorithm = HashMD5
+	}
+
+	newHash, ok := newHasher(szHashAlgorithm)
+	if !ok {
+		log.Printf("Unknown hash algorithm %q, using %s\n", szHashAlgorithm, HashMD5)
+		newHash, _ = newHasher(HashMD5)
+		szHashAlgorithm = HashMD5
+	}
+
 	return &DirectoryScanner{
 		watchedDirs: dirs,
 		allowedExts: exts,
 		maxFileSize: fileSize,
+		szHashAlgorithm: szHashAlgorithm,
+		newHash: newHash,
+		includePatterns: compileIgnorePatterns(options.Include),
+		excludePatterns: compileIgnorePatterns(options.Exclude),
+		options: options,
+		errorMap: make(map[string]FileError),
 	}
 }
 
@@ -28,45 +86,282 @@ func (dirMgr *DirectoryScanner) ScanDirectories() ([]FileInfo, error) {
 	var files []FileInfo
 
 	for _, dir := range dirMgr.watchedDirs {
-		err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
-			if err != nil {
-				return nil
-			}
+		if _, err := os.Stat(dir); err != nil {
+			dirMgr.clearErrors(dir)
+			dirMgr.addError(dir, err)
+			continue
+		}
 
-			if info.IsDir() {
-				return nil
-			}
+		dirFiles, err := dirMgr.ScanPath(dir)
+		if err != nil {
+			return nil, fmt.Errorf("Error scanning %s: %w", dir, err)
+		}
+		files = append(files, dirFiles...)
+	}
+	return files, nil
+}
 
-			if info.Size() > dirMgr.maxFileSize {
-				return nil
-			}
+func (dirMgr *DirectoryScanner) Directories() []string {
+	return dirMgr.watchedDirs
+}
+
+// ScanPath returns the indexable files at szPath, which is either a single
+// file or a directory to walk. A path that no longer exists or is ignored
+// has none. Problems met on the way replace the errors previously recorded
+// under szPath.
+func (dirMgr *DirectoryScanner) ScanPath(szPath string) ([]FileInfo, error) {
+	dirMgr.clearErrors(szPath)
+	szRoot := dirMgr.rootOf(szPath)
+
+	// Watched directories are always followed, even when they are links.
+	info, err := os.Lstat(szPath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			dirMgr.addError(szPath, err)
+		}
+		return nil, nil
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		if !dirMgr.options.BFollowSymlinks && filepath.Clean(szPath) != szRoot {
+			return nil, nil
+		}
+		if info, err = os.Stat(szPath); err != nil {
+			dirMgr.addError(szPath, err)
+			return nil, nil
+		}
+	}
+
+	_, ruleSets, bIgnored := dirMgr.rulesFor(szPath, info.IsDir())
+	if bIgnored {
+		return nil, nil
+	}
+
+	state := &scanState{szRoot: szRoot, visitedMap: make(map[string]bool)}
+	if rootInfo, err := os.Stat(szRoot); err == nil {
+		state.inRootDevice, state.bRootDevice = deviceOf(rootInfo)
+	}
+
+	// A link back to a directory above szPath is a cycle as well.
+	for szDir := filepath.Dir(szPath); isWithinPath(szDir, szRoot); szDir = filepath.Dir(szDir) {
+		if dirInfo, err := os.Stat(szDir); err == nil {
+			state.visitedMap[fileKey(szDir, dirInfo)] = true
+		}
+		if szDir == szRoot {
+			break
+		}
+	}
+
+	if info.IsDir() {
+		if dirMgr.enterDir(state, szPath, info) {
+			dirMgr.walk(state, szPath, ruleSets)
+		}
+	} else if info.Mode().IsRegular() {
+		if file, ok := dirMgr.fileInfo(szRoot, szPath, info); ok {
+			state.files = append(state.files, file)
+		}
+	}
+	return state.files, nil
+}
+
+// Errors returns the problems the scanner ran into, such as unreadable
+// directories or broken links, sorted by path.
+func (dirMgr *DirectoryScanner) Errors() []FileError {
+	dirMgr.errorsMu.Lock()
+	defer dirMgr.errorsMu.Unlock()
+
+	scanErrors := make([]FileError, 0, len(dirMgr.errorMap))
+	for _, scanError := range dirMgr.errorMap {
+		scanErrors = append(scanErrors, scanError)
+	}
+	sort.Slice(scanErrors, func(i, j int) bool {
+		return scanErrors[i].SzPath < scanErrors[j].SzPath
+	})
+	return scanErrors
+}
+
+func (dirMgr *DirectoryScanner) addError(szPath string, err error) {
+	dirMgr.errorsMu.Lock()
+	defer dirMgr.errorsMu.Unlock()
+
+	dirMgr.errorMap[szPath] = FileError{SzPath: szPath, SzError: err.Error(), TmTime: time.Now()}
+}
+
+func (dirMgr *DirectoryScanner) clearErrors(szRoot string) {
+	dirMgr.errorsMu.Lock()
+	defer dirMgr.errorsMu.Unlock()
+
+	for szPath := range dirMgr.errorMap {
+		if isWithinPath(szPath, szRoot) {
+			delete(dirMgr.errorMap, szPath)
+		}
+	}
+}
+
+// IsIgnored reports whether the path, or a directory above it, is excluded
+// by an ignore file, the profile's patterns or its hidden-file and
+// one-filesystem options.
+func (dirMgr *DirectoryScanner) IsIgnored(szPath string, bDir bool) bool {
+	szRoot, _, bIgnored := dirMgr.rulesFor(szPath, bDir)
+	if bIgnored {
+		return true
+	}
+	if !bDir || !dirMgr.options.BOneFilesystem {
+		return false
+	}
 
-			ext := strings.ToLower(filepath.Ext(path))
-			if !dirMgr.isAllowedExtension(ext) {
-				return nil 
+	rootInfo, err := os.Stat(szRoot)
+	if err != nil {
+		return false
+	}
+	info, err := os.Stat(szPath)
+	if err != nil {
+		return false
+	}
+	inRootDevice, bRootDevice := deviceOf(rootInfo)
+	inDevice, bDevice := deviceOf(info)
+	return bRootDevice && bDevice && inDevice != inRootDevice
+}
+
+// rulesFor collects the rules that apply inside the directory holding
+// szPath, walking down from its watched directory and checking that no
+// directory on the way is ignored. The ignore files of szPath itself are
+// left to walk.
+func (dirMgr *DirectoryScanner) rulesFor(szPath string, bDir bool) (string, []ignoreRules, bool) {
+	szRoot := dirMgr.rootOf(szPath)
+	var ruleSets []ignoreRules
+	if len(dirMgr.excludePatterns) > 0 {
+		ruleSets = append(ruleSets, ignoreRules{szBase: szRoot, patterns: dirMgr.excludePatterns})
+	}
+
+	szRel, err := filepath.Rel(szRoot, szPath)
+	if err != nil || szRel == "." {
+		return szRoot, ruleSets, false
+	}
+
+	szDir := szRoot
+	parts := strings.Split(szRel, string(filepath.Separator))
+	for i, szPart := range parts {
+		if dirMgr.isHidden(szPart) {
+			return szRoot, nil, true
+		}
+		ruleSets = append(ruleSets, readIgnoreRules(szDir)...)
+		szDir = filepath.Join(szDir, szPart)
+		if isIgnored(ruleSets, szDir, bDir || i < len(parts)-1) {
+			return szRoot, nil, true
+		}
+	}
+	return szRoot, ruleSets, false
+}
+
+// rootOf returns the innermost watched directory holding szPath.
+func (dirMgr *DirectoryScanner) rootOf(szPath string) string {
+	szRoot := ""
+	for _, dir := range dirMgr.watchedDirs {
+		if isWithinPath(szPath, dir) && len(filepath.Clean(dir)) > len(szRoot) {
+			szRoot = filepath.Clean(dir)
+		}
+	}
+	if szRoot == "" {
+		return filepath.Dir(szPath)
+	}
+	return szRoot
+}
+
+func (dirMgr *DirectoryScanner) isHidden(szName string) bool {
+	return dirMgr.options.BSkipHidden && strings.HasPrefix(szName, ".")
+}
+
+// enterDir reports whether the walk should descend into a directory. Each
+// directory is entered once per walk, which stops symlink cycles, and with
+// BOneFilesystem only when it sits on the watched directory's device.
+func (dirMgr *DirectoryScanner) enterDir(state *scanState, szDir string, info os.FileInfo) bool {
+	if dirMgr.options.BOneFilesystem && state.bRootDevice {
+		if inDevice, ok := deviceOf(info); ok && inDevice != state.inRootDevice {
+			return false
+		}
+	}
+
+	szKey := fileKey(szDir, info)
+	if state.visitedMap[szKey] {
+		return false
+	}
+	state.visitedMap[szKey] = true
+	return true
+}
+
+func (dirMgr *DirectoryScanner) walk(state *scanState, szDir string, ruleSets []ignoreRules) {
+	ruleSets = append(ruleSets[:len(ruleSets):len(ruleSets)], readIgnoreRules(szDir)...)
+
+	// ReadDir returns the entries it got before failing.
+	entries, err := os.ReadDir(szDir)
+	if err != nil {
+		dirMgr.addError(szDir, err)
+	}
+
+	for _, entry := range entries {
+		if dirMgr.isHidden(entry.Name()) {
+			continue
+		}
+		szPath := filepath.Join(szDir, entry.Name())
+
+		info, err := entry.Info()
+		if err != nil {
+			if !os.IsNotExist(err) {
+				dirMgr.addError(szPath, err)
+			}
+			continue
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			if !dirMgr.options.BFollowSymlinks {
+				continue
 			}
-			
-			hash, err := hashFile(path)
-			if err != nil {
-				return nil 
+			if info, err = os.Stat(szPath); err != nil {
+				dirMgr.addError(szPath, err)
+				continue
 			}
+		}
 
-			files = append(files, FileInfo{
-				SzPath: path,
-				SzName: info.Name(),
-				SzExtension: ext,
-				InSize: info.Size(),
-				TmModTime: info.ModTime(),
-				SzHash: hash,
-			})
-
-			return nil
-		})
-		if err != nil {
-			return nil, fmt.Errorf("Error scanning %s: %w", dir, err)
+		if info.IsDir() {
+			if !isIgnored(ruleSets, szPath, true) && dirMgr.enterDir(state, szPath, info) {
+				dirMgr.walk(state, szPath, ruleSets)
+			}
+			continue
+		}
+
+		if !info.Mode().IsRegular() || isIgnored(ruleSets, szPath, false) {
+			continue
+		}
+		if file, ok := dirMgr.fileInfo(state.szRoot, szPath, info); ok {
+			state.files = append(state.files, file)
 		}
 	}
-	return files, nil
+}
+
+// fileInfo applies the size, extension and include filters to a file.
+func (dirMgr *DirectoryScanner) fileInfo(szRoot string, szPath string, info os.FileInfo) (FileInfo, bool) {
+	if info.Size() > dirMgr.maxFileSize {
+		return FileInfo{}, false
+	}
+
+	ext := strings.ToLower(filepath.Ext(szPath))
+	if !dirMgr.isAllowedExtension(ext) {
+		return FileInfo{}, false
+	}
+
+	if len(dirMgr.includePatterns) > 0 {
+		bMatched, bIncluded := ignoreRules{szBase: szRoot, patterns: dirMgr.includePatterns}.match(szPath, false)
+		if !bMatched || !bIncluded {
+			return FileInfo{}, false
+		}
+	}
+
+	return FileInfo{
+		SzPath: szPath,
+		SzName: info.Name(),
+		SzExtension: ext,
+		InSize: info.Size(),
+		TmModTime: info.ModTime(),
+	}, true
 }
 
 func (dirMgr *DirectoryScanner) isAllowedExtension(ext string) bool {
@@ -83,7 +378,10 @@ func (dirMgr *DirectoryScanner) isAllowedExtension(ext string) bool {
 	return false
 }
 
-func hashFile(path string) (string, error) {
+// HashFile hashes the file contents. Hashes other than MD5, which older
+// index files hold, are prefixed with their algorithm so a hash recorded
+// under another algorithm never matches.
+func (dirMgr *DirectoryScanner) HashFile(path string) (string, error) {
 	file, err := os.Open(path)
 	if err != nil {
 		return "", err
@@ -91,10 +389,13 @@ func hashFile(path string) (string, error) {
 
 	defer file.Close()
 
-	hash := md5.New()
+	hash := dirMgr.newHash()
 	if _, err := io.Copy(hash, file); err != nil {
 		return "", err
 	}
 
-	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+	if dirMgr.szHashAlgorithm == HashMD5 {
+		return fmt.Sprintf("%x", hash.Sum(nil)), nil
+	}
+	return fmt.Sprintf("%s:%x", dirMgr.szHashAlgorithm, hash.Sum(nil)), nil
 }
@@ -0,0 +1,187 @@
+package indexer
+
+import (
+	"errors"
+	"log"
+	"sort"
+	"time"
+)
+
+const (
+	RunFull = "full"
+	RunChanges = "changes"
+	RunRebuild = "rebuild"
+)
+
+var ErrRebuildPending = errors.New("a rebuild is already pending")
+
+// IndexStatus is a snapshot of the indexer for the status API. The counts
+// describe the current run, or the last one when nothing is running.
+type IndexStatus struct {
+	BRunning bool `json:"running"`
+	SzRun string `json:"run,omitempty"`
+	InQueued int `json:"queued"`
+	InDone int `json:"done"`
+	InFailed int `json:"failed"`
+	CurrentFiles []string `json:"current_files"`
+	InIndexedFiles int `json:"indexed_files"`
+	TmLastFullScan *time.Time `json:"last_full_scan,omitempty"`
+	Errors []FileError `json:"errors"`
+	ScanErrors []FileError `json:"scan_errors"`
+}
+
+// FileError is the last indexing failure of a file, or a path the scanner
+// could not read. It is cleared once the file indexes successfully or
+// disappears, or the next scan of the path gets through.
+type FileError struct {
+	SzPath string `json:"path"`
+	SzError string `json:"error"`
+	TmTime time.Time `json:"time"`
+}
+
+// runStatus is the mutable state behind IndexStatus, guarded by statusMu.
+type runStatus struct {
+	bRunning bool
+	szRun string
+	inQueued int
+	inDone int
+	inFailed int
+	currentMap map[string]bool
+	inIndexedFiles int
+	tmLastFullScan time.Time
+	errorMap map[string]FileError
+}
+
+func (idxMgr *IndexerManager) Status() IndexStatus {
+	idxMgr.statusMu.Lock()
+	defer idxMgr.statusMu.Unlock()
+
+	run := &idxMgr.status
+	status := IndexStatus{
+		BRunning: run.bRunning,
+		SzRun: run.szRun,
+		InQueued: run.inQueued,
+		InDone: run.inDone,
+		InFailed: run.inFailed,
+		CurrentFiles: []string{},
+		InIndexedFiles: run.inIndexedFiles,
+		Errors: []FileError{},
+		ScanErrors: idxMgr.scannerMgr.Errors(),
+	}
+	if !run.tmLastFullScan.IsZero() {
+		tmLastFullScan := run.tmLastFullScan
+		status.TmLastFullScan = &tmLastFullScan
+	}
+
+	for szPath := range run.currentMap {
+		status.CurrentFiles = append(status.CurrentFiles, szPath)
+	}
+	sort.Strings(status.CurrentFiles)
+
+	for _, fileError := range run.errorMap {
+		status.Errors = append(status.Errors, fileError)
+	}
+	sort.Slice(status.Errors, func(i, j int) bool {
+		return status.Errors[i].SzPath < status.Errors[j].SzPath
+	})
+
+	return status
+}
+
+// Rebuild runs a full scan in the background, or with bForce re-indexes
+// every file even if it did not change. Only one rebuild can be waiting
+// at a time.
+func (idxMgr *IndexerManager) Rebuild(bForce bool) error {
+	if !idxMgr.bRebuildPending.CompareAndSwap(false, true) {
+		return ErrRebuildPending
+	}
+
+	go func() {
+		defer idxMgr.bRebuildPending.Store(false)
+
+		szRun := RunFull
+		if bForce {
+			szRun = RunRebuild
+		}
+		if err := idxMgr.indexAll(szRun); err != nil {
+			log.Printf("Rebuild error: %v\n", err)
+		}
+	}()
+
+	return nil
+}
+
+func (idxMgr *IndexerManager) beginRun(szRun string) {
+	idxMgr.statusMu.Lock()
+	defer idxMgr.statusMu.Unlock()
+
+	idxMgr.status.bRunning = true
+	idxMgr.status.szRun = szRun
+	idxMgr.status.inQueued = 0
+	idxMgr.status.inDone = 0
+	idxMgr.status.inFailed = 0
+	idxMgr.status.currentMap = make(map[string]bool)
+}
+
+func (idxMgr *IndexerManager) queueFiles(inFiles int) {
+	idxMgr.statusMu.Lock()
+	defer idxMgr.statusMu.Unlock()
+
+	idxMgr.status.inQueued += inFiles
+}
+
+func (idxMgr *IndexerManager) startFile(szPath string) {
+	idxMgr.statusMu.Lock()
+	defer idxMgr.statusMu.Unlock()
+
+	idxMgr.status.inQueued--
+	idxMgr.status.currentMap[szPath] = true
+}
+
+func (idxMgr *IndexerManager) finishFile(szPath string, err error) {
+	idxMgr.statusMu.Lock()
+	defer idxMgr.statusMu.Unlock()
+
+	delete(idxMgr.status.currentMap, szPath)
+	if err != nil {
+		idxMgr.status.inFailed++
+		idxMgr.status.errorMap[szPath] = FileError{SzPath: szPath, SzError: err.Error(), TmTime: time.Now()}
+		return
+	}
+
+	idxMgr.status.inDone++
+	delete(idxMgr.status.errorMap, szPath)
+}
+
+// failFile records an error for a file that never reached a worker.
+func (idxMgr *IndexerManager) failFile(szPath string, err error) {
+	idxMgr.statusMu.Lock()
+	defer idxMgr.statusMu.Unlock()
+
+	idxMgr.status.inFailed++
+	idxMgr.status.errorMap[szPath] = FileError{SzPath: szPath, SzError: err.Error(), TmTime: time.Now()}
+}
+
+// forgetFile drops the error of a file that was removed from the index.
+func (idxMgr *IndexerManager) forgetFile(szPath string) {
+	idxMgr.statusMu.Lock()
+	defer idxMgr.statusMu.Unlock()
+
+	delete(idxMgr.status.errorMap, szPath)
+}
+
+// endRun closes a run; a full run that finished, its state saved, records
+// its time. Callers must hold mu, which guards the indexed file count.
+func (idxMgr *IndexerManager) endRun(bCompleted bool) {
+	inIndexedFiles := len(idxMgr.indexedFilesMap)
+
+	idxMgr.statusMu.Lock()
+	defer idxMgr.statusMu.Unlock()
+
+	if bCompleted && idxMgr.status.szRun != RunChanges {
+		idxMgr.status.tmLastFullScan = time.Now()
+	}
+	idxMgr.status.bRunning = false
+	idxMgr.status.inQueued = 0
+	idxMgr.status.inIndexedFiles = inIndexedFiles
+}
@@ -0,0 +1,79 @@
+package indexer
+
+import (
+	"chak-server/internal/document"
+	"chak-server/internal/memory"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+// fakeScanner returns a fixed scan result and cannot hash anything.
+type fakeScanner struct {
+	files []FileInfo
+	err error
+}
+
+func (scanner *fakeScanner) ScanDirectories() ([]FileInfo, error) {
+	return scanner.files, scanner.err
+}
+
+func (scanner *fakeScanner) ScanPath(szPath string) ([]FileInfo, error) {
+	return nil, nil
+}
+
+func (scanner *fakeScanner) HashFile(szPath string) (string, error) {
+	return "", errors.New("unreadable")
+}
+
+func (scanner *fakeScanner) IsIgnored(szPath string, bDir bool) bool {
+	return false
+}
+
+func (scanner *fakeScanner) Directories() []string {
+	return nil
+}
+
+func (scanner *fakeScanner) Errors() []FileError {
+	return nil
+}
+
+type fakeMemory struct {
+	memory.MemoryInterface
+}
+
+func (memoryMgr fakeMemory) EmbeddingModel() string {
+	return "test"
+}
+
+func TestLastFullScan(t *testing.T) {
+	szDir := t.TempDir()
+	file := FileInfo{SzPath: filepath.Join(szDir, "a.txt"), SzName: "a.txt", SzExtension: ".txt"}
+
+	tests := []struct {
+		szName string
+		scanner *fakeScanner
+		szIndexFile string
+		bWantRecorded bool
+	}{
+		{szName: "nothing to index", scanner: &fakeScanner{}, szIndexFile: filepath.Join(szDir, "empty.json"), bWantRecorded: true},
+		{szName: "state saved", scanner: &fakeScanner{files: []FileInfo{file}}, szIndexFile: filepath.Join(szDir, "index.json"), bWantRecorded: true},
+		{szName: "scan failed", scanner: &fakeScanner{err: errors.New("scan failed")}, szIndexFile: filepath.Join(szDir, "failed.json"), bWantRecorded: false},
+		{szName: "state not saved", scanner: &fakeScanner{files: []FileInfo{file}}, szIndexFile: filepath.Join(szDir, "missing", "index.json"), bWantRecorded: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.szName, func(t *testing.T) {
+			idxMgr := NewIndexerManager(tt.scanner, fakeMemory{}, tt.szIndexFile, document.ChunkOptions{}, IndexOptions{})
+			idxMgr.IndexAll()
+
+			status := idxMgr.Status()
+			if status.BRunning {
+				t.Error("run still marked as running")
+			}
+			if bRecorded := status.TmLastFullScan != nil; bRecorded != tt.bWantRecorded {
+				t.Errorf("last full scan recorded = %v, want %v", bRecorded, tt.bWantRecorded)
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package indexer
+
+import (
+	"log"
+	"sort"
+	"time"
+)
+
+// pollInterval caps the full scan interval when filesystem events are not
+// available, which was the only way changes were noticed before.
+const pollInterval = 5 * time.Minute
+
+// maxDebounceWaits bounds how long a steady stream of events can hold back
+// indexing, in debounce periods.
+const maxDebounceWaits = 10
+
+// watchEvent is a path that changed under a watched directory. bOverflow
+// reports that events were dropped and the whole tree must be rescanned.
+type watchEvent struct {
+	szPath string
+	bOverflow bool
+}
+
+// fsWatcher delivers change events for directory trees. Directories created
+// or moved into a watched tree are watched as they appear, unless the
+// skipDir function given to newFSWatcher rejects them.
+type fsWatcher interface {
+	AddTree(szRoot string) error
+	Events() <-chan watchEvent
+	Close() error
+}
+
+// StartWatcher re-indexes changed paths as filesystem events arrive, once
+// no new event came in for tmDebounce, and runs IndexAll every tmFullScan
+// to catch anything the events missed.
+func (idxMgr *IndexerManager) StartWatcher(tmFullScan time.Duration, tmDebounce time.Duration) {
+	watcher, err := newFSWatcher(func(szDir string) bool {
+		return idxMgr.scannerMgr.IsIgnored(szDir, true)
+	})
+	if err == nil {
+		err = idxMgr.watchDirectories(watcher)
+	}
+	if err != nil {
+		log.Printf("Cannot watch all directories, polling instead: %v\n", err)
+		tmFullScan = min(tmFullScan, pollInterval)
+	}
+
+	idxMgr.ticker = time.NewTicker(tmFullScan)
+
+	go idxMgr.watchLoop(watcher, tmDebounce)
+
+	log.Printf("Watcher started, full scan every %v\n", tmFullScan)
+}
+
+func (idxMgr *IndexerManager) StopWatcher() {
+	if idxMgr.ticker != nil {
+		idxMgr.ticker.Stop()
+		close(idxMgr.stopChan)
+		log.Println("Indexer watcher stopped")
+	}
+}
+
+func (idxMgr *IndexerManager) watchDirectories(watcher fsWatcher) error {
+	for _, dir := range idxMgr.scannerMgr.Directories() {
+		if err := watcher.AddTree(dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (idxMgr *IndexerManager) watchLoop(watcher fsWatcher, tmDebounce time.Duration) {
+	var events <-chan watchEvent
+	if watcher != nil {
+		events = watcher.Events()
+		defer watcher.Close()
+	}
+
+	pendingMap := make(map[string]bool)
+	var tmFirstPending time.Time
+	debounce := time.NewTimer(tmDebounce)
+	debounce.Stop()
+
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+
+			if event.bOverflow {
+				log.Println("Watcher missed events, rescanning everything...")
+				clear(pendingMap)
+				debounce.Stop()
+				if err := idxMgr.watchDirectories(watcher); err != nil {
+					log.Printf("Watcher error: %v\n", err)
+				}
+				if err := idxMgr.IndexAll(); err != nil {
+					log.Printf("Auto indexing error: %v \n", err)
+				}
+				continue
+			}
+
+			if len(pendingMap) == 0 {
+				tmFirstPending = time.Now()
+			}
+			pendingMap[event.szPath] = true
+
+			if time.Since(tmFirstPending) >= maxDebounceWaits*tmDebounce {
+				debounce.Reset(0)
+			} else {
+				debounce.Reset(tmDebounce)
+			}
+
+		case <-debounce.C:
+			paths := make([]string, 0, len(pendingMap))
+			for szPath := range pendingMap {
+				paths = append(paths, szPath)
+			}
+			sort.Strings(paths)
+			clear(pendingMap)
+
+			log.Printf("Indexing %d changed paths...\n", len(paths))
+			if err := idxMgr.IndexPaths(paths); err != nil {
+				log.Printf("Auto indexing error: %v \n", err)
+			}
+
+		case <-idxMgr.ticker.C:
+			log.Printf("Auto indexing check...")
+			if err := idxMgr.IndexAll(); err != nil {
+				log.Printf("Auto indexing error: %v \n", err)
+			}
+
+		case <-idxMgr.stopChan:
+			log.Println("Stopping indexer watcher.")
+			return
+		}
+	}
+}
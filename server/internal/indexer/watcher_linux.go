@@ -0,0 +1,222 @@
+package indexer
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+const inotifyMask = syscall.IN_CLOSE_WRITE | syscall.IN_CREATE | syscall.IN_DELETE |
+	syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO | syscall.IN_DELETE_SELF | syscall.IN_MOVE_SELF |
+	syscall.IN_ONLYDIR | syscall.IN_EXCL_UNLINK
+
+// inotifyWatcher watches every directory of a tree with one inotify watch
+// each, since inotify itself is not recursive.
+type inotifyWatcher struct {
+	file *os.File
+	inFd int
+	wdPathMap map[int]string
+	pathWdMap map[string]int
+	events chan watchEvent
+	done chan struct{}
+	skipDir func(szDir string) bool
+	mu sync.Mutex
+}
+
+func newFSWatcher(skipDir func(szDir string) bool) (fsWatcher, error) {
+	inFd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("inotify init: %w", err)
+	}
+
+	// A non-blocking descriptor goes through the runtime poller, so Close
+	// wakes up the pending Read.
+	watcher := &inotifyWatcher{
+		file: os.NewFile(uintptr(inFd), "inotify"),
+		inFd: inFd,
+		wdPathMap: make(map[int]string),
+		pathWdMap: make(map[string]int),
+		events: make(chan watchEvent, 64),
+		done: make(chan struct{}),
+		skipDir: skipDir,
+	}
+
+	go watcher.readEvents()
+
+	return watcher, nil
+}
+
+func (watcher *inotifyWatcher) Events() <-chan watchEvent {
+	return watcher.events
+}
+
+func (watcher *inotifyWatcher) Close() error {
+	select {
+	case <-watcher.done:
+		return nil
+	default:
+		close(watcher.done)
+	}
+	return watcher.file.Close()
+}
+
+// AddTree watches szRoot and every directory below it that skipDir lets
+// through. Directories that cannot be read are skipped; running out of
+// watches is an error.
+func (watcher *inotifyWatcher) AddTree(szRoot string) error {
+	if _, err := os.Stat(szRoot); err != nil {
+		return err
+	}
+
+	return filepath.WalkDir(szRoot, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || !entry.IsDir() {
+			return nil
+		}
+		if watcher.skipDir(path) {
+			return filepath.SkipDir
+		}
+
+		inWd, err := syscall.InotifyAddWatch(watcher.inFd, path, inotifyMask)
+		if errors.Is(err, syscall.ENOSPC) {
+			return fmt.Errorf("inotify watch limit reached at %s (see fs.inotify.max_user_watches): %w", path, err)
+		}
+		if err != nil {
+			return nil
+		}
+
+		watcher.mu.Lock()
+		if szOld, exists := watcher.wdPathMap[inWd]; exists {
+			delete(watcher.pathWdMap, szOld)
+		}
+		watcher.wdPathMap[inWd] = path
+		watcher.pathWdMap[path] = inWd
+		watcher.mu.Unlock()
+
+		return nil
+	})
+}
+
+// removeTree drops the watches of a directory that moved away, so its
+// descriptors no longer resolve to the old path. A move within the tree
+// is watched again under the new name.
+func (watcher *inotifyWatcher) removeTree(szRoot string) {
+	watcher.mu.Lock()
+	defer watcher.mu.Unlock()
+
+	for szPath, inWd := range watcher.pathWdMap {
+		if isWithinPath(szPath, szRoot) {
+			syscall.InotifyRmWatch(watcher.inFd, uint32(inWd))
+			delete(watcher.pathWdMap, szPath)
+			delete(watcher.wdPathMap, inWd)
+		}
+	}
+}
+
+func (watcher *inotifyWatcher) forget(inWd int) {
+	watcher.mu.Lock()
+	defer watcher.mu.Unlock()
+
+	if szPath, exists := watcher.wdPathMap[inWd]; exists {
+		delete(watcher.wdPathMap, inWd)
+		if watcher.pathWdMap[szPath] == inWd {
+			delete(watcher.pathWdMap, szPath)
+		}
+	}
+}
+
+func (watcher *inotifyWatcher) pathOf(inWd int) string {
+	watcher.mu.Lock()
+	defer watcher.mu.Unlock()
+
+	return watcher.wdPathMap[inWd]
+}
+
+func (watcher *inotifyWatcher) readEvents() {
+	defer close(watcher.events)
+
+	buffer := make([]byte, 64*1024)
+	for {
+		inRead, err := watcher.file.Read(buffer)
+		if err != nil {
+			return
+		}
+
+		for inOffset := 0; inOffset+syscall.SizeofInotifyEvent <= inRead; {
+			inWd := int(int32(binary.NativeEndian.Uint32(buffer[inOffset:])))
+			inMask := binary.NativeEndian.Uint32(buffer[inOffset+4:])
+			inNameLen := int(binary.NativeEndian.Uint32(buffer[inOffset+12:]))
+			inOffset += syscall.SizeofInotifyEvent
+
+			szName := ""
+			if inNameLen > 0 && inOffset+inNameLen <= inRead {
+				szName = strings.TrimRight(string(buffer[inOffset:inOffset+inNameLen]), "\x00")
+			}
+			inOffset += inNameLen
+
+			if !watcher.handle(inWd, inMask, szName) {
+				return
+			}
+		}
+	}
+}
+
+// handle turns one inotify event into a watchEvent, keeping the watches in
+// step with directories that appear and disappear. It returns false once
+// the watcher is closed.
+func (watcher *inotifyWatcher) handle(inWd int, inMask uint32, szName string) bool {
+	if inMask&syscall.IN_Q_OVERFLOW != 0 {
+		return watcher.send(watchEvent{bOverflow: true})
+	}
+	if inMask&syscall.IN_IGNORED != 0 {
+		watcher.forget(inWd)
+		return true
+	}
+
+	szDir := watcher.pathOf(inWd)
+	if szDir == "" {
+		return true
+	}
+	szPath := szDir
+	if szName != "" {
+		szPath = filepath.Join(szDir, szName)
+	}
+
+	bDir := inMask&syscall.IN_ISDIR != 0
+	switch {
+	case inMask&syscall.IN_MOVE_SELF != 0:
+		watcher.removeTree(szDir)
+	case bDir && inMask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0:
+		// Files written before the watch was in place are picked up by
+		// indexing the whole directory.
+		if err := watcher.AddTree(szPath); err != nil && !os.IsNotExist(err) {
+			return watcher.send(watchEvent{bOverflow: true})
+		}
+	case bDir && inMask&syscall.IN_MOVED_FROM != 0:
+		watcher.removeTree(szPath)
+	case !bDir && inMask&syscall.IN_CREATE != 0:
+		// The IN_CLOSE_WRITE that follows marks the file as complete.
+		return true
+	case isIgnoreFile(szName):
+		// Directories the old rules skipped may need watching now.
+		if err := watcher.AddTree(szDir); err != nil && !os.IsNotExist(err) {
+			return watcher.send(watchEvent{bOverflow: true})
+		}
+	}
+
+	return watcher.send(watchEvent{szPath: szPath})
+}
+
+func (watcher *inotifyWatcher) send(event watchEvent) bool {
+	select {
+	case watcher.events <- event:
+		return true
+	case <-watcher.done:
+		return false
+	}
+}
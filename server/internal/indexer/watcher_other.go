@@ -0,0 +1,9 @@
+//go:build !linux
+
+package indexer
+
+import "errors"
+
+func newFSWatcher(skipDir func(szDir string) bool) (fsWatcher, error) {
+	return nil, errors.New("filesystem events are only supported on Linux")
+}
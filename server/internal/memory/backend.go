@@ -0,0 +1,89 @@
+package memory
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+)
+
+// ErrClosed is returned by writes to a MemoryManager after Close.
+var ErrClosed = errors.New("memory store is closed")
+
+// storageBackend persists the in-memory entry list of a MemoryManager.
+// Persist receives the full list together with the delta of the current
+// operation so that backends can choose between rewriting and appending.
+type storageBackend interface {
+	Open(szFilename string) ([]MemoryEntry, error)
+	Persist(allEntries []MemoryEntry, savedEntries []MemoryEntry, deletedIDs []string) error
+	Snapshot(allEntries []MemoryEntry) error
+	Close() error
+}
+
+type jsonFileBackend struct {
+	szFilename string
+}
+
+func newJSONFileBackend() *jsonFileBackend {
+	return &jsonFileBackend{}
+}
+
+func (jsonBackend *jsonFileBackend) Open(szFilename string) ([]MemoryEntry, error) {
+	jsonBackend.szFilename = szFilename
+	return readJSONMemoryFile(szFilename)
+}
+
+func (jsonBackend *jsonFileBackend) Persist(allEntries []MemoryEntry, savedEntries []MemoryEntry, deletedIDs []string) error {
+	return jsonBackend.Snapshot(allEntries)
+}
+
+func (jsonBackend *jsonFileBackend) Snapshot(allEntries []MemoryEntry) error {
+	data, err := json.MarshalIndent(allEntries, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(jsonBackend.szFilename, data, 0644)
+}
+
+func (jsonBackend *jsonFileBackend) Close() error {
+	return nil
+}
+
+// closedBackend replaces the backend of a closed MemoryManager, so that a
+// request still holding the manager fails instead of writing behind the
+// back of the store that replaced it.
+type closedBackend struct{}
+
+func (closedBackend) Open(szFilename string) ([]MemoryEntry, error) {
+	return nil, ErrClosed
+}
+
+func (closedBackend) Persist(allEntries []MemoryEntry, savedEntries []MemoryEntry, deletedIDs []string) error {
+	return ErrClosed
+}
+
+func (closedBackend) Snapshot(allEntries []MemoryEntry) error {
+	return ErrClosed
+}
+
+func (closedBackend) Close() error {
+	return nil
+}
+
+func readJSONMemoryFile(szFilename string) ([]MemoryEntry, error) {
+	memories := []MemoryEntry{}
+
+	data, err := os.ReadFile(szFilename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return memories, nil
+		}
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &memories); err != nil {
+		return nil, err
+	}
+
+	return memories, nil
+}
@@ -0,0 +1,155 @@
+package memory
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const (
+	bm25K1 = 1.2
+	bm25B = 0.75
+)
+
+type keywordHit struct {
+	szId string
+	flScore float64
+}
+
+// bm25Index is an inverted index over memory contents scored with Okapi
+// BM25. It complements embeddings for exact identifiers such as error codes
+// or invoice numbers that embedding models tend to blur.
+type bm25Index struct {
+	postingsMap map[string]map[string]int
+	docLengthMap map[string]int
+	inTotalLength int
+}
+
+func newBM25Index() *bm25Index {
+	return &bm25Index{
+		postingsMap: make(map[string]map[string]int),
+		docLengthMap: make(map[string]int),
+	}
+}
+
+func (idx *bm25Index) Add(szId string, szText string) {
+	if _, exists := idx.docLengthMap[szId]; exists {
+		idx.Remove(szId, szText)
+	}
+
+	terms := tokenizeKeywords(szText)
+	for _, szTerm := range terms {
+		postings, exists := idx.postingsMap[szTerm]
+		if !exists {
+			postings = make(map[string]int)
+			idx.postingsMap[szTerm] = postings
+		}
+		postings[szId]++
+	}
+
+	idx.docLengthMap[szId] = len(terms)
+	idx.inTotalLength += len(terms)
+}
+
+// Remove drops a document. The original text is needed to find its postings
+// without keeping a forward index.
+func (idx *bm25Index) Remove(szId string, szText string) {
+	inLength, exists := idx.docLengthMap[szId]
+	if !exists {
+		return
+	}
+
+	for _, szTerm := range tokenizeKeywords(szText) {
+		postings := idx.postingsMap[szTerm]
+		delete(postings, szId)
+		if len(postings) == 0 {
+			delete(idx.postingsMap, szTerm)
+		}
+	}
+
+	delete(idx.docLengthMap, szId)
+	idx.inTotalLength -= inLength
+}
+
+// Search scores every document containing at least one query term, best
+// first. The accept callback lets callers apply metadata filters.
+func (idx *bm25Index) Search(szQuery string, iTopK int, accept func(szId string) bool) []keywordHit {
+	inDocs := len(idx.docLengthMap)
+	if inDocs == 0 {
+		return nil
+	}
+
+	flAvgLength := float64(idx.inTotalLength) / float64(inDocs)
+	scoreMap := make(map[string]float64)
+
+	seenMap := make(map[string]bool)
+	for _, szTerm := range tokenizeKeywords(szQuery) {
+		if seenMap[szTerm] {
+			continue
+		}
+		seenMap[szTerm] = true
+
+		postings := idx.postingsMap[szTerm]
+		if len(postings) == 0 {
+			continue
+		}
+
+		flIdf := math.Log(1 + (float64(inDocs)-float64(len(postings))+0.5)/(float64(len(postings))+0.5))
+
+		for szId, inFreq := range postings {
+			if !accept(szId) {
+				continue
+			}
+
+			flFreq := float64(inFreq)
+			flNorm := bm25K1 * (1 - bm25B + bm25B*float64(idx.docLengthMap[szId])/flAvgLength)
+			scoreMap[szId] += flIdf * flFreq * (bm25K1 + 1) / (flFreq + flNorm)
+		}
+	}
+
+	hits := make([]keywordHit, 0, len(scoreMap))
+	for szId, flScore := range scoreMap {
+		hits = append(hits, keywordHit{szId: szId, flScore: flScore})
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].flScore == hits[j].flScore {
+			return hits[i].szId < hits[j].szId
+		}
+		return hits[i].flScore > hits[j].flScore
+	})
+
+	if len(hits) > iTopK {
+		hits = hits[:iTopK]
+	}
+
+	return hits
+}
+
+// tokenizeKeywords lowercases the text and splits it into words. Compound
+// identifiers such as "INV-2023-001" or "user_id" are kept whole and also
+// indexed by their parts.
+func tokenizeKeywords(szText string) []string {
+	var terms []string
+
+	fields := strings.FieldsFunc(strings.ToLower(szText), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' && r != '-' && r != '.' && r != '/'
+	})
+
+	for _, szField := range fields {
+		szField = strings.Trim(szField, "_-./")
+		if szField == "" {
+			continue
+		}
+		terms = append(terms, szField)
+
+		parts := strings.FieldsFunc(szField, func(r rune) bool {
+			return r == '_' || r == '-' || r == '.' || r == '/'
+		})
+		if len(parts) > 1 {
+			terms = append(terms, parts...)
+		}
+	}
+
+	return terms
+}
@@ -0,0 +1,161 @@
+package memory
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func acceptAll(string) bool {
+	return true
+}
+
+func newTestBM25(docs map[string]string) *bm25Index {
+	idx := newBM25Index()
+	for szID, szText := range docs {
+		idx.Add(szID, szText)
+	}
+	return idx
+}
+
+func hitIDs(hits []keywordHit) []string {
+	ids := make([]string, len(hits))
+	for i, hit := range hits {
+		ids[i] = hit.szId
+	}
+	return ids
+}
+
+func TestBM25TermWeighting(t *testing.T) {
+	tests := []struct {
+		szName string
+		docs map[string]string
+		szQuery string
+		wantIDs []string
+	}{
+		{
+			szName: "rare term outweighs common term",
+			docs: map[string]string{
+				"common": "invoice invoice payment",
+				"rare": "invoice refund",
+				"other": "invoice payment",
+			},
+			szQuery: "invoice refund",
+			wantIDs: []string{"rare", "common", "other"},
+		},
+		{
+			szName: "term frequency raises the score",
+			docs: map[string]string{
+				"once": "kubernetes cluster node pool",
+				"thrice": "kubernetes kubernetes kubernetes node",
+				"none": "docker compose file",
+			},
+			szQuery: "kubernetes",
+			wantIDs: []string{"thrice", "once"},
+		},
+		{
+			szName: "shorter documents win at equal frequency",
+			docs: map[string]string{
+				"short": "backup schedule",
+				"long": "backup schedule for the database servers in the second data centre",
+				"none": "nothing relevant",
+			},
+			szQuery: "backup",
+			wantIDs: []string{"short", "long"},
+		},
+		{
+			szName: "compound identifiers match whole and by part",
+			docs: map[string]string{
+				"invoice": "Paid INV-2023-001 in full",
+				"year": "Budget for 2023",
+				"none": "unrelated note",
+			},
+			szQuery: "inv-2023-001",
+			wantIDs: []string{"invoice", "year"},
+		},
+		{
+			szName: "repeated query terms count once",
+			docs: map[string]string{
+				"a": "alpha beta",
+				"b": "beta gamma",
+				"c": "delta",
+			},
+			szQuery: "alpha alpha alpha beta",
+			wantIDs: []string{"a", "b"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.szName, func(t *testing.T) {
+			hits := newTestBM25(tt.docs).Search(tt.szQuery, 10, acceptAll)
+			if fmt.Sprint(hitIDs(hits)) != fmt.Sprint(tt.wantIDs) {
+				t.Errorf("Search(%q) = %v, want %v", tt.szQuery, hitIDs(hits), tt.wantIDs)
+			}
+		})
+	}
+}
+
+func TestBM25Score(t *testing.T) {
+	idx := newTestBM25(map[string]string{
+		"a": "apple banana",
+		"b": "banana cherry cherry",
+	})
+
+	// "apple" appears in one of two documents, "a" has 2 terms and the
+	// average length is 2.5.
+	flIdf := math.Log(1 + (2-1+0.5)/(1+0.5))
+	flNorm := bm25K1 * (1 - bm25B + bm25B*2/2.5)
+	flWant := flIdf * (bm25K1 + 1) / (1 + flNorm)
+
+	hits := idx.Search("apple", 10, acceptAll)
+	if len(hits) != 1 || hits[0].szId != "a" {
+		t.Fatalf("hits %v, want [a]", hitIDs(hits))
+	}
+	if math.Abs(hits[0].flScore-flWant) > 1e-9 {
+		t.Errorf("score %v, want %v", hits[0].flScore, flWant)
+	}
+}
+
+func TestBM25RemoveAndFilter(t *testing.T) {
+	idx := newTestBM25(map[string]string{
+		"a": "error E1234 in module",
+		"b": "error E1234 again",
+		"c": "all fine",
+	})
+
+	hits := idx.Search("e1234", 10, func(szID string) bool { return szID != "a" })
+	if fmt.Sprint(hitIDs(hits)) != "[b]" {
+		t.Errorf("filtered hits %v, want [b]", hitIDs(hits))
+	}
+
+	idx.Remove("b", "error E1234 again")
+	if hits := idx.Search("e1234", 10, acceptAll); fmt.Sprint(hitIDs(hits)) != "[a]" {
+		t.Errorf("hits after remove %v, want [a]", hitIDs(hits))
+	}
+	if idx.inTotalLength != len(tokenizeKeywords("error E1234 in module"))+len(tokenizeKeywords("all fine")) {
+		t.Errorf("total length %d not updated on remove", idx.inTotalLength)
+	}
+
+	if hits := idx.Search("e1234 module", 1, acceptAll); len(hits) != 1 {
+		t.Errorf("got %d hits, want top 1", len(hits))
+	}
+}
+
+func TestTokenizeKeywords(t *testing.T) {
+	tests := []struct {
+		szText string
+		wantTerms []string
+	}{
+		{"Hello, World!", []string{"hello", "world"}},
+		{"user_id", []string{"user_id", "user", "id"}},
+		{"see ./docs/setup.md.", []string{"see", "docs/setup.md", "docs", "setup", "md"}},
+		{"--flag", []string{"flag"}},
+		{"Größe 42", []string{"größe", "42"}},
+	}
+
+	for _, tt := range tests {
+		if gotTerms := tokenizeKeywords(tt.szText); fmt.Sprint(gotTerms) != fmt.Sprint(tt.wantTerms) {
+			t.Errorf("tokenizeKeywords(%q) = %q, want %q", tt.szText, gotTerms, tt.wantTerms)
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrNotFound = errors.New("memory not found")
+
+// matchesFilter reports whether every key of filterMap has the given value
+// in the entry's metadata.
+func matchesFilter(mem MemoryEntry, filterMap map[string]string) bool {
+	for szKey, szValue := range filterMap {
+		if mem.MetadataMap[szKey] != szValue {
+			return false
+		}
+	}
+	return true
+}
+
+// ListMemories pages through the memories matching filterMap, newest
+// first, and returns the page with the number of matches.
+func (memoryMgr *MemoryManager) ListMemories(filterMap map[string]string, inOffset int, inLimit int) ([]MemoryEntry, int) {
+	memoryMgr.mu.RLock()
+	defer memoryMgr.mu.RUnlock()
+
+	page := []MemoryEntry{}
+	inTotal := 0
+	for i := len(memoryMgr.memories) - 1; i >= 0; i-- {
+		mem := memoryMgr.memories[i]
+		if !matchesFilter(mem, filterMap) {
+			continue
+		}
+		if inTotal >= inOffset && len(page) < inLimit {
+			page = append(page, mem)
+		}
+		inTotal++
+	}
+	return page, inTotal
+}
+
+// SearchMemories ranks the memories matching filterMap against szQuery the
+// way chat retrieval does and returns up to inTopK with their FlScore set.
+func (memoryMgr *MemoryManager) SearchMemories(ctx context.Context, szQuery string, inTopK int, filterMap map[string]string) ([]MemoryEntry, error) {
+	queryVector, err := memoryMgr.embedder.EmbedText(ctx, szQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	memoryMgr.mu.RLock()
+	scores := memoryMgr.rankCandidates(queryVector, szQuery, max(inTopK*10, 50), filterMap["type"])
+	memoryMgr.mu.RUnlock()
+
+	results := []MemoryEntry{}
+	for _, scored := range scores {
+		if !matchesFilter(scored.memory, filterMap) {
+			continue
+		}
+		result := scored.memory
+		result.FlScore = scored.score
+		results = append(results, result)
+		if len(results) == inTopK {
+			break
+		}
+	}
+	return results, nil
+}
+
+func (memoryMgr *MemoryManager) GetMemory(szID string) (MemoryEntry, error) {
+	memoryMgr.mu.RLock()
+	defer memoryMgr.mu.RUnlock()
+
+	pos, exists := memoryMgr.positionMap[szID]
+	if !exists {
+		return MemoryEntry{}, ErrNotFound
+	}
+	return memoryMgr.memories[pos], nil
+}
+
+// UpdateMemory replaces the content of a memory and embeds it again. Parent
+// sections, which have no vector, stay without one.
+func (memoryMgr *MemoryManager) UpdateMemory(ctx context.Context, szID string, szContent string) (MemoryEntry, error) {
+	existing, err := memoryMgr.GetMemory(szID)
+	if err != nil {
+		return MemoryEntry{}, err
+	}
+
+	var vector []float32
+	if len(existing.FlVector) > 0 {
+		if vector, err = memoryMgr.embedder.EmbedText(ctx, szContent); err != nil {
+			return MemoryEntry{}, fmt.Errorf("failed to embed memory: %w", err)
+		}
+	}
+
+	memoryMgr.mu.Lock()
+	defer memoryMgr.mu.Unlock()
+
+	pos, exists := memoryMgr.positionMap[szID]
+	if !exists {
+		return MemoryEntry{}, ErrNotFound
+	}
+
+	old := memoryMgr.memories[pos]
+	updated := old
+	updated.SzContent = szContent
+	if vector != nil {
+		updated.FlVector = vector
+		updated.MetadataMap = memoryMgr.stampVector(old.MetadataMap, vector)
+	}
+
+	if memoryMgr.searchable(old) {
+		if memoryMgr.keywordIndex != nil {
+			memoryMgr.keywordIndex.Remove(old.SzId, old.SzContent)
+		}
+		if memoryMgr.annIndex != nil {
+			memoryMgr.annIndex.Remove(old.SzId)
+		}
+	}
+	memoryMgr.memories[pos] = updated
+	memoryMgr.indexSearchable(updated)
+
+	if err := memoryMgr.backend.Persist(memoryMgr.memories, []MemoryEntry{updated}, nil); err != nil {
+		return MemoryEntry{}, fmt.Errorf("failed to persist memory: %w", err)
+	}
+	return updated, nil
+}
+
+func (memoryMgr *MemoryManager) DeleteMemory(szID string) error {
+	inDeleted, err := memoryMgr.deleteWhere(func(mem MemoryEntry) bool {
+		return mem.SzId == szID
+	})
+	if err != nil {
+		return err
+	}
+	if inDeleted == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// DeleteMemoriesByFilter deletes every memory matching all of filterMap and
+// returns how many went. An empty filter matches nothing.
+func (memoryMgr *MemoryManager) DeleteMemoriesByFilter(filterMap map[string]string) (int, error) {
+	if len(filterMap) == 0 {
+		return 0, nil
+	}
+	return memoryMgr.deleteWhere(func(mem MemoryEntry) bool {
+		return matchesFilter(mem, filterMap)
+	})
+}
+
+// deleteWhere drops the memories bMatch selects, unlinks the memories that
+// pointed to them and persists both.
+func (memoryMgr *MemoryManager) deleteWhere(bMatch func(mem MemoryEntry) bool) (int, error) {
+	memoryMgr.mu.Lock()
+	defer memoryMgr.mu.Unlock()
+
+	filteredMemoryList := make([]MemoryEntry, 0, len(memoryMgr.memories))
+	var deleted []MemoryEntry
+	var deletedIDs []string
+	for _, memory := range memoryMgr.memories {
+		if !bMatch(memory) {
+			filteredMemoryList = append(filteredMemoryList, memory)
+		} else {
+			deleted = append(deleted, memory)
+			deletedIDs = append(deletedIDs, memory.SzId)
+		}
+	}
+
+	if len(deletedIDs) == 0 {
+		return 0, nil
+	}
+
+	memoryMgr.memories = filteredMemoryList
+	memoryMgr.unindexEntries(deleted)
+	unlinked := memoryMgr.unlinkDeleted(deleted)
+	if err := memoryMgr.backend.Persist(memoryMgr.memories, unlinked, deletedIDs); err != nil {
+		return len(deletedIDs), fmt.Errorf("failed to persist deletion: %w", err)
+	}
+
+	return len(deletedIDs), nil
+}
+
+// unlinkDeleted clears the links the remaining memories hold to deleted
+// ones and returns those it changed: chunks lose their parent section, the
+// other half of an exchange its exchange id, and memories archived under a
+// deleted summary become conversation memories again. A summary forgets
+// the deleted memories it replaced. Callers must hold the write lock.
+func (memoryMgr *MemoryManager) unlinkDeleted(deleted []MemoryEntry) []MemoryEntry {
+	deletedMap := make(map[string]bool, len(deleted))
+	exchangeMap := make(map[string]bool)
+	for _, mem := range deleted {
+		deletedMap[mem.SzId] = true
+		if szExchangeID := mem.MetadataMap[MetadataExchangeID]; szExchangeID != "" {
+			exchangeMap[szExchangeID] = true
+		}
+	}
+
+	var changed []MemoryEntry
+	for i, mem := range memoryMgr.memories {
+		metadataMap := unlinkMetadata(mem.MetadataMap, deletedMap, exchangeMap)
+		if metadataMap == nil {
+			continue
+		}
+		mem.MetadataMap = metadataMap
+		memoryMgr.memories[i] = mem
+		changed = append(changed, mem)
+	}
+	return changed
+}
+
+// unlinkMetadata returns a copy of metadataMap without its links to deleted
+// memories, or nil when it has none.
+func unlinkMetadata(metadataMap map[string]string, deletedMap map[string]bool, exchangeMap map[string]bool) map[string]string {
+	bParent := deletedMap[metadataMap[MetadataParentID]]
+	bExchange := exchangeMap[metadataMap[MetadataExchangeID]]
+	bSummary := deletedMap[metadataMap[MetadataSummaryID]]
+
+	var keptIDs []string
+	bSummarized := false
+	if szIDs := metadataMap[MetadataSummarizedIDs]; szIDs != "" {
+		for _, szID := range strings.Split(szIDs, ",") {
+			if deletedMap[szID] {
+				bSummarized = true
+			} else {
+				keptIDs = append(keptIDs, szID)
+			}
+		}
+	}
+
+	if !bParent && !bExchange && !bSummary && !bSummarized {
+		return nil
+	}
+
+	unlinked := make(map[string]string, len(metadataMap))
+	for szKey, szValue := range metadataMap {
+		unlinked[szKey] = szValue
+	}
+	if bParent {
+		delete(unlinked, MetadataParentID)
+	}
+	if bExchange {
+		delete(unlinked, MetadataExchangeID)
+	}
+	if bSummary {
+		delete(unlinked, MetadataSummaryID)
+		if unlinked["type"] == TypeArchived {
+			unlinked["type"] = TypeConversation
+		}
+	}
+	if bSummarized {
+		unlinked[MetadataSummarizedIDs] = strings.Join(keptIDs, ",")
+	}
+	return unlinked
+}
@@ -0,0 +1,59 @@
+package memory
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestDeleteUnlinks(t *testing.T) {
+	tests := []struct {
+		szName string
+		szDelete string
+		szCheck string
+		wantMap map[string]string
+	}{
+		{szName: "parent section", szDelete: "section", szCheck: "chunk", wantMap: map[string]string{"type": TypeDocument}},
+		{szName: "half of an exchange", szDelete: "question", szCheck: "answer", wantMap: map[string]string{"type": TypeConversation, "role": RoleAssistant}},
+		{szName: "summary", szDelete: "summary", szCheck: "first", wantMap: map[string]string{"type": TypeConversation}},
+		{szName: "summarized memory", szDelete: "first", szCheck: "summary", wantMap: map[string]string{"type": TypeConversation, "role": RoleSummary, MetadataSummarizedIDs: "second"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.szName, func(t *testing.T) {
+			stored := []MemoryEntry{
+				{SzId: "section", SzContent: "whole section", MetadataMap: map[string]string{"type": TypeDocumentParent}},
+				storedEntry("chunk", "part of it", []float32{1, 0}, map[string]string{"type": TypeDocument, MetadataParentID: "section"}),
+				storedEntry("question", "Which flour?", []float32{0, 1}, map[string]string{"type": TypeConversation, "role": RoleUser, MetadataExchangeID: "exc"}),
+				storedEntry("answer", "Rye.", []float32{0, 1}, map[string]string{"type": TypeConversation, "role": RoleAssistant, MetadataExchangeID: "exc"}),
+				storedEntry("first", "Bakes rye.", []float32{1, 1}, map[string]string{"type": TypeArchived, MetadataSummaryID: "summary"}),
+				storedEntry("second", "Bakes on Sundays.", []float32{1, 1}, map[string]string{"type": TypeArchived, MetadataSummaryID: "summary"}),
+				storedEntry("summary", "Rye baker.", []float32{1, 1}, map[string]string{"type": TypeConversation, "role": RoleSummary, MetadataSummarizedIDs: "first,second"}),
+			}
+			memoryMgr, backend := newTestManager(&fakeEmbedder{szModel: "test"}, stored, ConsolidationOptions{})
+
+			if err := memoryMgr.DeleteMemory(tt.szDelete); err != nil {
+				t.Fatalf("DeleteMemory: %v", err)
+			}
+
+			checked, err := memoryMgr.GetMemory(tt.szCheck)
+			if err != nil {
+				t.Fatalf("GetMemory(%q): %v", tt.szCheck, err)
+			}
+			tt.wantMap[MetadataEmbedModel] = "test"
+			if fmt.Sprint(checked.MetadataMap) != fmt.Sprint(tt.wantMap) {
+				t.Errorf("%s metadata %v, want %v", tt.szCheck, checked.MetadataMap, tt.wantMap)
+			}
+
+			for _, persisted := range backend.entries {
+				if persisted.SzId == tt.szCheck && fmt.Sprint(persisted.MetadataMap) != fmt.Sprint(tt.wantMap) {
+					t.Errorf("persisted %s metadata %v, want %v", tt.szCheck, persisted.MetadataMap, tt.wantMap)
+				}
+			}
+			for _, original := range stored {
+				if original.SzId == tt.szCheck && fmt.Sprint(original.MetadataMap) == fmt.Sprint(tt.wantMap) {
+					t.Errorf("stored entry %s was changed in place", tt.szCheck)
+				}
+			}
+		})
+	}
+}
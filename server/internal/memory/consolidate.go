@@ -0,0 +1,410 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// TypeArchived marks conversation memories replaced by a summary. They
+	// are kept so the summary can link back to them, but no longer match
+	// the conversation type.
+	TypeArchived = "conversation_archived"
+
+	RoleSummary = "summary"
+
+	// MetadataSummarizedIDs lists the ids a summary replaced, comma
+	// separated, and MetadataSummaryID points each of them to the summary.
+	MetadataSummarizedIDs = "summarized_ids"
+	MetadataSummaryID = "summary_id"
+)
+
+const (
+	DefaultClusterThreshold = 0.8
+	DefaultMinClusterSize = 2
+)
+
+// ConsolidationOptions keep conversation memories from piling up. A new
+// memory whose cosine similarity to a stored one of the same type is above
+// FlDedupThreshold is not saved; documents are never skipped and 0 turns
+// it off. Every TmInterval, conversation memories older than TmMinAge are
+// clustered by similarity and each cluster of at least InMinClusterSize
+// is replaced by one summary; a zero TmMinAge turns that off.
+type ConsolidationOptions struct {
+	FlDedupThreshold float64
+	TmMinAge time.Duration
+	TmInterval time.Duration
+	FlClusterThreshold float64
+	InMinClusterSize int
+}
+
+func (options ConsolidationOptions) clusterThreshold() float64 {
+	if options.FlClusterThreshold <= 0 {
+		return DefaultClusterThreshold
+	}
+	return options.FlClusterThreshold
+}
+
+func (options ConsolidationOptions) minClusterSize() int {
+	if options.InMinClusterSize < 2 {
+		return DefaultMinClusterSize
+	}
+	return options.InMinClusterSize
+}
+
+// consolidationUnit is what gets clustered: a single memory, or both
+// halves of an exchange so they are summarized together.
+type consolidationUnit struct {
+	ids []string
+	szText string
+	vector []float32
+	tmCreated time.Time
+}
+
+// isDuplicate reports whether mem is too close to a stored memory of the
+// same type, asking the ANN graph once it is large enough and scanning the
+// memories otherwise. Callers must hold the lock, a read lock is enough.
+func (memoryMgr *MemoryManager) isDuplicate(mem MemoryEntry) bool {
+	if !memoryMgr.deduplicates(mem) {
+		return false
+	}
+	flThreshold := memoryMgr.consolidation.FlDedupThreshold
+	szType := mem.MetadataMap["type"]
+
+	if nearest := memoryMgr.searchApproximate(mem.FlVector, 1, szType); nearest != nil {
+		return nearest[0].score > flThreshold
+	}
+
+	for _, stored := range memoryMgr.memories {
+		if stored.MetadataMap["type"] != szType || !memoryMgr.searchable(stored) {
+			continue
+		}
+		if cosineSimilarity(stored.FlVector, mem.FlVector) > flThreshold {
+			return true
+		}
+	}
+	return false
+}
+
+// deduplicates reports whether mem is checked for duplicates at all.
+// Documents are never skipped.
+func (memoryMgr *MemoryManager) deduplicates(mem MemoryEntry) bool {
+	szType := mem.MetadataMap["type"]
+	return memoryMgr.consolidation.FlDedupThreshold > 0 && len(mem.FlVector) > 0 && szType != TypeDocument && szType != TypeDocumentParent
+}
+
+// findDuplicates runs isDuplicate for each entry under the read lock, so
+// saving does not hold up searches while it looks. It also returns the
+// index change count the answers hold for.
+func (memoryMgr *MemoryManager) findDuplicates(entries []MemoryEntry) ([]bool, int) {
+	duplicateList := make([]bool, len(entries))
+
+	memoryMgr.mu.RLock()
+	defer memoryMgr.mu.RUnlock()
+
+	if memoryMgr.consolidation.FlDedupThreshold <= 0 {
+		return duplicateList, memoryMgr.inIndexChanges
+	}
+
+	for i, entry := range entries {
+		duplicateList[i] = memoryMgr.isDuplicate(entry)
+	}
+	return duplicateList, memoryMgr.inIndexChanges
+}
+
+// skipDuplicates clears the ids of entries saved together and reports
+// true when every one of them is a duplicate.
+func skipDuplicates(entries []MemoryEntry, duplicateList []bool) bool {
+	for _, bDuplicate := range duplicateList {
+		if !bDuplicate {
+			return false
+		}
+	}
+	for i := range entries {
+		entries[i].SzId = ""
+	}
+	return true
+}
+
+// duplicatesBatch reports whether mem is too close to one saved earlier in
+// the same batch, which findDuplicates could not see yet.
+func (memoryMgr *MemoryManager) duplicatesBatch(mem MemoryEntry, batch []MemoryEntry) bool {
+	if !memoryMgr.deduplicates(mem) {
+		return false
+	}
+	for _, earlier := range batch {
+		if earlier.MetadataMap["type"] == mem.MetadataMap["type"] && cosineSimilarity(earlier.FlVector, mem.FlVector) > memoryMgr.consolidation.FlDedupThreshold {
+			return true
+		}
+	}
+	return false
+}
+
+// StartConsolidation runs Consolidate every TmInterval until
+// StopConsolidation. It does nothing without a summarizer or a TmMinAge.
+func (memoryMgr *MemoryManager) StartConsolidation(summarizer SummarizerInterface) {
+	if summarizer == nil || memoryMgr.consolidation.TmMinAge <= 0 || memoryMgr.consolidation.TmInterval <= 0 {
+		return
+	}
+
+	memoryMgr.consolidateTicker = time.NewTicker(memoryMgr.consolidation.TmInterval)
+	memoryMgr.stopChan = make(chan struct{})
+
+	go memoryMgr.consolidateLoop(summarizer, memoryMgr.consolidateTicker, memoryMgr.stopChan)
+
+	log.Printf("Memory consolidation started, every %v for memories older than %v\n", memoryMgr.consolidation.TmInterval, memoryMgr.consolidation.TmMinAge)
+}
+
+func (memoryMgr *MemoryManager) StopConsolidation() {
+	if memoryMgr.consolidateTicker != nil {
+		memoryMgr.consolidateTicker.Stop()
+		close(memoryMgr.stopChan)
+		memoryMgr.consolidateTicker = nil
+		log.Println("Memory consolidation stopped")
+	}
+}
+
+func (memoryMgr *MemoryManager) consolidateLoop(summarizer SummarizerInterface, ticker *time.Ticker, stopChan chan struct{}) {
+	// Stopping also cancels a pass waiting on the model.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-stopChan
+		cancel()
+	}()
+
+	for {
+		select {
+		case <-ticker.C:
+			inConsolidated, err := memoryMgr.Consolidate(ctx, summarizer)
+			if err != nil {
+				log.Printf("Memory consolidation error: %v\n", err)
+			}
+			if inConsolidated > 0 {
+				log.Printf("Consolidated %d clusters of old memories\n", inConsolidated)
+			}
+		case <-stopChan:
+			return
+		}
+	}
+}
+
+// Consolidate clusters the conversation memories older than TmMinAge and
+// replaces each large enough cluster with one summary memory written by
+// summarizer. The originals are archived with a link to the summary,
+// which lists their ids. It returns the number of clusters replaced.
+func (memoryMgr *MemoryManager) Consolidate(ctx context.Context, summarizer SummarizerInterface) (int, error) {
+	if memoryMgr.consolidation.TmMinAge <= 0 {
+		return 0, nil
+	}
+
+	clusters := memoryMgr.clusterUnits(memoryMgr.collectUnits(time.Now().Add(-memoryMgr.consolidation.TmMinAge)))
+
+	inConsolidated := 0
+	for _, cluster := range clusters {
+		texts := make([]string, len(cluster))
+		var ids []string
+		for i, unit := range cluster {
+			texts[i] = unit.szText
+			ids = append(ids, unit.ids...)
+		}
+
+		szSummary, err := summarizer.Summarize(ctx, texts)
+		if err != nil {
+			return inConsolidated, fmt.Errorf("failed to summarize %d memories: %w", len(ids), err)
+		}
+		if strings.TrimSpace(szSummary) == "" {
+			continue
+		}
+
+		vector, err := memoryMgr.embedder.EmbedText(ctx, szSummary)
+		if err != nil {
+			return inConsolidated, fmt.Errorf("failed to embed summary: %w", err)
+		}
+
+		bReplaced, err := memoryMgr.replaceWithSummary(ids, szSummary, vector)
+		if err != nil {
+			return inConsolidated, fmt.Errorf("failed to persist summary: %w", err)
+		}
+		if bReplaced {
+			inConsolidated++
+		}
+	}
+
+	return inConsolidated, nil
+}
+
+// collectUnits gathers the conversation memories saved before tmCutoff,
+// oldest first. Summaries are left alone.
+func (memoryMgr *MemoryManager) collectUnits(tmCutoff time.Time) []consolidationUnit {
+	memoryMgr.mu.RLock()
+	defer memoryMgr.mu.RUnlock()
+
+	var units []consolidationUnit
+	exchangeMap := make(map[string][]MemoryEntry)
+	var exchangeIDs []string
+
+	for _, mem := range memoryMgr.memories {
+		if mem.MetadataMap["type"] != TypeConversation || mem.MetadataMap["role"] == RoleSummary || !memoryMgr.searchable(mem) {
+			continue
+		}
+		tmCreated, err := time.Parse(time.RFC3339, mem.MetadataMap["timestamp"])
+		if err != nil || !tmCreated.Before(tmCutoff) {
+			continue
+		}
+
+		if szExchangeID := mem.MetadataMap[MetadataExchangeID]; szExchangeID != "" {
+			if _, exists := exchangeMap[szExchangeID]; !exists {
+				exchangeIDs = append(exchangeIDs, szExchangeID)
+			}
+			exchangeMap[szExchangeID] = append(exchangeMap[szExchangeID], mem)
+			continue
+		}
+
+		units = append(units, consolidationUnit{
+			ids: []string{mem.SzId},
+			szText: mem.SzContent,
+			vector: mem.FlVector,
+			tmCreated: tmCreated,
+		})
+	}
+
+	for _, szExchangeID := range exchangeIDs {
+		units = append(units, exchangeUnit(exchangeMap[szExchangeID]))
+	}
+
+	sort.SliceStable(units, func(i, j int) bool {
+		return units[i].tmCreated.Before(units[j].tmCreated)
+	})
+
+	return units
+}
+
+// exchangeUnit joins the halves of an exchange, question first, and sums
+// their vectors.
+func exchangeUnit(halves []MemoryEntry) consolidationUnit {
+	var unit consolidationUnit
+	var textList []string
+
+	for _, role := range []string{RoleUser, RoleAssistant} {
+		for _, mem := range halves {
+			if mem.MetadataMap["role"] != role {
+				continue
+			}
+			szLabel := "Q: "
+			if role == RoleAssistant {
+				szLabel = "A: "
+			}
+			textList = append(textList, szLabel+mem.SzContent)
+			unit.ids = append(unit.ids, mem.SzId)
+			unit.vector = addVector(unit.vector, mem.FlVector)
+			if tmCreated, err := time.Parse(time.RFC3339, mem.MetadataMap["timestamp"]); err == nil {
+				unit.tmCreated = tmCreated
+			}
+		}
+	}
+	unit.szText = strings.Join(textList, "\n")
+
+	return unit
+}
+
+// clusterUnits groups units greedily: each unit not yet taken starts a
+// cluster and pulls in every later unit close enough to the cluster's
+// centroid. Clusters below the minimum size are dropped.
+func (memoryMgr *MemoryManager) clusterUnits(units []consolidationUnit) [][]consolidationUnit {
+	flThreshold := memoryMgr.consolidation.clusterThreshold()
+	inMinSize := memoryMgr.consolidation.minClusterSize()
+
+	var clusters [][]consolidationUnit
+	takenList := make([]bool, len(units))
+
+	for i := range units {
+		if takenList[i] {
+			continue
+		}
+		takenList[i] = true
+		cluster := []consolidationUnit{units[i]}
+		centroid := addVector(nil, units[i].vector)
+
+		for j := i + 1; j < len(units); j++ {
+			if takenList[j] || cosineSimilarity(centroid, units[j].vector) <= flThreshold {
+				continue
+			}
+			takenList[j] = true
+			cluster = append(cluster, units[j])
+			centroid = addVector(centroid, units[j].vector)
+		}
+
+		if len(cluster) >= inMinSize {
+			clusters = append(clusters, cluster)
+		}
+	}
+
+	return clusters
+}
+
+// addVector returns sum + vector; a nil sum starts a new one.
+func addVector(sum []float32, vector []float32) []float32 {
+	if sum == nil {
+		return append([]float32(nil), vector...)
+	}
+	if len(sum) != len(vector) {
+		return sum
+	}
+	for i := range vector {
+		sum[i] += vector[i]
+	}
+	return sum
+}
+
+// replaceWithSummary stores the summary and archives the memories it
+// replaces. Nothing changes if any of them was deleted or archived while
+// the summary was written.
+func (memoryMgr *MemoryManager) replaceWithSummary(ids []string, szSummary string, vector []float32) (bool, error) {
+	memoryMgr.mu.Lock()
+	defer memoryMgr.mu.Unlock()
+
+	for _, szID := range ids {
+		pos, exists := memoryMgr.positionMap[szID]
+		if !exists || memoryMgr.memories[pos].MetadataMap["type"] != TypeConversation {
+			return false, nil
+		}
+	}
+
+	summary := MemoryEntry{
+		SzId: generateID(),
+		SzContent: szSummary,
+		FlVector: vector,
+		MetadataMap: memoryMgr.stampVector(map[string]string{
+			"type": TypeConversation,
+			"role": RoleSummary,
+			"timestamp": time.Now().Format(time.RFC3339),
+			MetadataSummarizedIDs: strings.Join(ids, ","),
+		}, vector),
+	}
+	memoryMgr.memories = append(memoryMgr.memories, summary)
+	memoryMgr.indexEntry(summary)
+
+	changed := []MemoryEntry{summary}
+	for _, szID := range ids {
+		pos := memoryMgr.positionMap[szID]
+		archived := memoryMgr.memories[pos]
+
+		metadataMap := make(map[string]string, len(archived.MetadataMap)+1)
+		for szKey, szValue := range archived.MetadataMap {
+			metadataMap[szKey] = szValue
+		}
+		metadataMap["type"] = TypeArchived
+		metadataMap[MetadataSummaryID] = summary.SzId
+		archived.MetadataMap = metadataMap
+
+		memoryMgr.memories[pos] = archived
+		changed = append(changed, archived)
+	}
+
+	return true, memoryMgr.backend.Persist(memoryMgr.memories, changed, nil)
+}
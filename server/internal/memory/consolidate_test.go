@@ -0,0 +1,275 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSummarizer answers with szSummary and remembers the texts it got.
+type fakeSummarizer struct {
+	szSummary string
+	textsList [][]string
+}
+
+func (summarizer *fakeSummarizer) Summarize(ctx context.Context, texts []string) (string, error) {
+	summarizer.textsList = append(summarizer.textsList, texts)
+	return summarizer.szSummary, nil
+}
+
+func storedEntry(szID string, szContent string, vector []float32, metadataMap map[string]string) MemoryEntry {
+	metadataMap[MetadataEmbedModel] = "test"
+	return MemoryEntry{SzId: szID, SzContent: szContent, FlVector: vector, MetadataMap: metadataMap}
+}
+
+func TestDedupThreshold(t *testing.T) {
+	tests := []struct {
+		szName string
+		flThreshold float64
+		szType string
+		vector []float32
+		bWantStored bool
+	}{
+		{szName: "same vector skipped", flThreshold: 0.95, szType: TypeConversation, vector: []float32{1, 0}, bWantStored: false},
+		{szName: "just above threshold skipped", flThreshold: 0.95, szType: TypeConversation, vector: []float32{0.96, 0.28}, bWantStored: false},
+		{szName: "below threshold stored", flThreshold: 0.95, szType: TypeConversation, vector: []float32{0.9, 0.436}, bWantStored: true},
+		{szName: "zero threshold turns it off", flThreshold: 0, szType: TypeConversation, vector: []float32{1, 0}, bWantStored: true},
+		{szName: "other type not compared", flThreshold: 0.95, szType: "note", vector: []float32{1, 0}, bWantStored: true},
+		{szName: "documents never skipped", flThreshold: 0.95, szType: TypeDocument, vector: []float32{1, 0}, bWantStored: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.szName, func(t *testing.T) {
+			embedder := &fakeEmbedder{szModel: "test", vectorMap: map[string][]float32{"new": tt.vector}}
+			stored := []MemoryEntry{
+				storedEntry("conversation", "old", []float32{1, 0}, map[string]string{"type": TypeConversation}),
+				storedEntry("document", "old", []float32{1, 0}, map[string]string{"type": TypeDocument}),
+			}
+			memoryMgr, _ := newTestManager(embedder, stored, ConsolidationOptions{FlDedupThreshold: tt.flThreshold})
+
+			if err := memoryMgr.SaveMemory(context.Background(), "new", map[string]string{"type": tt.szType}); err != nil {
+				t.Fatalf("SaveMemory: %v", err)
+			}
+			if bStored := len(memoryMgr.memories) == 3; bStored != tt.bWantStored {
+				t.Errorf("stored = %v, want %v", bStored, tt.bWantStored)
+			}
+		})
+	}
+}
+
+func TestDedupBatchAndExchange(t *testing.T) {
+	embedder := &fakeEmbedder{szModel: "test", vectorMap: map[string][]float32{
+		"old question": {1, 0, 0},
+		"old answer": {0, 1, 0},
+		"new answer": {0, 0, 1},
+	}}
+	memoryMgr, _ := newTestManager(embedder, nil, ConsolidationOptions{FlDedupThreshold: 0.95})
+	ctx := context.Background()
+
+	// Entries of one batch are compared with each other as well.
+	batch := []MemoryEntry{
+		{SzContent: "old question", MetadataMap: map[string]string{"type": TypeConversation}},
+		{SzContent: "old question", MetadataMap: map[string]string{"type": TypeConversation}},
+	}
+	if err := memoryMgr.SaveMemories(ctx, batch); err != nil {
+		t.Fatalf("SaveMemories: %v", err)
+	}
+	if len(memoryMgr.memories) != 1 || batch[0].SzId == "" || batch[1].SzId != "" {
+		t.Fatalf("stored %d memories with ids %q and %q, want only the first", len(memoryMgr.memories), batch[0].SzId, batch[1].SzId)
+	}
+
+	// Halves of an exchange are kept unless both repeat stored memories.
+	szExchangeID, err := memoryMgr.SaveExchange(ctx, "old question", "old answer", "")
+	if err != nil || szExchangeID == "" {
+		t.Fatalf("SaveExchange with a new answer = %q, %v; want it stored", szExchangeID, err)
+	}
+	if len(memoryMgr.memories) != 3 {
+		t.Fatalf("stored %d memories, want both halves added", len(memoryMgr.memories))
+	}
+
+	szExchangeID, err = memoryMgr.SaveExchange(ctx, "old question", "old answer", "")
+	if err != nil || szExchangeID != "" {
+		t.Fatalf("SaveExchange of a repeated exchange = %q, %v; want it skipped", szExchangeID, err)
+	}
+	if szExchangeID, _ := memoryMgr.SaveExchange(ctx, "old question", "new answer", ""); szExchangeID == "" {
+		t.Error("exchange with a new answer was skipped")
+	}
+	if len(memoryMgr.memories) != 5 {
+		t.Errorf("stored %d memories, want 5", len(memoryMgr.memories))
+	}
+}
+
+// Above minApproximateEntries duplicates are looked up in the ANN graph.
+func TestDedupLargeStore(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	centroids := randomCentroids(rng, benchClusters, benchDimension)
+
+	var stored []MemoryEntry
+	for i, vector := range clusteredVectors(rng, centroids, minApproximateEntries+200) {
+		stored = append(stored, storedEntry(fmt.Sprintf("mem_%d", i), "old", vector, map[string]string{"type": TypeConversation}))
+	}
+
+	fresh := make([]float32, benchDimension)
+	for i := range fresh {
+		fresh[i] = float32(rng.NormFloat64())
+	}
+	embedder := &fakeEmbedder{szModel: "test", vectorMap: map[string][]float32{
+		"repeated": stored[500].FlVector,
+		"fresh": fresh,
+	}}
+	memoryMgr, _ := newTestManager(embedder, stored, ConsolidationOptions{FlDedupThreshold: 0.95})
+	if memoryMgr.searchApproximate(fresh, 1, TypeConversation) == nil {
+		t.Fatal("store too small for approximate search")
+	}
+
+	ctx := context.Background()
+	for _, szText := range []string{"repeated", "fresh"} {
+		if err := memoryMgr.SaveMemory(ctx, szText, map[string]string{"type": TypeConversation}); err != nil {
+			t.Fatalf("SaveMemory(%q): %v", szText, err)
+		}
+	}
+	if len(memoryMgr.memories) != len(stored)+1 || memoryMgr.memories[len(stored)].SzContent != "fresh" {
+		t.Errorf("stored %d memories, want only the fresh one added", len(memoryMgr.memories)-len(stored))
+	}
+}
+
+func TestClusterUnits(t *testing.T) {
+	units := []consolidationUnit{
+		{ids: []string{"a"}, vector: []float32{1, 0}},
+		{ids: []string{"c"}, vector: []float32{0, 1}},
+		{ids: []string{"b"}, vector: []float32{0.95, 0.31}},
+		{ids: []string{"e"}, vector: []float32{-1, 0}},
+		{ids: []string{"d"}, vector: []float32{0.1, 0.99}},
+		{ids: []string{"f"}, vector: []float32{0.75, -0.66}},
+	}
+
+	tests := []struct {
+		szName string
+		options ConsolidationOptions
+		szWant string
+	}{
+		{szName: "defaults", options: ConsolidationOptions{}, szWant: "[[a b] [c d]]"},
+		{szName: "loose threshold", options: ConsolidationOptions{FlClusterThreshold: 0.6}, szWant: "[[a b f] [c d]]"},
+		{szName: "tight threshold", options: ConsolidationOptions{FlClusterThreshold: 0.99}, szWant: "[[c d]]"},
+		{szName: "minimum size", options: ConsolidationOptions{InMinClusterSize: 3}, szWant: "[]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.szName, func(t *testing.T) {
+			memoryMgr := &MemoryManager{consolidation: tt.options}
+
+			var clusterIDs [][]string
+			for _, cluster := range memoryMgr.clusterUnits(units) {
+				var ids []string
+				for _, unit := range cluster {
+					ids = append(ids, unit.ids...)
+				}
+				clusterIDs = append(clusterIDs, ids)
+			}
+			if szGot := fmt.Sprint(clusterIDs); szGot != tt.szWant {
+				t.Errorf("clusters %s, want %s", szGot, tt.szWant)
+			}
+		})
+	}
+}
+
+func TestConsolidate(t *testing.T) {
+	szOld := time.Now().Add(-48 * time.Hour).Format(time.RFC3339)
+	szRecent := time.Now().Format(time.RFC3339)
+	conversation := func(szTimestamp string, extraMap map[string]string) map[string]string {
+		metadataMap := map[string]string{"type": TypeConversation, "timestamp": szTimestamp}
+		for szKey, szValue := range extraMap {
+			metadataMap[szKey] = szValue
+		}
+		return metadataMap
+	}
+
+	stored := []MemoryEntry{
+		storedEntry("question", "Which flour for rye?", []float32{1, 0.1}, conversation(szOld, map[string]string{"role": RoleUser, MetadataExchangeID: "exc"})),
+		storedEntry("answer", "Dark rye flour.", []float32{1, 0}, conversation(szOld, map[string]string{"role": RoleAssistant, MetadataExchangeID: "exc"})),
+		storedEntry("note", "User bakes rye bread.", []float32{0.9, 0.2}, conversation(szOld, nil)),
+		storedEntry("unrelated", "User likes jazz.", []float32{0, 1}, conversation(szOld, nil)),
+		storedEntry("recent", "User bakes rye on Sundays.", []float32{1, 0.1}, conversation(szRecent, nil)),
+	}
+	embedder := &fakeEmbedder{szModel: "test", vectorMap: map[string][]float32{"Rye baker.": {1, 0.05}}}
+	memoryMgr, backend := newTestManager(embedder, stored, ConsolidationOptions{TmMinAge: 24 * time.Hour})
+	summarizer := &fakeSummarizer{szSummary: "Rye baker."}
+
+	inConsolidated, err := memoryMgr.Consolidate(context.Background(), summarizer)
+	if err != nil {
+		t.Fatalf("Consolidate: %v", err)
+	}
+	if inConsolidated != 1 {
+		t.Fatalf("consolidated %d clusters, want 1", inConsolidated)
+	}
+
+	if len(summarizer.textsList) != 1 {
+		t.Fatalf("summarizer called %d times, want once", len(summarizer.textsList))
+	}
+	szTexts := strings.Join(summarizer.textsList[0], "|")
+	if szTexts != "Q: Which flour for rye?\nA: Dark rye flour.|User bakes rye bread." && szTexts != "User bakes rye bread.|Q: Which flour for rye?\nA: Dark rye flour." {
+		t.Errorf("summarized %q, want the exchange and the note", szTexts)
+	}
+
+	summary := memoryMgr.memories[len(memoryMgr.memories)-1]
+	if summary.SzContent != "Rye baker." || summary.MetadataMap["role"] != RoleSummary || summary.MetadataMap["type"] != TypeConversation {
+		t.Fatalf("last memory %+v, want the summary", summary)
+	}
+	if szIDs := summary.MetadataMap[MetadataSummarizedIDs]; len(strings.Split(szIDs, ",")) != 3 {
+		t.Errorf("summary replaced %q, want the three old rye memories", szIDs)
+	}
+
+	for _, szID := range []string{"question", "answer", "note"} {
+		archived, err := memoryMgr.GetMemory(szID)
+		if err != nil {
+			t.Fatalf("GetMemory(%q): %v", szID, err)
+		}
+		if archived.MetadataMap["type"] != TypeArchived || archived.MetadataMap[MetadataSummaryID] != summary.SzId {
+			t.Errorf("%s metadata %v, want it archived under the summary", szID, archived.MetadataMap)
+		}
+	}
+	for _, szID := range []string{"unrelated", "recent"} {
+		if kept, _ := memoryMgr.GetMemory(szID); kept.MetadataMap["type"] != TypeConversation {
+			t.Errorf("%s was archived", szID)
+		}
+	}
+	if len(backend.entries) != len(stored)+1 {
+		t.Errorf("persisted %d memories, want %d", len(backend.entries), len(stored)+1)
+	}
+
+	// Archived memories and summaries are not consolidated again.
+	if inConsolidated, err := memoryMgr.Consolidate(context.Background(), summarizer); err != nil || inConsolidated != 0 {
+		t.Errorf("second pass consolidated %d, %v; want nothing", inConsolidated, err)
+	}
+}
+
+// Saves racing each other still store a repeated memory only once, even
+// when all of them looked for duplicates before any was stored.
+func TestDedupConcurrentSaves(t *testing.T) {
+	embedder := &fakeEmbedder{szModel: "test", vectorMap: map[string][]float32{"same": {1, 0}}}
+	memoryMgr, _ := newTestManager(embedder, nil, ConsolidationOptions{FlDedupThreshold: 0.95})
+
+	// Holding the lock lines the saves up so their checks run together.
+	memoryMgr.mu.Lock()
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := memoryMgr.SaveMemory(context.Background(), "same", map[string]string{"type": TypeConversation}); err != nil {
+				t.Errorf("SaveMemory: %v", err)
+			}
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	memoryMgr.mu.Unlock()
+	wg.Wait()
+
+	if len(memoryMgr.memories) != 1 {
+		t.Errorf("stored %d memories, want 1", len(memoryMgr.memories))
+	}
+}
@@ -0,0 +1,115 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	TypeConversation = "conversation"
+
+	RoleUser = "user"
+	RoleAssistant = "assistant"
+
+	// MetadataExchangeID links a question to the answer it got, and
+	// MetadataSessionID to the session they were asked in, if any.
+	MetadataExchangeID = "exchange_id"
+	MetadataSessionID = "session_id"
+)
+
+var exchangeSequence uint64
+
+// SaveExchange stores a question and its answer as two conversation
+// memories sharing an exchange id, embedded in one batch, and returns the
+// id. Both are searchable; ResolveExchanges brings the other half back.
+// An exchange whose question and answer both repeat stored memories is
+// not saved and the id is empty.
+func (memoryMgr *MemoryManager) SaveExchange(ctx context.Context, szQuestion string, szAnswer string, szSessionID string) (string, error) {
+	szExchangeID := fmt.Sprintf("exc_%d_%d", time.Now().UnixNano(), atomic.AddUint64(&exchangeSequence, 1))
+	szTimestamp := time.Now().Format(time.RFC3339)
+
+	newMetadata := func(szRole string) map[string]string {
+		metadataMap := map[string]string{
+			"type": TypeConversation,
+			"role": szRole,
+			"timestamp": szTimestamp,
+			MetadataExchangeID: szExchangeID,
+		}
+		if szSessionID != "" {
+			metadataMap[MetadataSessionID] = szSessionID
+		}
+		return metadataMap
+	}
+
+	entries := []MemoryEntry{
+		{SzContent: szQuestion, MetadataMap: newMetadata(RoleUser)},
+		{SzContent: szAnswer, MetadataMap: newMetadata(RoleAssistant)},
+	}
+	if err := memoryMgr.embedEntries(ctx, entries); err != nil {
+		return "", fmt.Errorf("failed to save exchange: %w", err)
+	}
+
+	bStored, err := memoryMgr.storeEntries(entries, true)
+	if err != nil {
+		return "", fmt.Errorf("failed to save exchange: %w", err)
+	}
+	if !bStored {
+		return "", nil
+	}
+
+	return szExchangeID, nil
+}
+
+// ResolveExchanges expands every memory that belongs to an exchange into
+// the whole exchange, question first, at the position and with the score
+// of its best ranked half. Each exchange is returned once; other entries
+// are returned unchanged.
+func (memoryMgr *MemoryManager) ResolveExchanges(entries []MemoryEntry) []MemoryEntry {
+	memoryMgr.mu.RLock()
+	defer memoryMgr.mu.RUnlock()
+
+	wantedMap := make(map[string]bool)
+	for _, entry := range entries {
+		if szExchangeID := entry.MetadataMap[MetadataExchangeID]; szExchangeID != "" {
+			wantedMap[szExchangeID] = true
+		}
+	}
+	if len(wantedMap) == 0 {
+		return entries
+	}
+
+	exchangeMap := make(map[string][]MemoryEntry, len(wantedMap))
+	for _, mem := range memoryMgr.memories {
+		if szExchangeID := mem.MetadataMap[MetadataExchangeID]; wantedMap[szExchangeID] {
+			exchangeMap[szExchangeID] = append(exchangeMap[szExchangeID], mem)
+		}
+	}
+
+	resolved := make([]MemoryEntry, 0, len(entries)+len(wantedMap))
+	seenMap := make(map[string]bool, len(entries))
+
+	for _, entry := range entries {
+		szExchangeID := entry.MetadataMap[MetadataExchangeID]
+		if szExchangeID == "" {
+			resolved = append(resolved, entry)
+			continue
+		}
+		if seenMap[szExchangeID] {
+			continue
+		}
+		seenMap[szExchangeID] = true
+
+		for _, role := range []string{RoleUser, RoleAssistant} {
+			for _, mem := range exchangeMap[szExchangeID] {
+				if mem.MetadataMap["role"] == role {
+					mem.FlScore = entry.FlScore
+					resolved = append(resolved, mem)
+				}
+			}
+		}
+	}
+
+	return resolved
+}
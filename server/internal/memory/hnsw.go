@@ -0,0 +1,469 @@
+package memory
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+)
+
+const (
+	DefaultHNSWNeighbors = 16
+	DefaultHNSWEfConstruction = 100
+	DefaultHNSWEfSearch = 64
+)
+
+// SearchHit is a single approximate nearest neighbour result. FlScore is the
+// cosine similarity between the query and the stored vector.
+type SearchHit struct {
+	SzId string
+	FlScore float64
+}
+
+type hnswNode struct {
+	szId string
+	vector []float32
+	neighbors [][]int
+	bDeleted bool
+}
+
+// HNSWIndex is an in-process Hierarchical Navigable Small World graph over
+// normalized vectors. It is not safe for concurrent writes; MemoryManager
+// guards it with its own lock. Removed vectors stay in the graph as
+// tombstones to keep it navigable until Rebuild is called.
+type HNSWIndex struct {
+	inNeighbors int
+	inMaxNeighbors0 int
+	inEfConstruction int
+	inEfSearch int
+	flLevelMult float64
+
+	nodes []*hnswNode
+	idMap map[string]int
+	inEntryPoint int
+	inMaxLevel int
+	inDimension int
+	inDeleted int
+	rng *rand.Rand
+}
+
+func NewHNSWIndex(inNeighbors int, inEfConstruction int, inEfSearch int) *HNSWIndex {
+	if inNeighbors < 2 {
+		inNeighbors = DefaultHNSWNeighbors
+	}
+	if inEfConstruction < inNeighbors {
+		inEfConstruction = DefaultHNSWEfConstruction
+	}
+	if inEfSearch <= 0 {
+		inEfSearch = DefaultHNSWEfSearch
+	}
+
+	return &HNSWIndex{
+		inNeighbors: inNeighbors,
+		inMaxNeighbors0: inNeighbors * 2,
+		inEfConstruction: inEfConstruction,
+		inEfSearch: inEfSearch,
+		flLevelMult: 1 / math.Log(float64(inNeighbors)),
+		idMap: make(map[string]int),
+		inEntryPoint: -1,
+		rng: rand.New(rand.NewSource(42)),
+	}
+}
+
+func (idx *HNSWIndex) Len() int {
+	return len(idx.idMap)
+}
+
+func (idx *HNSWIndex) Dimension() int {
+	return idx.inDimension
+}
+
+// Add inserts a vector. Vectors whose dimension differs from the first one
+// added are rejected and false is returned.
+func (idx *HNSWIndex) Add(szId string, vector []float32) bool {
+	if len(vector) == 0 {
+		return false
+	}
+	if idx.inDimension == 0 {
+		idx.inDimension = len(vector)
+	}
+	if len(vector) != idx.inDimension {
+		return false
+	}
+
+	if _, exists := idx.idMap[szId]; exists {
+		idx.Remove(szId)
+	}
+
+	normalized := normalizeVector(vector)
+	inLevel := int(math.Floor(-math.Log(1-idx.rng.Float64()) * idx.flLevelMult))
+
+	node := &hnswNode{
+		szId: szId,
+		vector: normalized,
+		neighbors: make([][]int, inLevel+1),
+	}
+	inNode := len(idx.nodes)
+	idx.nodes = append(idx.nodes, node)
+	idx.idMap[szId] = inNode
+
+	if idx.inEntryPoint < 0 {
+		idx.inEntryPoint = inNode
+		idx.inMaxLevel = inLevel
+		return true
+	}
+
+	inCurrent := idx.inEntryPoint
+	for inLayer := idx.inMaxLevel; inLayer > inLevel; inLayer-- {
+		inCurrent = idx.greedyClosest(normalized, inCurrent, inLayer)
+	}
+
+	entryPoints := []int{inCurrent}
+	for inLayer := min(inLevel, idx.inMaxLevel); inLayer >= 0; inLayer-- {
+		candidates := idx.searchLayer(normalized, entryPoints, idx.inEfConstruction, inLayer)
+		neighbors := idx.selectNeighbors(candidates, idx.maxNeighbors(inLayer))
+		node.neighbors[inLayer] = neighbors
+
+		for _, inNeighbor := range neighbors {
+			idx.connect(inNeighbor, inNode, inLayer)
+		}
+
+		entryPoints = entryPoints[:0]
+		for _, candidate := range candidates {
+			entryPoints = append(entryPoints, candidate.inNode)
+		}
+	}
+
+	if inLevel > idx.inMaxLevel {
+		idx.inMaxLevel = inLevel
+		idx.inEntryPoint = inNode
+	}
+
+	return true
+}
+
+func (idx *HNSWIndex) Remove(szId string) {
+	inNode, exists := idx.idMap[szId]
+	if !exists {
+		return
+	}
+
+	idx.nodes[inNode].bDeleted = true
+	delete(idx.idMap, szId)
+	idx.inDeleted++
+}
+
+// NeedsRebuild reports whether tombstones make up most of the graph.
+func (idx *HNSWIndex) NeedsRebuild() bool {
+	return idx.inDeleted > 64 && idx.inDeleted > len(idx.idMap)
+}
+
+// Rebuild re-inserts all live vectors into a fresh graph.
+func (idx *HNSWIndex) Rebuild() {
+	live := make([]*hnswNode, 0, len(idx.idMap))
+	for _, node := range idx.nodes {
+		if !node.bDeleted {
+			live = append(live, node)
+		}
+	}
+
+	idx.nodes = nil
+	idx.idMap = make(map[string]int, len(live))
+	idx.inEntryPoint = -1
+	idx.inMaxLevel = 0
+	idx.inDeleted = 0
+	idx.inDimension = 0
+
+	for _, node := range live {
+		idx.Add(node.szId, node.vector)
+	}
+}
+
+// Search returns up to iTopK live vectors closest to the query, best first.
+// inEf controls the breadth of the search and is raised to iTopK if lower.
+func (idx *HNSWIndex) Search(query []float32, iTopK int, inEf int) []SearchHit {
+	if idx.inEntryPoint < 0 || len(query) != idx.inDimension || iTopK <= 0 {
+		return nil
+	}
+
+	if inEf < idx.inEfSearch {
+		inEf = idx.inEfSearch
+	}
+	if inEf < iTopK {
+		inEf = iTopK
+	}
+
+	normalized := normalizeVector(query)
+
+	inCurrent := idx.inEntryPoint
+	for inLayer := idx.inMaxLevel; inLayer > 0; inLayer-- {
+		inCurrent = idx.greedyClosest(normalized, inCurrent, inLayer)
+	}
+
+	candidates := idx.searchLayer(normalized, []int{inCurrent}, inEf, 0)
+
+	hits := make([]SearchHit, 0, iTopK)
+	for _, candidate := range candidates {
+		node := idx.nodes[candidate.inNode]
+		if node.bDeleted {
+			continue
+		}
+		hits = append(hits, SearchHit{SzId: node.szId, FlScore: 1 - candidate.flDistance})
+		if len(hits) == iTopK {
+			break
+		}
+	}
+
+	return hits
+}
+
+type hnswCandidate struct {
+	inNode int
+	flDistance float64
+}
+
+func (idx *HNSWIndex) maxNeighbors(inLayer int) int {
+	if inLayer == 0 {
+		return idx.inMaxNeighbors0
+	}
+	return idx.inNeighbors
+}
+
+func (idx *HNSWIndex) distance(a []float32, inNode int) float64 {
+	return 1 - dotProduct(a, idx.nodes[inNode].vector)
+}
+
+func (idx *HNSWIndex) greedyClosest(query []float32, inStart int, inLayer int) int {
+	inCurrent := inStart
+	flCurrent := idx.distance(query, inCurrent)
+
+	for bChanged := true; bChanged; {
+		bChanged = false
+		for _, inNeighbor := range idx.nodes[inCurrent].neighbors[inLayer] {
+			flDistance := idx.distance(query, inNeighbor)
+			if flDistance < flCurrent {
+				inCurrent = inNeighbor
+				flCurrent = flDistance
+				bChanged = true
+			}
+		}
+	}
+
+	return inCurrent
+}
+
+// searchLayer is the beam search of the HNSW paper. It returns up to inEf
+// candidates sorted by ascending distance, tombstones included.
+func (idx *HNSWIndex) searchLayer(query []float32, entryPoints []int, inEf int, inLayer int) []hnswCandidate {
+	visited := make(map[int]struct{}, inEf*4)
+	toVisit := &candidateHeap{bMax: false}
+	found := &candidateHeap{bMax: true}
+
+	for _, inEntry := range entryPoints {
+		if _, seen := visited[inEntry]; seen {
+			continue
+		}
+		visited[inEntry] = struct{}{}
+		candidate := hnswCandidate{inNode: inEntry, flDistance: idx.distance(query, inEntry)}
+		toVisit.push(candidate)
+		found.push(candidate)
+		if found.len() > inEf {
+			found.pop()
+		}
+	}
+
+	for toVisit.len() > 0 {
+		closest := toVisit.pop()
+		if found.len() >= inEf && closest.flDistance > found.peek().flDistance {
+			break
+		}
+
+		node := idx.nodes[closest.inNode]
+		if inLayer >= len(node.neighbors) {
+			continue
+		}
+
+		for _, inNeighbor := range node.neighbors[inLayer] {
+			if _, seen := visited[inNeighbor]; seen {
+				continue
+			}
+			visited[inNeighbor] = struct{}{}
+
+			flDistance := idx.distance(query, inNeighbor)
+			if found.len() < inEf || flDistance < found.peek().flDistance {
+				candidate := hnswCandidate{inNode: inNeighbor, flDistance: flDistance}
+				toVisit.push(candidate)
+				found.push(candidate)
+				if found.len() > inEf {
+					found.pop()
+				}
+			}
+		}
+	}
+
+	results := found.items
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].flDistance < results[j].flDistance
+	})
+
+	return results
+}
+
+// selectNeighbors applies the diversity heuristic: a candidate is kept only
+// if it is closer to the query than to any neighbour kept so far. Remaining
+// slots are filled with the closest pruned candidates.
+func (idx *HNSWIndex) selectNeighbors(candidates []hnswCandidate, inMax int) []int {
+	selected := make([]int, 0, inMax)
+	var pruned []int
+
+	for _, candidate := range candidates {
+		if len(selected) >= inMax {
+			break
+		}
+
+		bKeep := true
+		for _, inSelected := range selected {
+			if 1-dotProduct(idx.nodes[candidate.inNode].vector, idx.nodes[inSelected].vector) < candidate.flDistance {
+				bKeep = false
+				break
+			}
+		}
+
+		if bKeep {
+			selected = append(selected, candidate.inNode)
+		} else {
+			pruned = append(pruned, candidate.inNode)
+		}
+	}
+
+	for _, inNode := range pruned {
+		if len(selected) >= inMax {
+			break
+		}
+		selected = append(selected, inNode)
+	}
+
+	return selected
+}
+
+func (idx *HNSWIndex) connect(inFrom int, inTo int, inLayer int) {
+	node := idx.nodes[inFrom]
+	node.neighbors[inLayer] = append(node.neighbors[inLayer], inTo)
+
+	// Lists may overflow by half before being pruned back so that the
+	// pruning cost is paid once per several insertions instead of each one.
+	inMax := idx.maxNeighbors(inLayer)
+	if len(node.neighbors[inLayer]) <= inMax+inMax/2 {
+		return
+	}
+
+	candidates := make([]hnswCandidate, 0, len(node.neighbors[inLayer]))
+	for _, inNeighbor := range node.neighbors[inLayer] {
+		candidates = append(candidates, hnswCandidate{
+			inNode: inNeighbor,
+			flDistance: idx.distance(node.vector, inNeighbor),
+		})
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].flDistance < candidates[j].flDistance
+	})
+
+	node.neighbors[inLayer] = idx.selectNeighbors(candidates, inMax)
+}
+
+type candidateHeap struct {
+	items []hnswCandidate
+	bMax bool
+}
+
+func (h *candidateHeap) len() int {
+	return len(h.items)
+}
+
+func (h *candidateHeap) less(i, j int) bool {
+	if h.bMax {
+		return h.items[i].flDistance > h.items[j].flDistance
+	}
+	return h.items[i].flDistance < h.items[j].flDistance
+}
+
+func (h *candidateHeap) peek() hnswCandidate {
+	return h.items[0]
+}
+
+func (h *candidateHeap) push(candidate hnswCandidate) {
+	h.items = append(h.items, candidate)
+	i := len(h.items) - 1
+	for i > 0 {
+		parent := (i - 1) / 2
+		if !h.less(i, parent) {
+			break
+		}
+		h.items[i], h.items[parent] = h.items[parent], h.items[i]
+		i = parent
+	}
+}
+
+func (h *candidateHeap) pop() hnswCandidate {
+	top := h.items[0]
+	last := len(h.items) - 1
+	h.items[0] = h.items[last]
+	h.items = h.items[:last]
+
+	i := 0
+	for {
+		left, right := 2*i+1, 2*i+2
+		smallest := i
+		if left < len(h.items) && h.less(left, smallest) {
+			smallest = left
+		}
+		if right < len(h.items) && h.less(right, smallest) {
+			smallest = right
+		}
+		if smallest == i {
+			break
+		}
+		h.items[i], h.items[smallest] = h.items[smallest], h.items[i]
+		i = smallest
+	}
+
+	return top
+}
+
+func normalizeVector(vector []float32) []float32 {
+	var flNorm float64
+	for _, value := range vector {
+		flNorm += float64(value) * float64(value)
+	}
+
+	normalized := make([]float32, len(vector))
+	if flNorm == 0 {
+		return normalized
+	}
+
+	flNorm = math.Sqrt(flNorm)
+	for i, value := range vector {
+		normalized[i] = float32(float64(value) / flNorm)
+	}
+
+	return normalized
+}
+
+// dotProduct accumulates in float32 across four lanes; the inputs are unit
+// vectors so the precision is sufficient for ranking.
+func dotProduct(a, b []float32) float64 {
+	b = b[:len(a)]
+	var fl0, fl1, fl2, fl3 float32
+
+	i := 0
+	for ; i+4 <= len(a); i += 4 {
+		fl0 += a[i] * b[i]
+		fl1 += a[i+1] * b[i+1]
+		fl2 += a[i+2] * b[i+2]
+		fl3 += a[i+3] * b[i+3]
+	}
+	for ; i < len(a); i++ {
+		fl0 += a[i] * b[i]
+	}
+
+	return float64(fl0 + fl1 + fl2 + fl3)
+}
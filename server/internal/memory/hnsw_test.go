@@ -0,0 +1,210 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+const (
+	benchDimension = 64
+	benchClusters = 50
+	benchSpread = 0.35
+)
+
+// clusteredVectors draws vectors around random topic centres, which is
+// closer to real embeddings than uniform noise.
+func clusteredVectors(rng *rand.Rand, centroids [][]float32, inCount int) [][]float32 {
+	vectors := make([][]float32, inCount)
+	for i := range vectors {
+		center := centroids[rng.Intn(len(centroids))]
+		vector := make([]float32, len(center))
+		for j := range vector {
+			vector[j] = center[j] + float32(rng.NormFloat64()*benchSpread)
+		}
+		vectors[i] = vector
+	}
+	return vectors
+}
+
+func randomCentroids(rng *rand.Rand, inCount int, inDimension int) [][]float32 {
+	centroids := make([][]float32, inCount)
+	for i := range centroids {
+		centroids[i] = make([]float32, inDimension)
+		for j := range centroids[i] {
+			centroids[i][j] = float32(rng.NormFloat64())
+		}
+	}
+	return centroids
+}
+
+// newBenchManager returns a manager holding inSize clustered vectors and
+// inQueries query vectors from the same distribution.
+func newBenchManager(tb testing.TB, inSize int, inQueries int) (*MemoryManager, [][]float32) {
+	tb.Helper()
+
+	rng := rand.New(rand.NewSource(1))
+	centroids := randomCentroids(rng, benchClusters, benchDimension)
+
+	memoryMgr := &MemoryManager{szEmbedModel: "test"}
+	for i, vector := range clusteredVectors(rng, centroids, inSize) {
+		memoryMgr.memories = append(memoryMgr.memories, MemoryEntry{
+			SzId: fmt.Sprintf("mem_%d", i),
+			FlVector: vector,
+			MetadataMap: map[string]string{"type": TypeConversation},
+		})
+	}
+	memoryMgr.rebuildSearchIndex()
+
+	return memoryMgr, clusteredVectors(rng, centroids, inQueries)
+}
+
+func TestHNSWRecall(t *testing.T) {
+	const inTopK = 10
+	memoryMgr, queries := newBenchManager(t, 5000, 100)
+
+	inFound := 0
+	for _, query := range queries {
+		approximate := memoryMgr.searchApproximate(query, inTopK, "")
+		if approximate == nil {
+			t.Fatal("approximate search fell back to exact search")
+		}
+
+		truthMap := make(map[string]bool, inTopK)
+		for _, scored := range memoryMgr.searchExact(query, "")[:inTopK] {
+			truthMap[scored.memory.SzId] = true
+		}
+		for _, scored := range approximate {
+			if truthMap[scored.memory.SzId] {
+				inFound++
+			}
+		}
+	}
+
+	flRecall := float64(inFound) / float64(len(queries)*inTopK)
+	t.Logf("recall@%d = %.3f", inTopK, flRecall)
+	if flRecall < 0.95 {
+		t.Errorf("recall@%d = %.3f, want at least 0.95", inTopK, flRecall)
+	}
+}
+
+func TestHNSWRemove(t *testing.T) {
+	memoryMgr, queries := newBenchManager(t, 2000, 1)
+
+	best := memoryMgr.searchExact(queries[0], "")[0].memory.SzId
+	memoryMgr.annIndex.Remove(best)
+
+	for _, hit := range memoryMgr.annIndex.Search(queries[0], 10, 0) {
+		if hit.SzId == best {
+			t.Fatalf("removed vector %s still returned", best)
+		}
+	}
+}
+
+func BenchmarkHNSWSearch(b *testing.B) {
+	for _, inSize := range []int{1000, 10000} {
+		b.Run(fmt.Sprintf("n=%d", inSize), func(b *testing.B) {
+			memoryMgr, queries := newBenchManager(b, inSize, 100)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				memoryMgr.searchApproximate(queries[i%len(queries)], 10, "")
+			}
+		})
+	}
+}
+
+func BenchmarkExactSearch(b *testing.B) {
+	for _, inSize := range []int{1000, 10000} {
+		b.Run(fmt.Sprintf("n=%d", inSize), func(b *testing.B) {
+			memoryMgr, queries := newBenchManager(b, inSize, 100)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				memoryMgr.searchExact(queries[i%len(queries)], "")
+			}
+		})
+	}
+}
+
+// mixedModelEntries returns legacy entries without a model of dimension
+// inLegacyDim followed by entries of the "test" model of dimension
+// inModelDim, all drawn around the same kind of clusters.
+func mixedModelEntries(rng *rand.Rand, inLegacy int, inLegacyDim int, inModel int, inModelDim int) []MemoryEntry {
+	var entries []MemoryEntry
+	for i, vector := range clusteredVectors(rng, randomCentroids(rng, benchClusters, inLegacyDim), inLegacy) {
+		entries = append(entries, MemoryEntry{
+			SzId: fmt.Sprintf("legacy_%d", i),
+			FlVector: vector,
+			MetadataMap: map[string]string{"type": TypeConversation},
+		})
+	}
+	for i, vector := range clusteredVectors(rng, randomCentroids(rng, benchClusters, inModelDim), inModel) {
+		entries = append(entries, MemoryEntry{
+			SzId: fmt.Sprintf("mem_%d", i),
+			FlVector: vector,
+			MetadataMap: map[string]string{"type": TypeConversation, MetadataEmbedModel: "test", MetadataEmbedDim: fmt.Sprint(inModelDim)},
+		})
+	}
+	return entries
+}
+
+func TestHNSWMixedModelStore(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	queries := clusteredVectors(rng, randomCentroids(rng, benchClusters, benchDimension), 10)
+
+	tests := []struct {
+		szName string
+		inLegacy int
+		inModel int
+	}{
+		// The legacy vector comes first and used to fix the dimension.
+		{szName: "one legacy entry first", inLegacy: 1, inModel: 1500},
+		// Even when legacy entries are the majority the model's own
+		// vectors decide.
+		{szName: "legacy majority", inLegacy: 2000, inModel: 1200},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.szName, func(t *testing.T) {
+			memoryMgr := &MemoryManager{szEmbedModel: "test"}
+			memoryMgr.memories = mixedModelEntries(rand.New(rand.NewSource(2)), tt.inLegacy, benchDimension/2, tt.inModel, benchDimension)
+			memoryMgr.rebuildSearchIndex()
+
+			if memoryMgr.annIndex.Dimension() != benchDimension {
+				t.Fatalf("index dimension %d, want %d", memoryMgr.annIndex.Dimension(), benchDimension)
+			}
+			if memoryMgr.annIndex.Len() != tt.inModel {
+				t.Errorf("index holds %d vectors, want %d", memoryMgr.annIndex.Len(), tt.inModel)
+			}
+			for _, query := range queries {
+				if memoryMgr.searchApproximate(query, 10, "") == nil {
+					t.Fatal("approximate search fell back to exact search")
+				}
+			}
+		})
+	}
+}
+
+func TestHNSWDimensionFollowsModel(t *testing.T) {
+	embedder := &fakeEmbedder{szModel: "test", vectorMap: map[string][]float32{
+		"new": make([]float32, benchDimension),
+	}}
+	embedder.vectorMap["new"][0] = 1
+
+	// A store of legacy vectors only sizes the graph for them, until the
+	// first vector of the configured model arrives.
+	memoryMgr, _ := newTestManager(embedder, mixedModelEntries(rand.New(rand.NewSource(3)), 50, benchDimension/2, 0, 0), ConsolidationOptions{})
+	if memoryMgr.annIndex.Dimension() != benchDimension/2 {
+		t.Fatalf("index dimension %d, want %d", memoryMgr.annIndex.Dimension(), benchDimension/2)
+	}
+
+	if err := memoryMgr.SaveMemory(context.Background(), "new", map[string]string{"type": TypeConversation}); err != nil {
+		t.Fatalf("SaveMemory: %v", err)
+	}
+	if memoryMgr.annIndex.Dimension() != benchDimension {
+		t.Errorf("index dimension %d after saving, want %d", memoryMgr.annIndex.Dimension(), benchDimension)
+	}
+	if memoryMgr.annIndex.Len() != 1 {
+		t.Errorf("index holds %d vectors, want the new one only", memoryMgr.annIndex.Len())
+	}
+}
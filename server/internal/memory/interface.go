@@ -4,11 +4,28 @@ import "context"
 
 type MemoryInterface interface {
 	SaveMemory(ctx context.Context, szText string, metadataMap map[string]string) error
+	SaveMemories(ctx context.Context, entries []MemoryEntry) error
+	SaveParentMemories(entries []MemoryEntry) error
+	SaveExchange(ctx context.Context, szQuestion string, szAnswer string, szSessionID string) (string, error)
 	RetrieveRelevantContext(ctx context.Context, szQuery string, iTopK int, szFilterType string) ([]MemoryEntry, error)
+	ResolveParents(entries []MemoryEntry) []MemoryEntry
+	ResolveExchanges(entries []MemoryEntry) []MemoryEntry
+	EmbeddingModel() string
+	ReembedStale(ctx context.Context) (int, error)
+	Consolidate(ctx context.Context, summarizer SummarizerInterface) (int, error)
+	StartConsolidation(summarizer SummarizerInterface)
+	StopConsolidation()
 	LoadFromFile() error
 	SaveToFile() error
 	DeleteMemoriesByMetadata(szKey string, szValue string) error
+	ListMemories(filterMap map[string]string, inOffset int, inLimit int) ([]MemoryEntry, int)
+	SearchMemories(ctx context.Context, szQuery string, inTopK int, filterMap map[string]string) ([]MemoryEntry, error)
+	GetMemory(szID string) (MemoryEntry, error)
+	UpdateMemory(ctx context.Context, szID string, szContent string) (MemoryEntry, error)
+	DeleteMemory(szID string) error
+	DeleteMemoriesByFilter(filterMap map[string]string) (int, error)
 	Reload(szFilename string) error
+	Close() error
 }
 
 type MemoryEntry struct {
@@ -16,4 +33,7 @@ type MemoryEntry struct {
 	SzContent string
 	FlVector []float32
 	MetadataMap map[string]string
+	// FlScore is the retrieval score of an entry returned by
+	// RetrieveRelevantContext; it is not stored.
+	FlScore float64 `json:"-"`
 }
@@ -0,0 +1,339 @@
+package memory
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+const (
+	logOpPut = "put"
+	logOpDelete = "delete"
+
+	// Compaction kicks in once the log holds this many superseded records
+	// and they outnumber the live ones.
+	minCompactionGarbage = 1000
+)
+
+type logRecord struct {
+	SzOp string `json:"op"`
+	SzId string `json:"id,omitempty"`
+	Entry *MemoryEntry `json:"entry,omitempty"`
+}
+
+// appendLogBackend stores memories as an append-only log. Every line is
+// "<crc32> <json record>\n" and is fsynced before the call returns, so a
+// crash can at worst leave a torn final line, which is dropped on open.
+// Corrupt records elsewhere are skipped.
+type appendLogBackend struct {
+	szFilename string
+	file *os.File
+	inRecords int
+}
+
+func newAppendLogBackend() *appendLogBackend {
+	return &appendLogBackend{}
+}
+
+func (logBackend *appendLogBackend) Open(szFilename string) ([]MemoryEntry, error) {
+	logBackend.Close()
+	logBackend.szFilename = szFilename
+	logBackend.inRecords = 0
+
+	entries, inValidOffset, err := logBackend.replay()
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(szFilename)
+	if err == nil && info.Size() > inValidOffset {
+		log.Printf("Memory log %s has a torn tail, truncating %d bytes\n", szFilename, info.Size()-inValidOffset)
+		if err := os.Truncate(szFilename, inValidOffset); err != nil {
+			return nil, fmt.Errorf("failed to truncate memory log: %w", err)
+		}
+	}
+
+	file, err := openLogForAppend(szFilename)
+	if err != nil {
+		return nil, err
+	}
+
+	logBackend.file = file
+	return entries, nil
+}
+
+// replay reads the log and returns the live entries in insertion order and
+// the offset the log is valid up to, which excludes a torn final line.
+func (logBackend *appendLogBackend) replay() ([]MemoryEntry, int64, error) {
+	file, err := os.Open(logBackend.szFilename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []MemoryEntry{}, 0, nil
+		}
+		return nil, 0, err
+	}
+	defer file.Close()
+
+	var entries []MemoryEntry
+	positionMap := make(map[string]int)
+	var inOffset int64
+	var inLineStart int64
+	inCorrupt := 0
+	bLastCorrupt := false
+
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			if len(line) > 0 {
+				bLastCorrupt = false
+			}
+			break
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+
+		inLineStart = inOffset
+		inOffset += int64(len(line))
+		logBackend.inRecords++
+
+		record, ok := decodeLogLine(line)
+		bLastCorrupt = !ok
+		if !ok {
+			inCorrupt++
+			continue
+		}
+
+		switch record.SzOp {
+		case logOpPut:
+			if pos, exists := positionMap[record.Entry.SzId]; exists {
+				entries[pos] = *record.Entry
+			} else {
+				positionMap[record.Entry.SzId] = len(entries)
+				entries = append(entries, *record.Entry)
+			}
+		case logOpDelete:
+			if pos, exists := positionMap[record.SzId]; exists {
+				entries[pos].SzId = ""
+				delete(positionMap, record.SzId)
+			}
+		}
+	}
+
+	// Only the last line can be torn by a crash; it is cut off. A bad
+	// record before it is corruption and skipped, so the records after it
+	// survive.
+	if bLastCorrupt {
+		inOffset = inLineStart
+		inCorrupt--
+		logBackend.inRecords--
+	}
+	if inCorrupt > 0 {
+		log.Printf("Memory log %s has %d corrupt records, skipping them\n", logBackend.szFilename, inCorrupt)
+	}
+
+	liveEntries := make([]MemoryEntry, 0, len(positionMap))
+	for _, entry := range entries {
+		if entry.SzId != "" {
+			liveEntries = append(liveEntries, entry)
+		}
+	}
+
+	return liveEntries, inOffset, nil
+}
+
+func (logBackend *appendLogBackend) Persist(allEntries []MemoryEntry, savedEntries []MemoryEntry, deletedIDs []string) error {
+	if logBackend.file == nil {
+		return fmt.Errorf("memory log %s is not open", logBackend.szFilename)
+	}
+
+	var buf bytes.Buffer
+	for i := range savedEntries {
+		if err := encodeLogLine(&buf, logRecord{SzOp: logOpPut, Entry: &savedEntries[i]}); err != nil {
+			return err
+		}
+	}
+	for _, szId := range deletedIDs {
+		if err := encodeLogLine(&buf, logRecord{SzOp: logOpDelete, SzId: szId}); err != nil {
+			return err
+		}
+	}
+
+	if buf.Len() == 0 {
+		return nil
+	}
+
+	if _, err := logBackend.file.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to append to memory log: %w", err)
+	}
+	if err := logBackend.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync memory log: %w", err)
+	}
+
+	logBackend.inRecords += len(savedEntries) + len(deletedIDs)
+
+	inGarbage := logBackend.inRecords - len(allEntries)
+	if inGarbage >= minCompactionGarbage && inGarbage > len(allEntries) {
+		log.Printf("Compacting memory log %s (%d live, %d records)\n", logBackend.szFilename, len(allEntries), logBackend.inRecords)
+		return logBackend.Snapshot(allEntries)
+	}
+
+	return nil
+}
+
+// Snapshot compacts the log to one put record per live entry. The new log is
+// written and synced next to the old one and then renamed over it.
+func (logBackend *appendLogBackend) Snapshot(allEntries []MemoryEntry) error {
+	szTempFile := logBackend.szFilename + ".compact"
+
+	tempFile, err := os.OpenFile(szTempFile, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriter(tempFile)
+	for i := range allEntries {
+		var buf bytes.Buffer
+		if err := encodeLogLine(&buf, logRecord{SzOp: logOpPut, Entry: &allEntries[i]}); err != nil {
+			tempFile.Close()
+			return err
+		}
+		writer.Write(buf.Bytes())
+	}
+
+	if err := writer.Flush(); err != nil {
+		tempFile.Close()
+		return err
+	}
+	if err := tempFile.Sync(); err != nil {
+		tempFile.Close()
+		return err
+	}
+	if err := tempFile.Close(); err != nil {
+		return err
+	}
+
+	logBackend.Close()
+
+	if err := os.Rename(szTempFile, logBackend.szFilename); err != nil {
+		return fmt.Errorf("failed to replace memory log: %w", err)
+	}
+	syncDir(filepath.Dir(logBackend.szFilename))
+
+	file, err := openLogForAppend(logBackend.szFilename)
+	if err != nil {
+		return err
+	}
+
+	logBackend.file = file
+	logBackend.inRecords = len(allEntries)
+	return nil
+}
+
+func (logBackend *appendLogBackend) Close() error {
+	if logBackend.file == nil {
+		return nil
+	}
+
+	err := logBackend.file.Close()
+	logBackend.file = nil
+	return err
+}
+
+func openLogForAppend(szFilename string) (*os.File, error) {
+	return os.OpenFile(szFilename, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+}
+
+func encodeLogLine(buf *bytes.Buffer, record logRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(buf, "%08x %s\n", crc32.ChecksumIEEE(data), data)
+	return nil
+}
+
+func decodeLogLine(line []byte) (logRecord, bool) {
+	var record logRecord
+
+	line = bytes.TrimSuffix(line, []byte("\n"))
+	if len(line) < 10 || line[8] != ' ' {
+		return record, false
+	}
+
+	var checksum uint32
+	if _, err := fmt.Sscanf(string(line[:8]), "%08x", &checksum); err != nil {
+		return record, false
+	}
+
+	data := line[9:]
+	if crc32.ChecksumIEEE(data) != checksum {
+		return record, false
+	}
+
+	if err := json.Unmarshal(data, &record); err != nil {
+		return record, false
+	}
+
+	if record.SzOp == logOpPut && record.Entry == nil {
+		return record, false
+	}
+
+	return record, true
+}
+
+// syncDir makes a rename durable. Directories cannot be synced on every
+// platform, so failures are ignored.
+func syncDir(szDir string) {
+	dir, err := os.Open(szDir)
+	if err != nil {
+		return
+	}
+	dir.Sync()
+	dir.Close()
+}
+
+// MigrateJSONToLog imports a memory_*.json dump into an append-only log file.
+func MigrateJSONToLog(szJSONFile string, szLogFile string) (int, error) {
+	entries, err := readJSONMemoryFile(szJSONFile)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read %s: %w", szJSONFile, err)
+	}
+
+	logBackend := newAppendLogBackend()
+	existing, err := logBackend.Open(szLogFile)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open %s: %w", szLogFile, err)
+	}
+	defer logBackend.Close()
+
+	seenMap := make(map[string]bool, len(existing))
+	for _, entry := range existing {
+		seenMap[entry.SzId] = true
+	}
+
+	merged := existing
+	inImported := 0
+	for _, entry := range entries {
+		if seenMap[entry.SzId] {
+			continue
+		}
+		seenMap[entry.SzId] = true
+		merged = append(merged, entry)
+		inImported++
+	}
+
+	if err := logBackend.Snapshot(merged); err != nil {
+		return 0, fmt.Errorf("failed to write %s: %w", szLogFile, err)
+	}
+
+	return inImported, nil
+}
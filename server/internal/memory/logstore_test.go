@@ -0,0 +1,257 @@
+package memory
+
+import (
+	"bytes"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func logEntry(szID string, szContent string) MemoryEntry {
+	return MemoryEntry{
+		SzId: szID,
+		SzContent: szContent,
+		FlVector: []float32{1, 0},
+		MetadataMap: map[string]string{"type": "conversation"},
+	}
+}
+
+func openTestLog(t *testing.T, szFilename string) (*appendLogBackend, []MemoryEntry) {
+	t.Helper()
+
+	logBackend := newAppendLogBackend()
+	entries, err := logBackend.Open(szFilename)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Cleanup(func() { logBackend.Close() })
+
+	return logBackend, entries
+}
+
+func entryIDs(entries []MemoryEntry) []string {
+	ids := make([]string, len(entries))
+	for i, entry := range entries {
+		ids[i] = entry.SzId
+	}
+	return ids
+}
+
+func readLogLines(t *testing.T, szFilename string) [][]byte {
+	t.Helper()
+
+	data, err := os.ReadFile(szFilename)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	return bytes.SplitAfter(bytes.TrimSuffix(data, []byte("\n")), []byte("\n"))
+}
+
+func TestAppendLogLineFormat(t *testing.T) {
+	szFilename := filepath.Join(t.TempDir(), "memory.log")
+	logBackend, _ := openTestLog(t, szFilename)
+
+	entries := []MemoryEntry{logEntry("a", "first"), logEntry("b", "second")}
+	if err := logBackend.Persist(entries, entries, nil); err != nil {
+		t.Fatalf("Persist: %v", err)
+	}
+	if err := logBackend.Persist(entries[:1], nil, []string{"b"}); err != nil {
+		t.Fatalf("Persist delete: %v", err)
+	}
+
+	lines := readLogLines(t, szFilename)
+	if len(lines) != 3 {
+		t.Fatalf("got %d lines, want 3", len(lines))
+	}
+	for i, line := range lines {
+		line = bytes.TrimSuffix(line, []byte("\n"))
+		if len(line) < 10 || line[8] != ' ' {
+			t.Fatalf("line %d has no checksum prefix: %q", i, line)
+		}
+		szWant := fmt.Sprintf("%08x", crc32.ChecksumIEEE(line[9:]))
+		if string(line[:8]) != szWant {
+			t.Errorf("line %d checksum %s, want %s", i, line[:8], szWant)
+		}
+	}
+
+	logBackend.Close()
+	_, reopened := openTestLog(t, szFilename)
+	if ids := entryIDs(reopened); len(ids) != 1 || ids[0] != "a" {
+		t.Errorf("reopened ids %v, want [a]", ids)
+	}
+}
+
+func TestAppendLogRecovery(t *testing.T) {
+	tests := []struct {
+		szName string
+		corrupt func(data []byte, lines [][]byte) []byte
+		wantIDs []string
+		inKeptLines int
+	}{
+		{
+			szName: "torn final line",
+			corrupt: func(data []byte, lines [][]byte) []byte {
+				return data[:len(data)-len(lines[2])/2]
+			},
+			wantIDs: []string{"a", "b"},
+			inKeptLines: 2,
+		},
+		{
+			szName: "final line without newline",
+			corrupt: func(data []byte, lines [][]byte) []byte {
+				return data[:len(data)-1]
+			},
+			wantIDs: []string{"a", "b"},
+			inKeptLines: 2,
+		},
+		{
+			szName: "flipped checksum byte in the middle",
+			corrupt: func(data []byte, lines [][]byte) []byte {
+				inOffset := len(lines[0])
+				if data[inOffset] == '0' {
+					data[inOffset] = '1'
+				} else {
+					data[inOffset] = '0'
+				}
+				return data
+			},
+			wantIDs: []string{"a", "c"},
+			inKeptLines: 3,
+		},
+		{
+			szName: "corrupt line before a torn one",
+			corrupt: func(data []byte, lines [][]byte) []byte {
+				data[len(lines[0])] ^= 0x01
+				return data[:len(data)-1]
+			},
+			wantIDs: []string{"a"},
+			inKeptLines: 2,
+		},
+		{
+			szName: "flipped payload byte in the first line",
+			corrupt: func(data []byte, lines [][]byte) []byte {
+				data[12] ^= 0x01
+				return data
+			},
+			wantIDs: []string{"b", "c"},
+			inKeptLines: 3,
+		},
+		{
+			szName: "flipped payload byte",
+			corrupt: func(data []byte, lines [][]byte) []byte {
+				data[len(lines[0])+len(lines[1])+12] ^= 0x01
+				return data
+			},
+			wantIDs: []string{"a", "b"},
+			inKeptLines: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.szName, func(t *testing.T) {
+			szFilename := filepath.Join(t.TempDir(), "memory.log")
+			logBackend, _ := openTestLog(t, szFilename)
+
+			entries := []MemoryEntry{logEntry("a", "first"), logEntry("b", "second"), logEntry("c", "third")}
+			for i := range entries {
+				if err := logBackend.Persist(entries[:i+1], entries[i:i+1], nil); err != nil {
+					t.Fatalf("Persist: %v", err)
+				}
+			}
+			logBackend.Close()
+
+			data, err := os.ReadFile(szFilename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			lines := readLogLines(t, szFilename)
+			if err := os.WriteFile(szFilename, tt.corrupt(data, lines), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			recoveredBackend, recovered := openTestLog(t, szFilename)
+			if ids := entryIDs(recovered); fmt.Sprint(ids) != fmt.Sprint(tt.wantIDs) {
+				t.Fatalf("recovered %v, want %v", ids, tt.wantIDs)
+			}
+
+			// A bad tail is cut off, so new records follow the valid ones;
+			// records after a corrupt one in the middle are kept.
+			var inValid int
+			for _, line := range lines[:tt.inKeptLines] {
+				inValid += len(line)
+			}
+			if tt.inKeptLines == len(lines) {
+				inValid++ // the newline readLogLines trims from the last line
+			}
+			info, err := os.Stat(szFilename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Size() != int64(inValid) {
+				t.Errorf("log size %d after open, want %d", info.Size(), inValid)
+			}
+
+			next := append(recovered, logEntry("d", "fourth"))
+			if err := recoveredBackend.Persist(next, next[len(next)-1:], nil); err != nil {
+				t.Fatalf("Persist after recovery: %v", err)
+			}
+			recoveredBackend.Close()
+
+			_, reopened := openTestLog(t, szFilename)
+			wantIDs := append(append([]string{}, tt.wantIDs...), "d")
+			if ids := entryIDs(reopened); fmt.Sprint(ids) != fmt.Sprint(wantIDs) {
+				t.Errorf("after append %v, want %v", ids, wantIDs)
+			}
+		})
+	}
+}
+
+func TestAppendLogCompaction(t *testing.T) {
+	szFilename := filepath.Join(t.TempDir(), "memory.log")
+	logBackend, _ := openTestLog(t, szFilename)
+
+	live := []MemoryEntry{logEntry("a", "first"), logEntry("b", "second")}
+	if err := logBackend.Persist(live, live, nil); err != nil {
+		t.Fatalf("Persist: %v", err)
+	}
+
+	// Rewriting the same entry piles up superseded records until the log
+	// compacts itself.
+	for i := 0; i < minCompactionGarbage+len(live); i++ {
+		live[0].SzContent = fmt.Sprintf("version %d", i)
+		if err := logBackend.Persist(live, live[:1], nil); err != nil {
+			t.Fatalf("Persist %d: %v", i, err)
+		}
+	}
+
+	if lines := readLogLines(t, szFilename); len(lines) >= minCompactionGarbage {
+		t.Errorf("log has %d lines, expected it to be compacted", len(lines))
+	}
+	if _, err := os.Stat(szFilename + ".compact"); !os.IsNotExist(err) {
+		t.Errorf("temporary compaction file left behind: %v", err)
+	}
+
+	if err := logBackend.Snapshot(live); err != nil {
+		t.Fatalf("Snapshot: %v", err)
+	}
+	if lines := readLogLines(t, szFilename); len(lines) != len(live) {
+		t.Errorf("snapshot has %d lines, want %d", len(lines), len(live))
+	}
+
+	// The compacted log is still appended to.
+	live = append(live, logEntry("c", "third"))
+	if err := logBackend.Persist(live, live[2:], nil); err != nil {
+		t.Fatalf("Persist after compaction: %v", err)
+	}
+	logBackend.Close()
+
+	_, reopened := openTestLog(t, szFilename)
+	if ids := entryIDs(reopened); fmt.Sprint(ids) != "[a b c]" {
+		t.Fatalf("reopened ids %v, want [a b c]", ids)
+	}
+	if reopened[0].SzContent != live[0].SzContent {
+		t.Errorf("content %q, want %q", reopened[0].SzContent, live[0].SzContent)
+	}
+}
@@ -3,20 +3,32 @@ package memory
 import (
 	"chak-server/internal/embedding"
 	"context"
-	"encoding/json"
 	"fmt"
 	"log"
 	"math"
-	"os"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type MemoryManager struct {
 	embedder embedding.EmbeddingInterface
+	backend storageBackend
 	memories []MemoryEntry
+	positionMap map[string]int
+	annIndex *HNSWIndex
+	keywordIndex *bm25Index
+	options RetrievalOptions
+	consolidation ConsolidationOptions
+	consolidateTicker *time.Ticker
+	stopChan chan struct{}
 	mu sync.RWMutex
+	// inIndexChanges counts changes to the search indexes, so a duplicate
+	// check made under the read lock can tell whether it still holds.
+	inIndexChanges int
 	szFilename string
+	szEmbedModel string
 }
 
 type scoredMemory struct {
@@ -24,14 +36,31 @@ type scoredMemory struct {
 	score float64
 }
 
-func NewMemoryManager(embedder embedding.EmbeddingInterface, szFilename string) *MemoryManager {
+func NewMemoryManager(embedder embedding.EmbeddingInterface, szFilename string, options RetrievalOptions, consolidation ConsolidationOptions) *MemoryManager {
+	return newMemoryManagerWithBackend(embedder, newJSONFileBackend(), szFilename, options, consolidation)
+}
+
+// NewLogMemoryManager stores memories in an append-only log instead of
+// rewriting a JSON dump on every change.
+func NewLogMemoryManager(embedder embedding.EmbeddingInterface, szFilename string, options RetrievalOptions, consolidation ConsolidationOptions) *MemoryManager {
+	return newMemoryManagerWithBackend(embedder, newAppendLogBackend(), szFilename, options, consolidation)
+}
+
+func newMemoryManagerWithBackend(embedder embedding.EmbeddingInterface, backend storageBackend, szFilename string, options RetrievalOptions, consolidation ConsolidationOptions) *MemoryManager {
 	manager := &MemoryManager{
 		embedder: embedder,
+		backend: backend,
 		memories: []MemoryEntry{},
+		positionMap: make(map[string]int),
+		options: options,
+		consolidation: consolidation,
 		szFilename: szFilename,
+		szEmbedModel: embedder.ModelName(),
 	}
 	
-	manager.LoadFromFile()
+	if err := manager.LoadFromFile(); err != nil {
+		log.Printf("Failed to load memories from %s: %v\n", szFilename, err)
+	}
 	
 	return manager
 }
@@ -45,42 +74,34 @@ func (memoryMgr *MemoryManager) Reload(szFilename string) error {
 	memoryMgr.szFilename = szFilename
 	memoryMgr.memories = []MemoryEntry{}
 
-	data, err := os.ReadFile(szFilename)
+	memories, err := memoryMgr.backend.Open(szFilename)
 	if err != nil {
-		if os.IsNotExist(err) {
-			log.Printf("No existing memory file, starting fresh\n")
-			return nil
-		}
 		return err
 	}
 
-	err = json.Unmarshal(data, &memoryMgr.memories)
-	if err != nil {
-		return err
-	}
+	memoryMgr.memories = memories
+	memoryMgr.rebuildSearchIndex()
 
 	log.Printf("Reloaded %d memories from %s\n", len(memoryMgr.memories), szFilename)
 	return nil
 }
 
 func (memoryMgr *MemoryManager) LoadFromFile() error {
-	data, err := os.ReadFile(memoryMgr.szFilename)
-	if err != nil {
-		if os.IsNotExist(err) {
-			fmt.Printf("No existing memory file, starting fresh \n")
-			return nil
-		}
-		return err
-	}
-
 	memoryMgr.mu.Lock()
 	defer memoryMgr.mu.Unlock()
 
-	err = json.Unmarshal(data, &memoryMgr.memories)	
+	memories, err := memoryMgr.backend.Open(memoryMgr.szFilename)
 	if err != nil {
 		return err
 	}
 
+	if len(memories) == 0 {
+		fmt.Printf("No existing memories, starting fresh \n")
+	}
+
+	memoryMgr.memories = memories
+	memoryMgr.rebuildSearchIndex()
+
 	fmt.Printf("Loaded %d memories from %s\n", len(memoryMgr.memories), memoryMgr.szFilename)
 	return nil
 }
@@ -89,14 +110,21 @@ func (memoryMgr *MemoryManager) SaveToFile() error {
 	memoryMgr.mu.RLock()
 	defer memoryMgr.mu.RUnlock()
 
-	data, err := json.MarshalIndent(memoryMgr.memories, "", "  ")	
-	if err != nil {
-		return err
-	}
+	return memoryMgr.backend.Snapshot(memoryMgr.memories)
+}
 
-	return os.WriteFile(memoryMgr.szFilename, data, 0644)
+// Close releases the store. Later writes fail with ErrClosed.
+func (memoryMgr *MemoryManager) Close() error {
+	memoryMgr.mu.Lock()
+	defer memoryMgr.mu.Unlock()
+
+	err := memoryMgr.backend.Close()
+	memoryMgr.backend = closedBackend{}
+	return err
 }
 
+// SaveMemory embeds and stores one memory, unless it is a near duplicate
+// of a stored one (see ConsolidationOptions.FlDedupThreshold).
 func (memoryMgr *MemoryManager) SaveMemory(ctx context.Context, szText string, metadataMap map[string]string) error {
 	vector, err := memoryMgr.embedder.EmbedText(ctx, szText)
 	if err != nil {
@@ -104,20 +132,18 @@ func (memoryMgr *MemoryManager) SaveMemory(ctx context.Context, szText string, m
 		return err
 	}
 
-	memoryEntry := MemoryEntry{
+	entries := []MemoryEntry{{
 		SzId: generateID(),
 		SzContent: szText,
 		FlVector: vector,
-		MetadataMap: metadataMap,
-	}
-
-	memoryMgr.mu.Lock()
-	memoryMgr.memories = append(memoryMgr.memories, memoryEntry)
-	memoryMgr.mu.Unlock()
+		MetadataMap: memoryMgr.stampVector(metadataMap, vector),
+	}}
 
-	err = memoryMgr.SaveToFile()
+	bStored, err := memoryMgr.storeEntries(entries, false)
 	if err != nil {
 		fmt.Printf("Error saving to file: %v\n", err)
+	} else if !bStored {
+		fmt.Printf("Skipped near duplicate memory\n\n")
 	} else {
 		fmt.Printf("Saved to file %s\n\n", memoryMgr.szFilename)
 	}
@@ -125,36 +151,101 @@ func (memoryMgr *MemoryManager) SaveMemory(ctx context.Context, szText string, m
 	return nil
 }
 
-func (memoryMgr *MemoryManager) RetrieveRelevantContext(ctx context.Context, szQuery string, iTopK int, szFilterType string) ([]MemoryEntry, error) {
-	queryVector, err := memoryMgr.embedder.EmbedText(ctx, szQuery)
-	if err != nil {
-		return nil, err
+// SaveMemories embeds the contents of the given entries in one batch and
+// stores them with fresh ids, persisting once for the whole batch. The ids,
+// vectors and stamped metadata are written back into entries; near
+// duplicates are not stored and get an empty id.
+func (memoryMgr *MemoryManager) SaveMemories(ctx context.Context, entries []MemoryEntry) error {
+	if len(entries) == 0 {
+		return nil
 	}
 
-	memoryMgr.mu.RLock()
-	scores := make([]scoredMemory, 0, len(memoryMgr.memories))
+	if err := memoryMgr.embedEntries(ctx, entries); err != nil {
+		return err
+	}
 
-	for _, mem := range memoryMgr.memories {
-		if szFilterType != "" && mem.MetadataMap["type"] != szFilterType {
-			continue
+	if _, err := memoryMgr.storeEntries(entries, false); err != nil {
+		return fmt.Errorf("failed to persist batch: %w", err)
+	}
+
+	return nil
+}
+
+// embedEntries embeds the contents of entries in one batch and gives each
+// a fresh id and its stamped metadata.
+func (memoryMgr *MemoryManager) embedEntries(ctx context.Context, entries []MemoryEntry) error {
+	texts := make([]string, len(entries))
+	for i, entry := range entries {
+		texts[i] = entry.SzContent
+	}
+
+	vectors, err := memoryMgr.embedder.EmbedTexts(ctx, texts)
+	if err != nil {
+		return fmt.Errorf("failed to embed batch: %w", err)
+	}
+
+	for i, entry := range entries {
+		entries[i] = MemoryEntry{
+			SzId: generateID(),
+			SzContent: entry.SzContent,
+			FlVector: vectors[i],
+			MetadataMap: memoryMgr.stampVector(entry.MetadataMap, vectors[i]),
 		}
+	}
+
+	return nil
+}
+
+// storeEntries appends embedded entries and persists them once. Near
+// duplicates are dropped one by one, or with bTogether only when all of
+// them are, so that entries belonging together are kept or skipped as a
+// whole. Dropped entries get an empty id; it reports whether any was
+// stored.
+func (memoryMgr *MemoryManager) storeEntries(entries []MemoryEntry, bTogether bool) (bool, error) {
+	duplicateList, inIndexChanges := memoryMgr.findDuplicates(entries)
+	if bTogether && skipDuplicates(entries, duplicateList) {
+		return false, nil
+	}
 
-		similarity := cosineSimilarity(queryVector, mem.FlVector)
+	memoryMgr.mu.Lock()
+	defer memoryMgr.mu.Unlock()
 
-		preview := mem.SzContent
-		if len(preview) > 60 {
-			preview = preview[:60] + "..."
+	// Memories saved between the check and the lock may repeat these.
+	if memoryMgr.inIndexChanges != inIndexChanges {
+		for i, entry := range entries {
+			duplicateList[i] = duplicateList[i] || memoryMgr.isDuplicate(entry)
+		}
+		if bTogether && skipDuplicates(entries, duplicateList) {
+			return false, nil
 		}
+	}
 
-		scores = append(scores, scoredMemory{
-			memory: mem,
-			score: similarity,
-		})
+	stored := make([]MemoryEntry, 0, len(entries))
+	for i, entry := range entries {
+		if !bTogether && (duplicateList[i] || memoryMgr.duplicatesBatch(entry, stored)) {
+			entries[i].SzId = ""
+			continue
+		}
+		memoryMgr.memories = append(memoryMgr.memories, entry)
+		memoryMgr.indexEntry(entry)
+		stored = append(stored, entry)
+	}
+	if len(stored) == 0 {
+		return false, nil
 	}
 
-	memoryMgr.mu.RUnlock()
+	return true, memoryMgr.backend.Persist(memoryMgr.memories, stored, nil)
+}
+
+func (memoryMgr *MemoryManager) RetrieveRelevantContext(ctx context.Context, szQuery string, iTopK int, szFilterType string) ([]MemoryEntry, error) {
+	queryVector, err := memoryMgr.embedder.EmbedText(ctx, szQuery)
+	if err != nil {
+		return nil, err
+	}
 
-	sortByScore(scores)
+	memoryMgr.mu.RLock()
+	scores := memoryMgr.rankCandidates(queryVector, szQuery, max(iTopK*10, 50), szFilterType)
+	memoryMgr.mu.RUnlock()
 
 	topK := iTopK
 	if topK > len(scores) {
@@ -164,16 +255,19 @@ func (memoryMgr *MemoryManager) RetrieveRelevantContext(ctx context.Context, szQ
 	results := make([]MemoryEntry, topK)
 	for i := 0; i < topK; i++ {
 		results[i] = scores[i].memory
-		preview := results[i].SzContent
-		if len(preview) > 80 {
-			preview = preview[:80] + "..."
-		}
+		results[i].FlScore = scores[i].score
 	}
 
 	return results, nil
 }
 
+// cosineSimilarity is 0 for vectors of different dimensions, which come
+// from different embedding models and cannot be compared.
 func cosineSimilarity(a, b []float32) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+
 	var dotProduct, normA, normB float64
 
 	for i := range a {
@@ -190,36 +284,25 @@ func cosineSimilarity(a, b []float32) float64 {
 }
 
 func sortByScore(scores []scoredMemory) {
-	for i := 0; i < len(scores)-1; i++ {
-		for j := 0; j < len(scores)-i-1; j++ {
-			if scores[j].score < scores[j+1].score {
-				scores[j], scores[j+1] = scores [j+1], scores[j]
-			}
-		}
-	}
+	sort.SliceStable(scores, func(i, j int) bool {
+		return scores[i].score > scores[j].score
+	})
 }
 
+var idSequence uint64
+
 func generateID() string {
-	return fmt.Sprintf("mem_%d", time.Now().UnixNano())
+	return fmt.Sprintf("mem_%d_%d", time.Now().UnixNano(), atomic.AddUint64(&idSequence, 1))
 }
 
 func (memoryMgr *MemoryManager) DeleteMemoriesByMetadata(szKey string, szValue string) error {
-	memoryMgr.mu.Lock()
+	inDeleted, err := memoryMgr.deleteWhere(func(mem MemoryEntry) bool {
+		return mem.MetadataMap[szKey] == szValue
+	})
 
-	filteredMemoryList := make([]MemoryEntry, 0, len(memoryMgr.memories))
-	for _, memory := range memoryMgr.memories {
-		if memory.MetadataMap[szKey] != szValue {
-			filteredMemoryList = append(filteredMemoryList, memory)
-		}
-	}
-
-	memoryMgr.memories = filteredMemoryList
-	memoryMgr.mu.Unlock()
-
-	err := memoryMgr.SaveToFile()
 	if err != nil {
 		fmt.Printf("Error saving to file: %v\n", err)
-	} else {
+	} else if inDeleted > 0 {
 		fmt.Printf("Saved to file %s\n\n", memoryMgr.szFilename)
 	}
 
@@ -0,0 +1,74 @@
+package memory
+
+import "fmt"
+
+const (
+	// TypeDocumentParent marks sections stored for parent document
+	// retrieval. They have no vector and never match a query themselves.
+	TypeDocumentParent = "document_parent"
+
+	// MetadataParentID links a child chunk to the section it was cut from.
+	MetadataParentID = "parent_id"
+)
+
+// SaveParentMemories stores sections without embedding them, persisting
+// the whole batch at once, and gives each entry the id that its child
+// chunks reference through MetadataParentID.
+func (memoryMgr *MemoryManager) SaveParentMemories(entries []MemoryEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	for i, entry := range entries {
+		entries[i] = MemoryEntry{
+			SzId: generateID(),
+			SzContent: entry.SzContent,
+			MetadataMap: entry.MetadataMap,
+		}
+	}
+
+	memoryMgr.mu.Lock()
+	for _, entry := range entries {
+		memoryMgr.memories = append(memoryMgr.memories, entry)
+		memoryMgr.indexEntry(entry)
+	}
+	err := memoryMgr.backend.Persist(memoryMgr.memories, entries, nil)
+	memoryMgr.mu.Unlock()
+
+	if err != nil {
+		return fmt.Errorf("failed to persist parent memories: %w", err)
+	}
+
+	return nil
+}
+
+// ResolveParents replaces every child chunk with the parent section it
+// links to, keeping the ranking order. A parent reached through several
+// children is returned once, at the position and with the score of its
+// best child. Entries without a parent, or whose parent is gone, are
+// returned unchanged.
+func (memoryMgr *MemoryManager) ResolveParents(entries []MemoryEntry) []MemoryEntry {
+	memoryMgr.mu.RLock()
+	defer memoryMgr.mu.RUnlock()
+
+	resolved := make([]MemoryEntry, 0, len(entries))
+	seenMap := make(map[string]bool, len(entries))
+
+	for _, entry := range entries {
+		if szParentId := entry.MetadataMap[MetadataParentID]; szParentId != "" {
+			if pos, exists := memoryMgr.positionMap[szParentId]; exists {
+				flScore := entry.FlScore
+				entry = memoryMgr.memories[pos]
+				entry.FlScore = flScore
+			}
+		}
+
+		if seenMap[entry.SzId] {
+			continue
+		}
+		seenMap[entry.SzId] = true
+		resolved = append(resolved, entry)
+	}
+
+	return resolved
+}
@@ -0,0 +1,127 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// fakeEmbedder returns the vector registered for a text.
+type fakeEmbedder struct {
+	szModel string
+	vectorMap map[string][]float32
+}
+
+func (embedder *fakeEmbedder) EmbedText(ctx context.Context, szText string) ([]float32, error) {
+	vector, exists := embedder.vectorMap[szText]
+	if !exists {
+		return nil, fmt.Errorf("no vector for %q", szText)
+	}
+	return vector, nil
+}
+
+func (embedder *fakeEmbedder) EmbedTexts(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	for i, szText := range texts {
+		vector, err := embedder.EmbedText(ctx, szText)
+		if err != nil {
+			return nil, err
+		}
+		vectors[i] = vector
+	}
+	return vectors, nil
+}
+
+func (embedder *fakeEmbedder) ModelName() string {
+	return embedder.szModel
+}
+
+// countingBackend keeps entries in memory and counts how often they are
+// persisted.
+type countingBackend struct {
+	entries []MemoryEntry
+	inPersists int
+}
+
+func (backend *countingBackend) Open(szFilename string) ([]MemoryEntry, error) {
+	return append([]MemoryEntry{}, backend.entries...), nil
+}
+
+func (backend *countingBackend) Persist(allEntries []MemoryEntry, savedEntries []MemoryEntry, deletedIDs []string) error {
+	backend.inPersists++
+	return backend.Snapshot(allEntries)
+}
+
+func (backend *countingBackend) Snapshot(allEntries []MemoryEntry) error {
+	backend.entries = append([]MemoryEntry{}, allEntries...)
+	return nil
+}
+
+func (backend *countingBackend) Close() error {
+	return nil
+}
+
+func newTestManager(embedder *fakeEmbedder, stored []MemoryEntry, consolidation ConsolidationOptions) (*MemoryManager, *countingBackend) {
+	backend := &countingBackend{entries: stored}
+	return newMemoryManagerWithBackend(embedder, backend, "test", RetrievalOptions{}, consolidation), backend
+}
+
+func TestSaveParentMemories(t *testing.T) {
+	embedder := &fakeEmbedder{szModel: "test", vectorMap: map[string][]float32{
+		"first chunk": {1, 0},
+		"second chunk": {0, 1},
+	}}
+	memoryMgr, backend := newTestManager(embedder, nil, ConsolidationOptions{})
+
+	parents := []MemoryEntry{
+		{SzContent: "first section", MetadataMap: map[string]string{"type": TypeDocumentParent}},
+		{SzContent: "second section", MetadataMap: map[string]string{"type": TypeDocumentParent}},
+	}
+	if err := memoryMgr.SaveParentMemories(parents); err != nil {
+		t.Fatalf("SaveParentMemories: %v", err)
+	}
+	if backend.inPersists != 1 {
+		t.Errorf("persisted %d times, want once per batch", backend.inPersists)
+	}
+	if parents[0].SzId == "" || parents[0].SzId == parents[1].SzId {
+		t.Fatalf("ids %q and %q, want distinct ids", parents[0].SzId, parents[1].SzId)
+	}
+
+	children := []MemoryEntry{
+		{SzContent: "first chunk", MetadataMap: map[string]string{"type": TypeDocument, MetadataParentID: parents[0].SzId}},
+		{SzContent: "second chunk", MetadataMap: map[string]string{"type": TypeDocument, MetadataParentID: parents[1].SzId}},
+	}
+	if err := memoryMgr.SaveMemories(context.Background(), children); err != nil {
+		t.Fatalf("SaveMemories: %v", err)
+	}
+
+	results, err := memoryMgr.RetrieveRelevantContext(context.Background(), "second chunk", 1, TypeDocument)
+	if err != nil {
+		t.Fatalf("RetrieveRelevantContext: %v", err)
+	}
+	resolved := memoryMgr.ResolveParents(results)
+	if len(resolved) != 1 || resolved[0].SzContent != "second section" {
+		t.Errorf("resolved %v, want the second section", resolved)
+	}
+}
+
+func TestWritesAfterClose(t *testing.T) {
+	embedder := &fakeEmbedder{szModel: "test", vectorMap: map[string][]float32{"late": {1, 0}}}
+	memoryMgr, backend := newTestManager(embedder, nil, ConsolidationOptions{})
+
+	if err := memoryMgr.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	err := memoryMgr.SaveMemories(context.Background(), []MemoryEntry{{SzContent: "late", MetadataMap: map[string]string{"type": TypeConversation}}})
+	if !errors.Is(err, ErrClosed) {
+		t.Errorf("SaveMemories after Close: %v, want ErrClosed", err)
+	}
+	if err := memoryMgr.SaveParentMemories([]MemoryEntry{{SzContent: "late"}}); !errors.Is(err, ErrClosed) {
+		t.Errorf("SaveParentMemories after Close: %v, want ErrClosed", err)
+	}
+	if backend.inPersists != 0 {
+		t.Errorf("closed store persisted %d times", backend.inPersists)
+	}
+}
@@ -0,0 +1,321 @@
+package memory
+
+// Below this many memories a linear scan is as fast as the graph search.
+const minApproximateEntries = 1000
+
+// Upper bound of the search breadth used while widening a filtered
+// approximate search before falling back to an exact scan.
+const maxFilteredEf = 4096
+
+const (
+	FusionRRF = "rrf"
+	FusionWeighted = "weighted"
+
+	DefaultRRFK = 60
+)
+
+// RetrievalOptions tunes RetrieveRelevantContext. A positive keyword weight
+// enables hybrid retrieval, fusing BM25 keyword scores with cosine scores
+// either by reciprocal rank fusion (the default) or by a weighted sum of
+// min-max normalized scores. A zero vector weight counts as 1.
+type RetrievalOptions struct {
+	BExactSearch bool
+	SzFusion string
+	FlVectorWeight float64
+	FlKeywordWeight float64
+	InRRFK int
+}
+
+func (options RetrievalOptions) hybrid() bool {
+	return options.FlKeywordWeight > 0
+}
+
+func (options RetrievalOptions) vectorWeight() float64 {
+	if options.FlVectorWeight <= 0 {
+		return 1
+	}
+	return options.FlVectorWeight
+}
+
+// rebuildSearchIndex recreates the id lookup and the ANN graph from the
+// current memory list. Callers must hold the write lock.
+func (memoryMgr *MemoryManager) rebuildSearchIndex() {
+	memoryMgr.inIndexChanges++
+	memoryMgr.positionMap = make(map[string]int, len(memoryMgr.memories))
+	memoryMgr.annIndex = nil
+	memoryMgr.keywordIndex = nil
+
+	if !memoryMgr.options.BExactSearch {
+		memoryMgr.annIndex = NewHNSWIndex(DefaultHNSWNeighbors, DefaultHNSWEfConstruction, DefaultHNSWEfSearch)
+	}
+	if memoryMgr.options.hybrid() {
+		memoryMgr.keywordIndex = newBM25Index()
+	}
+
+	// Only vectors of one dimension fit in the graph. Legacy entries of
+	// another model must not decide which, or every search of the current
+	// model would fall back to an exact scan.
+	inDimension := memoryMgr.vectorDimension()
+
+	for i, mem := range memoryMgr.memories {
+		memoryMgr.positionMap[mem.SzId] = i
+		if !memoryMgr.searchable(mem) {
+			continue
+		}
+		if memoryMgr.annIndex != nil && len(mem.FlVector) == inDimension {
+			memoryMgr.annIndex.Add(mem.SzId, mem.FlVector)
+		}
+		if memoryMgr.keywordIndex != nil {
+			memoryMgr.keywordIndex.Add(mem.SzId, mem.SzContent)
+		}
+	}
+}
+
+// vectorDimension returns the most common dimension among the vectors of
+// the configured model, or among all searchable vectors when none was
+// stamped with it yet.
+func (memoryMgr *MemoryManager) vectorDimension() int {
+	modelCountMap := make(map[int]int)
+	anyCountMap := make(map[int]int)
+	inModelDimension, inAnyDimension := 0, 0
+
+	for _, mem := range memoryMgr.memories {
+		if !memoryMgr.searchable(mem) {
+			continue
+		}
+		inLength := len(mem.FlVector)
+
+		anyCountMap[inLength]++
+		if anyCountMap[inLength] > anyCountMap[inAnyDimension] {
+			inAnyDimension = inLength
+		}
+		if mem.MetadataMap[MetadataEmbedModel] == memoryMgr.szEmbedModel {
+			modelCountMap[inLength]++
+			if modelCountMap[inLength] > modelCountMap[inModelDimension] {
+				inModelDimension = inLength
+			}
+		}
+	}
+
+	if inModelDimension > 0 {
+		return inModelDimension
+	}
+	return inAnyDimension
+}
+
+// indexEntry registers an entry that was just appended to the memory list.
+func (memoryMgr *MemoryManager) indexEntry(mem MemoryEntry) {
+	memoryMgr.positionMap[mem.SzId] = len(memoryMgr.memories) - 1
+	memoryMgr.indexSearchable(mem)
+}
+
+// indexSearchable adds an entry already in the memory list to the search
+// indexes. A vector of the configured model that does not fit the graph
+// means the graph was sized from older vectors, so it is built again.
+func (memoryMgr *MemoryManager) indexSearchable(mem MemoryEntry) {
+	if !memoryMgr.searchable(mem) {
+		return
+	}
+	memoryMgr.inIndexChanges++
+	if memoryMgr.annIndex != nil {
+		inDimension := memoryMgr.annIndex.Dimension()
+		if inDimension > 0 && len(mem.FlVector) != inDimension && mem.MetadataMap[MetadataEmbedModel] == memoryMgr.szEmbedModel {
+			memoryMgr.rebuildSearchIndex()
+			return
+		}
+		memoryMgr.annIndex.Add(mem.SzId, mem.FlVector)
+	}
+	if memoryMgr.keywordIndex != nil {
+		memoryMgr.keywordIndex.Add(mem.SzId, mem.SzContent)
+	}
+}
+
+// searchable reports whether an entry takes part in similarity search.
+// Parent sections are stored without a vector and are only reached through
+// their children, and vectors of another embedding model are left out
+// until they are embedded again. Entries saved before the model was
+// recorded are kept.
+func (memoryMgr *MemoryManager) searchable(mem MemoryEntry) bool {
+	if len(mem.FlVector) == 0 {
+		return false
+	}
+	szModel := mem.MetadataMap[MetadataEmbedModel]
+	return szModel == "" || szModel == memoryMgr.szEmbedModel
+}
+
+// unindexEntries drops removed entries after the memory list was filtered.
+func (memoryMgr *MemoryManager) unindexEntries(removed []MemoryEntry) {
+	memoryMgr.positionMap = make(map[string]int, len(memoryMgr.memories))
+	for i, mem := range memoryMgr.memories {
+		memoryMgr.positionMap[mem.SzId] = i
+	}
+
+	if memoryMgr.keywordIndex != nil {
+		for _, mem := range removed {
+			memoryMgr.keywordIndex.Remove(mem.SzId, mem.SzContent)
+		}
+	}
+
+	if memoryMgr.annIndex == nil {
+		return
+	}
+
+	for _, mem := range removed {
+		memoryMgr.annIndex.Remove(mem.SzId)
+	}
+
+	if memoryMgr.annIndex.NeedsRebuild() {
+		memoryMgr.annIndex.Rebuild()
+	}
+}
+
+// rankCandidates returns up to inCandidates memories ordered by relevance,
+// fusing keyword and vector rankings when hybrid retrieval is enabled.
+// Callers must hold the read lock.
+func (memoryMgr *MemoryManager) rankCandidates(queryVector []float32, szQuery string, inCandidates int, szFilterType string) []scoredMemory {
+	vectorScores := memoryMgr.searchApproximate(queryVector, inCandidates, szFilterType)
+	if vectorScores == nil {
+		vectorScores = memoryMgr.searchExact(queryVector, szFilterType)
+	}
+	if len(vectorScores) > inCandidates {
+		vectorScores = vectorScores[:inCandidates]
+	}
+
+	if memoryMgr.keywordIndex == nil {
+		return vectorScores
+	}
+
+	keywordHits := memoryMgr.keywordIndex.Search(szQuery, inCandidates, func(szId string) bool {
+		pos, exists := memoryMgr.positionMap[szId]
+		return exists && (szFilterType == "" || memoryMgr.memories[pos].MetadataMap["type"] == szFilterType)
+	})
+
+	keywordScores := make([]scoredMemory, 0, len(keywordHits))
+	for _, hit := range keywordHits {
+		keywordScores = append(keywordScores, scoredMemory{
+			memory: memoryMgr.memories[memoryMgr.positionMap[hit.szId]],
+			score: hit.flScore,
+		})
+	}
+
+	return fuseScores(vectorScores, keywordScores, memoryMgr.options)
+}
+
+func fuseScores(vectorScores []scoredMemory, keywordScores []scoredMemory, options RetrievalOptions) []scoredMemory {
+	fusedMap := make(map[string]*scoredMemory, len(vectorScores)+len(keywordScores))
+	var order []string
+
+	addScores := func(scores []scoredMemory, flWeight float64) {
+		flMin, flMax := scoreRange(scores)
+
+		for rank, scored := range scores {
+			var flContribution float64
+			if options.SzFusion == FusionWeighted {
+				flContribution = flWeight * normalizeScore(scored.score, flMin, flMax)
+			} else {
+				inK := options.InRRFK
+				if inK <= 0 {
+					inK = DefaultRRFK
+				}
+				flContribution = flWeight / float64(inK+rank+1)
+			}
+
+			fused, exists := fusedMap[scored.memory.SzId]
+			if !exists {
+				fused = &scoredMemory{memory: scored.memory}
+				fusedMap[scored.memory.SzId] = fused
+				order = append(order, scored.memory.SzId)
+			}
+			fused.score += flContribution
+		}
+	}
+
+	addScores(vectorScores, options.vectorWeight())
+	addScores(keywordScores, options.FlKeywordWeight)
+
+	results := make([]scoredMemory, 0, len(order))
+	for _, szId := range order {
+		results = append(results, *fusedMap[szId])
+	}
+
+	sortByScore(results)
+	return results
+}
+
+func scoreRange(scores []scoredMemory) (float64, float64) {
+	if len(scores) == 0 {
+		return 0, 0
+	}
+
+	flMin, flMax := scores[0].score, scores[0].score
+	for _, scored := range scores[1:] {
+		flMin = min(flMin, scored.score)
+		flMax = max(flMax, scored.score)
+	}
+	return flMin, flMax
+}
+
+func normalizeScore(flScore float64, flMin float64, flMax float64) float64 {
+	if flMax == flMin {
+		return 1
+	}
+	return (flScore - flMin) / (flMax - flMin)
+}
+
+func (memoryMgr *MemoryManager) searchExact(queryVector []float32, szFilterType string) []scoredMemory {
+	scores := make([]scoredMemory, 0, len(memoryMgr.memories))
+
+	for _, mem := range memoryMgr.memories {
+		if !memoryMgr.searchable(mem) || len(mem.FlVector) != len(queryVector) || (szFilterType != "" && mem.MetadataMap["type"] != szFilterType) {
+			continue
+		}
+
+		scores = append(scores, scoredMemory{
+			memory: mem,
+			score: cosineSimilarity(queryVector, mem.FlVector),
+		})
+	}
+
+	sortByScore(scores)
+	return scores
+}
+
+// searchApproximate queries the ANN graph, widening the search until enough
+// entries pass the type filter. It returns nil when the caller should fall
+// back to an exact scan.
+func (memoryMgr *MemoryManager) searchApproximate(queryVector []float32, iTopK int, szFilterType string) []scoredMemory {
+	if memoryMgr.annIndex == nil || memoryMgr.annIndex.Len() < minApproximateEntries {
+		return nil
+	}
+	if len(queryVector) != memoryMgr.annIndex.Dimension() {
+		return nil
+	}
+
+	inEf := iTopK * 4
+	for {
+		hits := memoryMgr.annIndex.Search(queryVector, inEf, inEf)
+
+		scores := make([]scoredMemory, 0, iTopK)
+		for _, hit := range hits {
+			pos, exists := memoryMgr.positionMap[hit.SzId]
+			if !exists {
+				continue
+			}
+
+			mem := memoryMgr.memories[pos]
+			if szFilterType != "" && mem.MetadataMap["type"] != szFilterType {
+				continue
+			}
+
+			scores = append(scores, scoredMemory{memory: mem, score: hit.FlScore})
+			if len(scores) == iTopK {
+				return scores
+			}
+		}
+
+		if len(hits) < inEf || inEf >= maxFilteredEf {
+			return nil
+		}
+		inEf *= 4
+	}
+}
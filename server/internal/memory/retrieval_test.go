@@ -0,0 +1,128 @@
+package memory
+
+import (
+	"math"
+	"testing"
+)
+
+func scoredList(pairs ...interface{}) []scoredMemory {
+	var scores []scoredMemory
+	for i := 0; i < len(pairs); i += 2 {
+		scores = append(scores, scoredMemory{
+			memory: MemoryEntry{SzId: pairs[i].(string)},
+			score: pairs[i+1].(float64),
+		})
+	}
+	return scores
+}
+
+func TestFuseScores(t *testing.T) {
+	tests := []struct {
+		szName string
+		vectorScores []scoredMemory
+		keywordScores []scoredMemory
+		options RetrievalOptions
+		wantIDs []string
+		wantScores []float64
+	}{
+		{
+			szName: "rrf sums reciprocal ranks",
+			vectorScores: scoredList("a", 0.9, "b", 0.8, "c", 0.7),
+			keywordScores: scoredList("c", 12.0, "a", 3.0),
+			options: RetrievalOptions{FlKeywordWeight: 1},
+			wantIDs: []string{"a", "c", "b"},
+			wantScores: []float64{1.0/61 + 1.0/62, 1.0/63 + 1.0/61, 1.0 / 62},
+		},
+		{
+			szName: "rrf keyword weight reorders",
+			vectorScores: scoredList("a", 0.9, "b", 0.8, "c", 0.7),
+			keywordScores: scoredList("c", 12.0, "a", 3.0),
+			options: RetrievalOptions{FlKeywordWeight: 2},
+			wantIDs: []string{"c", "a", "b"},
+			wantScores: []float64{1.0/63 + 2.0/61, 1.0/61 + 2.0/62, 1.0 / 62},
+		},
+		{
+			szName: "rrf custom k ignores raw scores",
+			vectorScores: scoredList("a", 0.99, "b", 0.01),
+			keywordScores: scoredList("b", 100.0),
+			options: RetrievalOptions{FlKeywordWeight: 1, InRRFK: 1},
+			wantIDs: []string{"b", "a"},
+			wantScores: []float64{1.0/3 + 1.0/2, 1.0 / 2},
+		},
+		{
+			szName: "weighted min-max normalization",
+			vectorScores: scoredList("a", 0.9, "b", 0.6, "c", 0.1),
+			keywordScores: scoredList("c", 10.0, "a", 5.0),
+			options: RetrievalOptions{SzFusion: FusionWeighted, FlKeywordWeight: 0.8},
+			wantIDs: []string{"a", "c", "b"},
+			wantScores: []float64{1, 0.8, 0.625},
+		},
+		{
+			szName: "weighted vector weight",
+			vectorScores: scoredList("a", 0.9, "b", 0.1),
+			keywordScores: scoredList("b", 4.0, "a", 2.0),
+			options: RetrievalOptions{SzFusion: FusionWeighted, FlVectorWeight: 0.5, FlKeywordWeight: 1},
+			wantIDs: []string{"b", "a"},
+			wantScores: []float64{1, 0.5},
+		},
+		{
+			szName: "weighted equal scores normalize to one",
+			vectorScores: scoredList("a", 0.9, "b", 0.3),
+			keywordScores: scoredList("b", 3.2),
+			options: RetrievalOptions{SzFusion: FusionWeighted, FlKeywordWeight: 1},
+			wantIDs: []string{"a", "b"},
+			wantScores: []float64{1, 1},
+		},
+		{
+			szName: "keyword only hits are kept",
+			vectorScores: nil,
+			keywordScores: scoredList("x", 1.0, "y", 1.0),
+			options: RetrievalOptions{SzFusion: FusionWeighted, FlKeywordWeight: 1},
+			wantIDs: []string{"x", "y"},
+			wantScores: []float64{1, 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.szName, func(t *testing.T) {
+			fused := fuseScores(tt.vectorScores, tt.keywordScores, tt.options)
+			if len(fused) != len(tt.wantIDs) {
+				t.Fatalf("got %d results, want %d", len(fused), len(tt.wantIDs))
+			}
+			for i, scored := range fused {
+				if scored.memory.SzId != tt.wantIDs[i] {
+					t.Errorf("result %d is %s, want %s", i, scored.memory.SzId, tt.wantIDs[i])
+				}
+				if math.Abs(scored.score-tt.wantScores[i]) > 1e-9 {
+					t.Errorf("score of %s is %v, want %v", scored.memory.SzId, scored.score, tt.wantScores[i])
+				}
+			}
+		})
+	}
+}
+
+func TestNormalizeScore(t *testing.T) {
+	tests := []struct {
+		flScore, flMin, flMax float64
+		flWant float64
+	}{
+		{0.5, 0, 1, 0.5},
+		{10, 2, 10, 1},
+		{2, 2, 10, 0},
+		{-1, -3, 1, 0.5},
+		{7, 7, 7, 1},
+	}
+
+	for _, tt := range tests {
+		if flGot := normalizeScore(tt.flScore, tt.flMin, tt.flMax); math.Abs(flGot-tt.flWant) > 1e-9 {
+			t.Errorf("normalizeScore(%v, %v, %v) = %v, want %v", tt.flScore, tt.flMin, tt.flMax, flGot, tt.flWant)
+		}
+	}
+
+	if flMin, flMax := scoreRange(nil); flMin != 0 || flMax != 0 {
+		t.Errorf("scoreRange(nil) = %v, %v, want 0, 0", flMin, flMax)
+	}
+	if flMin, flMax := scoreRange(scoredList("a", 3.0, "b", -1.0, "c", 2.0)); flMin != -1 || flMax != 3 {
+		t.Errorf("scoreRange = %v, %v, want -1, 3", flMin, flMax)
+	}
+}
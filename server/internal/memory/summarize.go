@@ -0,0 +1,50 @@
+package memory
+
+import (
+	"chak-server/internal/ollama"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type SummarizerInterface interface {
+	Summarize(ctx context.Context, texts []string) (string, error)
+}
+
+// LLMSummarizer asks a model served by Ollama to merge related memories
+// into one note.
+type LLMSummarizer struct {
+	ollamaManager ollama.OllamaInterface
+	szModel string
+	tmTimeout time.Duration
+}
+
+func NewLLMSummarizer(ollamaManager ollama.OllamaInterface, szModel string, tmTimeout time.Duration) *LLMSummarizer {
+	return &LLMSummarizer{
+		ollamaManager: ollamaManager,
+		szModel: szModel,
+		tmTimeout: tmTimeout,
+	}
+}
+
+func (llmSummarizer *LLMSummarizer) Summarize(ctx context.Context, texts []string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, llmSummarizer.tmTimeout)
+	defer cancel()
+
+	var sbPrompt strings.Builder
+	sbPrompt.WriteString("These are notes kept from earlier conversations with the same user. " +
+		"Merge them into one short note that keeps every fact, preference and decision they contain, " +
+		"without repeating anything. Reply with the note only.\n\n")
+	for i, szText := range texts {
+		fmt.Fprintf(&sbPrompt, "Note %d:\n%s\n\n", i+1, szText)
+	}
+	sbPrompt.WriteString("Merged note:")
+
+	resp, err := llmSummarizer.ollamaManager.Generate(ctx, llmSummarizer.szModel, sbPrompt.String())
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(resp.SzResponse), nil
+}
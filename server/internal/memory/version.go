@@ -0,0 +1,106 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+)
+
+const (
+	// TypeDocument marks chunks the indexer cut from files. The indexer
+	// chunks and embeds them again itself when its versions change.
+	TypeDocument = "document"
+
+	// MetadataEmbedModel and MetadataEmbedDim record the model that
+	// produced an entry's vector and its dimension.
+	MetadataEmbedModel = "embed_model"
+	MetadataEmbedDim = "embed_dim"
+)
+
+// Memories are embedded again in batches of this size.
+const reembedBatchSize = 32
+
+// EmbeddingModel returns the name of the model new vectors come from.
+func (memoryMgr *MemoryManager) EmbeddingModel() string {
+	return memoryMgr.szEmbedModel
+}
+
+// stampVector returns a copy of the metadata that records the current
+// model and the dimension of vector.
+func (memoryMgr *MemoryManager) stampVector(metadataMap map[string]string, vector []float32) map[string]string {
+	stamped := make(map[string]string, len(metadataMap)+2)
+	for szKey, szValue := range metadataMap {
+		stamped[szKey] = szValue
+	}
+	stamped[MetadataEmbedModel] = memoryMgr.szEmbedModel
+	stamped[MetadataEmbedDim] = strconv.Itoa(len(vector))
+	return stamped
+}
+
+// ReembedStale embeds again the memories whose vectors were not made by
+// the current model, including those saved before the model was recorded,
+// and returns how many were updated. Documents are left to the indexer.
+func (memoryMgr *MemoryManager) ReembedStale(ctx context.Context) (int, error) {
+	memoryMgr.mu.RLock()
+	var stale []MemoryEntry
+	for _, mem := range memoryMgr.memories {
+		if len(mem.FlVector) > 0 && mem.MetadataMap["type"] != TypeDocument && mem.MetadataMap[MetadataEmbedModel] != memoryMgr.szEmbedModel {
+			stale = append(stale, mem)
+		}
+	}
+	memoryMgr.mu.RUnlock()
+
+	if len(stale) == 0 {
+		return 0, nil
+	}
+	log.Printf("Embedding %d memories again with %s\n", len(stale), memoryMgr.szEmbedModel)
+
+	inUpdated := 0
+	defer func() {
+		if inUpdated > 0 {
+			memoryMgr.mu.Lock()
+			memoryMgr.rebuildSearchIndex()
+			memoryMgr.mu.Unlock()
+		}
+	}()
+
+	for inStart := 0; inStart < len(stale); inStart += reembedBatchSize {
+		batch := stale[inStart:min(inStart+reembedBatchSize, len(stale))]
+
+		texts := make([]string, len(batch))
+		for i, mem := range batch {
+			texts[i] = mem.SzContent
+		}
+
+		vectors, err := memoryMgr.embedder.EmbedTexts(ctx, texts)
+		if err != nil {
+			return inUpdated, fmt.Errorf("failed to embed batch: %w", err)
+		}
+
+		memoryMgr.mu.Lock()
+		updated := make([]MemoryEntry, 0, len(batch))
+		for i, mem := range batch {
+			// Skip memories deleted while the batch was being embedded.
+			pos, exists := memoryMgr.positionMap[mem.SzId]
+			if !exists {
+				continue
+			}
+
+			entry := memoryMgr.memories[pos]
+			entry.FlVector = vectors[i]
+			entry.MetadataMap = memoryMgr.stampVector(entry.MetadataMap, vectors[i])
+			memoryMgr.memories[pos] = entry
+			updated = append(updated, entry)
+		}
+		err = memoryMgr.backend.Persist(memoryMgr.memories, updated, nil)
+		memoryMgr.mu.Unlock()
+
+		if err != nil {
+			return inUpdated, fmt.Errorf("failed to persist batch: %w", err)
+		}
+		inUpdated += len(updated)
+	}
+
+	return inUpdated, nil
+}
@@ -0,0 +1,99 @@
+package ollama
+
+import (
+	"chak-server/internal/types"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+type OllamaChatRequest struct {
+	SzModel string `json:"model"`
+	MessageList []types.Message `json:"messages"`
+	BStream bool `json:"stream"`
+}
+
+type OllamaChatResponse struct {
+	Message types.Message `json:"message"`
+	ITotalDuration int64 `json:"total_duration"`
+	IEvalCount int `json:"eval_count"`
+	IPromptEvalCount int `json:"prompt_eval_count"`
+	BDone bool `json:"done"`
+	SzError string `json:"error"`
+}
+
+func (ollamaMgr *OllamaManager) Chat(ctx context.Context, szModel string, systemMessage types.Message, messageList []types.Message) (GenerateResponse, error) {
+	resp, err := ollamaMgr.postChat(ctx, szModel, systemMessage, messageList, false)
+	if err != nil {
+		return GenerateResponse{}, err
+	}
+	defer resp.Body.Close()
+
+	var chatResp OllamaChatResponse
+	if err := json.NewDecoder(resp.Body).Decode(&chatResp); err != nil {
+		return GenerateResponse{}, fmt.Errorf("failed to decode chat response: %w", err)
+	}
+
+	if chatResp.SzError != "" {
+		return GenerateResponse{}, fmt.Errorf("ollama error: %s", chatResp.SzError)
+	}
+
+	return GenerateResponse{
+		SzResponse: chatResp.Message.SzContent,
+		ITotalTokens: chatResp.IEvalCount + chatResp.IPromptEvalCount,
+		FTotalTime: float64(chatResp.ITotalDuration) / 1e9,
+	}, nil
+}
+
+func (ollamaMgr *OllamaManager) ChatStream(ctx context.Context, szModel string, systemMessage types.Message, messageList []types.Message, onToken func(szToken string) error) (GenerateResponse, error) {
+	resp, err := ollamaMgr.postChat(ctx, szModel, systemMessage, messageList, true)
+	if err != nil {
+		return GenerateResponse{}, err
+	}
+	defer resp.Body.Close()
+
+	var sbResponse strings.Builder
+	decoder := json.NewDecoder(resp.Body)
+
+	for {
+		var chunk OllamaChatResponse
+		if err := decoder.Decode(&chunk); err != nil {
+			return GenerateResponse{}, fmt.Errorf("failed to read stream: %w", err)
+		}
+
+		if chunk.SzError != "" {
+			return GenerateResponse{}, fmt.Errorf("ollama error: %s", chunk.SzError)
+		}
+
+		if chunk.Message.SzContent != "" {
+			sbResponse.WriteString(chunk.Message.SzContent)
+			if err := onToken(chunk.Message.SzContent); err != nil {
+				return GenerateResponse{}, err
+			}
+		}
+
+		if chunk.BDone {
+			return GenerateResponse{
+				SzResponse: sbResponse.String(),
+				ITotalTokens: chunk.IEvalCount + chunk.IPromptEvalCount,
+				FTotalTime: float64(chunk.ITotalDuration) / 1e9,
+			}, nil
+		}
+	}
+}
+
+func (ollamaMgr *OllamaManager) postChat(ctx context.Context, szModel string, systemMessage types.Message, messageList []types.Message, bStream bool) (*http.Response, error) {
+	chatMessages := make([]types.Message, 0, len(messageList)+1)
+	if systemMessage.SzContent != "" {
+		chatMessages = append(chatMessages, systemMessage)
+	}
+	chatMessages = append(chatMessages, messageList...)
+
+	return ollamaMgr.post(ctx, "/api/chat", OllamaChatRequest{
+		SzModel: szModel,
+		MessageList: chatMessages,
+		BStream: bStream,
+	})
+}
@@ -1,7 +1,15 @@
 package ollama
 
+import (
+	"chak-server/internal/types"
+	"context"
+)
+
 type OllamaInterface interface {
-	Generate(szModel string, szPrompt string) (GenerateResponse, error)
+	Generate(ctx context.Context, szModel string, szPrompt string) (GenerateResponse, error)
+	GenerateStream(ctx context.Context, szModel string, szPrompt string, onToken func(szToken string) error) (GenerateResponse, error)
+	Chat(ctx context.Context, szModel string, systemMessage types.Message, messageList []types.Message) (GenerateResponse, error)
+	ChatStream(ctx context.Context, szModel string, systemMessage types.Message, messageList []types.Message, onToken func(szToken string) error) (GenerateResponse, error)
 }
 
 type GenerateResponse struct {
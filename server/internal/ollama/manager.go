@@ -3,17 +3,21 @@ package ollama
 import (
 	"fmt"
 	"bytes"
+	"context"
 	"encoding/json"
 	"net/http"
+	"strings"
 )
 
 type OllamaManager struct {
 	szApiURL string
+	client *http.Client
 }
 
 func NewDefaultOllamaManager(szApiURL string) *OllamaManager {
 	return &OllamaManager{
 		szApiURL: szApiURL,
+		client: &http.Client{},
 	}
 }
 
@@ -28,29 +32,31 @@ type OllamaResponse struct {
 	ITotalDuration int64 `json:"total_duration"`
 	IEvalCount int `json:"eval_count"`
 	IPromptEvalCount int `json:"prompt_eval_count"`
+	BDone bool `json:"done"`
+	SzError string `json:"error"`
 }
 
-func (ollamaMgr *OllamaManager) Generate(szModel string, szPrompt string) (GenerateResponse, error) {
+func (ollamaMgr *OllamaManager) Generate(ctx context.Context, szModel string, szPrompt string) (GenerateResponse, error) {
 	reqBody := OllamaRequest {
 		SzModel: szModel,
 		SzPrompt: szPrompt,
 		BStream: false,
 	}
 
-	jsonData, _ := json.Marshal(reqBody)
-
-	resp, err := http.Post(
-		fmt.Sprintf("%s/api/generate", ollamaMgr.szApiURL),
-		"application/json",
-		bytes.NewBuffer(jsonData),	
-	)
+	resp, err := ollamaMgr.post(ctx, "/api/generate", reqBody)
 	if err != nil {
 		return GenerateResponse{}, err
 	}
 	defer resp.Body.Close()
 
 	var ollamaResp OllamaResponse
-	json.NewDecoder(resp.Body).Decode(&ollamaResp)
+	if err := json.NewDecoder(resp.Body).Decode(&ollamaResp); err != nil {
+		return GenerateResponse{}, fmt.Errorf("failed to decode generate response: %w", err)
+	}
+
+	if ollamaResp.SzError != "" {
+		return GenerateResponse{}, fmt.Errorf("ollama error: %s", ollamaResp.SzError)
+	}
 
 	return GenerateResponse{
 		SzResponse: ollamaResp.SzResponse,
@@ -59,3 +65,72 @@ func (ollamaMgr *OllamaManager) Generate(szModel string, szPrompt string) (Gener
 	}, nil
 }
 
+
+
+func (ollamaMgr *OllamaManager) GenerateStream(ctx context.Context, szModel string, szPrompt string, onToken func(szToken string) error) (GenerateResponse, error) {
+	reqBody := OllamaRequest {
+		SzModel: szModel,
+		SzPrompt: szPrompt,
+		BStream: true,
+	}
+
+	resp, err := ollamaMgr.post(ctx, "/api/generate", reqBody)
+	if err != nil {
+		return GenerateResponse{}, err
+	}
+	defer resp.Body.Close()
+
+	var sbResponse strings.Builder
+	decoder := json.NewDecoder(resp.Body)
+
+	for {
+		var chunk OllamaResponse
+		if err := decoder.Decode(&chunk); err != nil {
+			return GenerateResponse{}, fmt.Errorf("failed to read stream: %w", err)
+		}
+
+		if chunk.SzError != "" {
+			return GenerateResponse{}, fmt.Errorf("ollama error: %s", chunk.SzError)
+		}
+
+		if chunk.SzResponse != "" {
+			sbResponse.WriteString(chunk.SzResponse)
+			if err := onToken(chunk.SzResponse); err != nil {
+				return GenerateResponse{}, err
+			}
+		}
+
+		if chunk.BDone {
+			return GenerateResponse{
+				SzResponse: sbResponse.String(),
+				ITotalTokens: chunk.IEvalCount + chunk.IPromptEvalCount,
+				FTotalTime: float64(chunk.ITotalDuration) / 1e9,
+			}, nil
+		}
+	}
+}
+
+func (ollamaMgr *OllamaManager) post(ctx context.Context, szPath string, reqBody interface{}) (*http.Response, error) {
+	jsonData, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", fmt.Sprintf("%s%s", ollamaMgr.szApiURL, szPath), bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := ollamaMgr.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("ollama returned status %d", resp.StatusCode)
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,122 @@
+package prompt
+
+import (
+	"chak-server/internal/memory"
+	"chak-server/internal/search"
+	"chak-server/internal/types"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	RoleSystem = "system"
+	RoleUser = "user"
+	RoleAssistant = "assistant"
+)
+
+// BuildChat returns a system message carrying the retrieved context and the
+// conversation as separate user/assistant turns for Ollama's /api/chat.
+// Document memories are numbered with the citation marker [n], n being
+// their position in memories counted from 1, and the model is asked to
+// cite them. Adjacent halves of an exchange are rendered as one Q/A pair.
+func (promptMgr *PromptManager) BuildChat(messageList []types.Message, searchResultData []search.SearchResultData, memories []memory.MemoryEntry) (types.Message, []types.Message) {
+	var sbSystem strings.Builder
+
+	sbSystem.WriteString("You are Chak, a helpful local AI assistant.\n")
+	sbSystem.WriteString(fmt.Sprintf("Current date and time: %s\n\n", time.Now().Format(time.RFC1123)))
+
+	turns := make([]types.Message, 0, len(messageList))
+	for _, msg := range messageList {
+		switch msg.SzRole {
+		case RoleUser, RoleAssistant:
+			turns = append(turns, msg)
+		case RoleSystem:
+			sbSystem.WriteString(msg.SzContent)
+			sbSystem.WriteString("\n\n")
+		}
+	}
+
+	bCitations := false
+	if len(memories) > 0 {
+		sbSystem.WriteString("=== RELEVANT CONTEXT ===\n\n")
+		inMemory := 0
+		for i := 0; i < len(memories); i++ {
+			mem := memories[i]
+			if IsDocument(mem) {
+				bCitations = true
+				sbSystem.WriteString(fmt.Sprintf("[%d]%s:\n%s\n\n", i+1, describeSource(mem), mem.SzContent))
+				continue
+			}
+
+			inMemory++
+			if i+1 < len(memories) && isExchange(mem, memories[i+1]) {
+				sbSystem.WriteString(fmt.Sprintf("Memory %d (earlier exchange):\nQ: %s\nA: %s\n\n", inMemory, mem.SzContent, memories[i+1].SzContent))
+				i++
+				continue
+			}
+			sbSystem.WriteString(fmt.Sprintf("Memory %d%s:\n%s\n\n", inMemory, describeSource(mem), mem.SzContent))
+		}
+		sbSystem.WriteString("=== END CONTEXT ===\n\n")
+	}
+
+	if len(searchResultData) > 0 {
+		sbSystem.WriteString("=== SEARCH RESULTS ===\n\n")
+		for i, result := range searchResultData {
+			sbSystem.WriteString(fmt.Sprintf("Result %d:\n", i+1))
+			sbSystem.WriteString(fmt.Sprintf("Title: %s\n", result.SzTitle))
+			sbSystem.WriteString(fmt.Sprintf("Content: %s\n", result.SzSnippet))
+			sbSystem.WriteString(fmt.Sprintf("URL: %s\n\n", result.SzURL))
+		}
+		sbSystem.WriteString("=== END SEARCH RESULTS ===\n\n")
+		sbSystem.WriteString("Instructions: Prioritize the search results. You may make simple inferences from them if needed, but do not add information that is not supported by the search results.\n")
+	} else {
+		sbSystem.WriteString("Instructions: Provide a clear and direct answer to the user's latest message.\n")
+		sbSystem.WriteString("Use the context and earlier turns only if they add useful information.\n")
+	}
+	if bCitations {
+		sbSystem.WriteString("When you use a numbered document from the context, cite it right after the statement it supports with its marker, like [1] or [1][3]. Only cite markers listed in the context.\n")
+	}
+
+	return types.Message{SzRole: RoleSystem, SzContent: sbSystem.String()}, turns
+}
+
+// IsDocument reports whether a memory was cut from an indexed file rather
+// than saved from a conversation.
+func IsDocument(mem memory.MemoryEntry) bool {
+	return mem.MetadataMap["filepath"] != ""
+}
+
+// isExchange reports whether a question is followed by its answer.
+func isExchange(question memory.MemoryEntry, answer memory.MemoryEntry) bool {
+	szExchangeID := question.MetadataMap[memory.MetadataExchangeID]
+	return szExchangeID != "" && answer.MetadataMap[memory.MetadataExchangeID] == szExchangeID &&
+		question.MetadataMap["role"] == memory.RoleUser && answer.MetadataMap["role"] == memory.RoleAssistant
+}
+
+// describeSource names the file and page a document memory came from so
+// that the model can refer to it.
+func describeSource(mem memory.MemoryEntry) string {
+	szFilename := mem.MetadataMap["filename"]
+	if szFilename == "" {
+		return ""
+	}
+
+	if szStart := mem.MetadataMap["start_line"]; szStart != "" {
+		szLocation := fmt.Sprintf("%s:%s-%s", szFilename, szStart, mem.MetadataMap["end_line"])
+		if szSymbol := mem.MetadataMap["symbol"]; szSymbol != "" {
+			return fmt.Sprintf(" (source: %s, %s %s)", szLocation, mem.MetadataMap["kind"], szSymbol)
+		}
+		return fmt.Sprintf(" (source: %s)", szLocation)
+	}
+	if szPage := mem.MetadataMap["page"]; szPage != "" {
+		return fmt.Sprintf(" (source: %s, page %s)", szFilename, szPage)
+	}
+	if szSheet := mem.MetadataMap["sheet"]; szSheet != "" {
+		return fmt.Sprintf(" (source: %s, sheet %s)", szFilename, szSheet)
+	}
+	if szTitle := mem.MetadataMap["title"]; szTitle != "" {
+		return fmt.Sprintf(" (source: %s, \"%s\")", szFilename, szTitle)
+	}
+	return fmt.Sprintf(" (source: %s)", szFilename)
+}
@@ -8,4 +8,5 @@ import (
 
 type PromptInterface interface {
 	Build(messageList []types.Message, searchResultData []search.SearchResultData, memories []memory.MemoryEntry) string
+	BuildChat(messageList []types.Message, searchResultData []search.SearchResultData, memories []memory.MemoryEntry) (types.Message, []types.Message)
 }
@@ -0,0 +1,10 @@
+package rerank
+
+import (
+	"chak-server/internal/memory"
+	"context"
+)
+
+type RerankInterface interface {
+	Rerank(ctx context.Context, szQuery string, candidates []memory.MemoryEntry, iTopN int) ([]memory.MemoryEntry, error)
+}
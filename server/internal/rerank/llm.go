@@ -0,0 +1,109 @@
+package rerank
+
+import (
+	"chak-server/internal/memory"
+	"chak-server/internal/ollama"
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+const DefaultRerankWorkers = 4
+
+var scoreRegex = regexp.MustCompile(`\d+(\.\d+)?`)
+
+// LLMReranker asks a model served by Ollama to grade each candidate against
+// the query and keeps the best graded ones. Any instruct model works, as do
+// reranker models that answer with a relevance number.
+type LLMReranker struct {
+	ollamaManager ollama.OllamaInterface
+	szModel string
+	inWorkers int
+}
+
+func NewLLMReranker(ollamaManager ollama.OllamaInterface, szModel string) *LLMReranker {
+	return &LLMReranker{
+		ollamaManager: ollamaManager,
+		szModel: szModel,
+		inWorkers: DefaultRerankWorkers,
+	}
+}
+
+type scoredCandidate struct {
+	entry memory.MemoryEntry
+	flScore float64
+}
+
+func (llmRerank *LLMReranker) Rerank(ctx context.Context, szQuery string, candidates []memory.MemoryEntry, iTopN int) ([]memory.MemoryEntry, error) {
+	scored := make([]scoredCandidate, len(candidates))
+	errs := make([]error, len(candidates))
+
+	var wg sync.WaitGroup
+	semaphore := make(chan struct{}, llmRerank.inWorkers)
+
+	for i, candidate := range candidates {
+		wg.Add(1)
+		go func(i int, candidate memory.MemoryEntry) {
+			defer wg.Done()
+
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			flScore, err := llmRerank.score(ctx, szQuery, candidate.SzContent)
+			scored[i] = scoredCandidate{entry: candidate, flScore: flScore}
+			errs[i] = err
+		}(i, candidate)
+	}
+
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	inFailed := 0
+	for _, err := range errs {
+		if err != nil {
+			inFailed++
+		}
+	}
+	if inFailed == len(candidates) && inFailed > 0 {
+		return nil, fmt.Errorf("reranking failed for all %d candidates: %w", inFailed, errs[0])
+	}
+
+	sort.SliceStable(scored, func(i, j int) bool {
+		return scored[i].flScore > scored[j].flScore
+	})
+
+	if iTopN > len(scored) {
+		iTopN = len(scored)
+	}
+
+	results := make([]memory.MemoryEntry, iTopN)
+	for i := 0; i < iTopN; i++ {
+		results[i] = scored[i].entry
+	}
+
+	return results, nil
+}
+
+func (llmRerank *LLMReranker) score(ctx context.Context, szQuery string, szPassage string) (float64, error) {
+	szPrompt := "You are a relevance grader. Rate how useful the passage is for answering the question " +
+		"on a scale from 0 (irrelevant) to 10 (answers it directly). Reply with the number only.\n\n" +
+		fmt.Sprintf("Question: %s\n\nPassage:\n%s\n\nScore:", szQuery, szPassage)
+
+	resp, err := llmRerank.ollamaManager.Generate(ctx, llmRerank.szModel, szPrompt)
+	if err != nil {
+		return 0, err
+	}
+
+	szScore := scoreRegex.FindString(resp.SzResponse)
+	if szScore == "" {
+		return 0, fmt.Errorf("no score in reranker reply %q", resp.SzResponse)
+	}
+
+	return strconv.ParseFloat(szScore, 64)
+}
@@ -1,6 +1,7 @@
 package search
 
 import(
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -29,10 +30,10 @@ type braveResponse struct {
 	}`json:"web"`
 } 
  
-func (braveMgr *BraveManager) Search(SzQuery string) ([]SearchResultData, error) {
+func (braveMgr *BraveManager) Search(ctx context.Context, SzQuery string) ([]SearchResultData, error) {
 	szSearchUrl := fmt.Sprintf("%s?q=%s&count=5", braveMgr.szApiUrl, url.QueryEscape(SzQuery))
 
-	req, err := http.NewRequest("GET", szSearchUrl, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", szSearchUrl, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -1,6 +1,7 @@
 package search
 
 import(
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -24,10 +25,10 @@ type duckduckgoResponse struct {
 	} `json:"RelatedTopics"`
 }
 
-func (duckMgr *DuckDuckGoManager) Search(SzQuery string) ([]SearchResultData, error) {
+func (duckMgr *DuckDuckGoManager) Search(ctx context.Context, SzQuery string) ([]SearchResultData, error) {
 	szSearchUrl := fmt.Sprintf("%s?q=%s&format=json", duckMgr.szApiUrl, url.QueryEscape(SzQuery))
 
-	req, err := http.NewRequest("GET", szSearchUrl, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", szSearchUrl, nil)
 	if err != nil {
 		return nil, err
 	}
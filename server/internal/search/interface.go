@@ -1,5 +1,7 @@
 package search
 
+import "context"
+
 type SearchResultData struct {
 	SzTitle string `json:"title"`
 	SzSnippet string `json:"snippet"`
@@ -7,5 +9,5 @@ type SearchResultData struct {
 }
 
 type SearchInterface interface {
-	Search(SzQuery string) ([]SearchResultData, error)
+	Search(ctx context.Context, SzQuery string) ([]SearchResultData, error)
 }
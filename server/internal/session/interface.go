@@ -0,0 +1,35 @@
+package session
+
+import (
+	"chak-server/internal/types"
+	"errors"
+	"time"
+)
+
+var ErrNotFound = errors.New("session not found")
+
+type Session struct {
+	SzID string `json:"id"`
+	SzTitle string `json:"title"`
+	TmCreated time.Time `json:"created_at"`
+	TmUpdated time.Time `json:"updated_at"`
+	MessageList []types.Message `json:"messages"`
+}
+
+// Summary describes a session without its messages, for listings.
+type Summary struct {
+	SzID string `json:"id"`
+	SzTitle string `json:"title"`
+	TmCreated time.Time `json:"created_at"`
+	TmUpdated time.Time `json:"updated_at"`
+	InMessages int `json:"message_count"`
+}
+
+type SessionInterface interface {
+	Create(szTitle string) (Session, error)
+	List() []Summary
+	Get(szID string) (Session, error)
+	Rename(szID string, szTitle string) (Session, error)
+	Delete(szID string) error
+	AppendMessages(szID string, messages []types.Message) (Session, error)
+}
@@ -0,0 +1,251 @@
+package session
+
+import (
+	"chak-server/internal/types"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+)
+
+// MaxTitleLength caps the titles taken from the first message of a session.
+const MaxTitleLength = 60
+
+// SessionManager keeps the conversations of one profile, each in its own
+// JSON file under szDir, and holds them all in memory.
+type SessionManager struct {
+	szDir string
+	sessionMap map[string]*Session
+	mu sync.RWMutex
+}
+
+func NewSessionManager(szDir string) *SessionManager {
+	sessionMgr := &SessionManager{
+		szDir: szDir,
+		sessionMap: make(map[string]*Session),
+	}
+
+	if err := sessionMgr.load(); err != nil {
+		log.Printf("Failed to load sessions from %s: %v\n", szDir, err)
+	}
+
+	return sessionMgr
+}
+
+func (sessionMgr *SessionManager) load() error {
+	entries, err := os.ReadDir(sessionMgr.szDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(sessionMgr.szDir, entry.Name()))
+		if err != nil {
+			log.Printf("Skipping session %s: %v\n", entry.Name(), err)
+			continue
+		}
+
+		var session Session
+		if err := json.Unmarshal(data, &session); err != nil || session.SzID == "" {
+			log.Printf("Skipping session %s: invalid file\n", entry.Name())
+			continue
+		}
+		sessionMgr.sessionMap[session.SzID] = &session
+	}
+
+	log.Printf("Loaded %d sessions from %s\n", len(sessionMgr.sessionMap), sessionMgr.szDir)
+	return nil
+}
+
+// Create starts an empty session. Without a title, the first user message
+// names it.
+func (sessionMgr *SessionManager) Create(szTitle string) (Session, error) {
+	tmNow := time.Now()
+	session := &Session{
+		SzID: generateID(),
+		SzTitle: strings.TrimSpace(szTitle),
+		TmCreated: tmNow,
+		TmUpdated: tmNow,
+		MessageList: []types.Message{},
+	}
+
+	sessionMgr.mu.Lock()
+	defer sessionMgr.mu.Unlock()
+
+	if err := sessionMgr.save(session); err != nil {
+		return Session{}, err
+	}
+	sessionMgr.sessionMap[session.SzID] = session
+
+	return copySession(session), nil
+}
+
+// List returns the sessions, most recently updated first.
+func (sessionMgr *SessionManager) List() []Summary {
+	sessionMgr.mu.RLock()
+	defer sessionMgr.mu.RUnlock()
+
+	summaries := make([]Summary, 0, len(sessionMgr.sessionMap))
+	for _, session := range sessionMgr.sessionMap {
+		summaries = append(summaries, Summary{
+			SzID: session.SzID,
+			SzTitle: session.SzTitle,
+			TmCreated: session.TmCreated,
+			TmUpdated: session.TmUpdated,
+			InMessages: len(session.MessageList),
+		})
+	}
+
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].TmUpdated.After(summaries[j].TmUpdated)
+	})
+	return summaries
+}
+
+func (sessionMgr *SessionManager) Get(szID string) (Session, error) {
+	sessionMgr.mu.RLock()
+	defer sessionMgr.mu.RUnlock()
+
+	session, exists := sessionMgr.sessionMap[szID]
+	if !exists {
+		return Session{}, ErrNotFound
+	}
+	return copySession(session), nil
+}
+
+func (sessionMgr *SessionManager) Rename(szID string, szTitle string) (Session, error) {
+	sessionMgr.mu.Lock()
+	defer sessionMgr.mu.Unlock()
+
+	session, exists := sessionMgr.sessionMap[szID]
+	if !exists {
+		return Session{}, ErrNotFound
+	}
+
+	updated := copySession(session)
+	updated.SzTitle = strings.TrimSpace(szTitle)
+	updated.TmUpdated = time.Now()
+	if err := sessionMgr.save(&updated); err != nil {
+		return Session{}, err
+	}
+	sessionMgr.sessionMap[szID] = &updated
+
+	return copySession(&updated), nil
+}
+
+func (sessionMgr *SessionManager) Delete(szID string) error {
+	sessionMgr.mu.Lock()
+	defer sessionMgr.mu.Unlock()
+
+	if _, exists := sessionMgr.sessionMap[szID]; !exists {
+		return ErrNotFound
+	}
+
+	if err := os.Remove(sessionMgr.pathOf(szID)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete session %s: %w", szID, err)
+	}
+	delete(sessionMgr.sessionMap, szID)
+
+	return nil
+}
+
+// AppendMessages adds turns to the end of a session and returns it. An
+// untitled session takes its title from the first user message.
+func (sessionMgr *SessionManager) AppendMessages(szID string, messages []types.Message) (Session, error) {
+	sessionMgr.mu.Lock()
+	defer sessionMgr.mu.Unlock()
+
+	session, exists := sessionMgr.sessionMap[szID]
+	if !exists {
+		return Session{}, ErrNotFound
+	}
+
+	updated := copySession(session)
+	updated.MessageList = append(updated.MessageList, messages...)
+	updated.TmUpdated = time.Now()
+	if updated.SzTitle == "" {
+		updated.SzTitle = titleFrom(updated.MessageList)
+	}
+
+	if err := sessionMgr.save(&updated); err != nil {
+		return Session{}, err
+	}
+	sessionMgr.sessionMap[szID] = &updated
+
+	return copySession(&updated), nil
+}
+
+// save writes a session through a temporary file, so a crash never leaves
+// it half written.
+func (sessionMgr *SessionManager) save(session *Session) error {
+	if err := os.MkdirAll(sessionMgr.szDir, 0755); err != nil {
+		return fmt.Errorf("failed to create session directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(session, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal session: %w", err)
+	}
+
+	szPath := sessionMgr.pathOf(session.SzID)
+	szTemp := szPath + ".tmp"
+	if err := os.WriteFile(szTemp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write session %s: %w", session.SzID, err)
+	}
+	if err := os.Rename(szTemp, szPath); err != nil {
+		os.Remove(szTemp)
+		return fmt.Errorf("failed to write session %s: %w", session.SzID, err)
+	}
+
+	return nil
+}
+
+func (sessionMgr *SessionManager) pathOf(szID string) string {
+	return filepath.Join(sessionMgr.szDir, szID+".json")
+}
+
+func copySession(session *Session) Session {
+	copied := *session
+	copied.MessageList = append([]types.Message{}, session.MessageList...)
+	return copied
+}
+
+func titleFrom(messages []types.Message) string {
+	for _, msg := range messages {
+		if msg.SzRole != "user" {
+			continue
+		}
+
+		szTitle := strings.Join(strings.Fields(msg.SzContent), " ")
+		if len(szTitle) <= MaxTitleLength {
+			return szTitle
+		}
+
+		inEnd := MaxTitleLength
+		for inEnd > 0 && !utf8.RuneStart(szTitle[inEnd]) {
+			inEnd--
+		}
+		return szTitle[:inEnd] + "..."
+	}
+	return ""
+}
+
+var idSequence uint64
+
+func generateID() string {
+	return fmt.Sprintf("sess_%d_%d", time.Now().UnixNano(), atomic.AddUint64(&idSequence, 1))
+}
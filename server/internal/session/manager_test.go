@@ -0,0 +1,179 @@
+package session
+
+import (
+	"chak-server/internal/types"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func userMessage(szContent string) types.Message {
+	return types.Message{SzRole: "user", SzContent: szContent}
+}
+
+func assistantMessage(szContent string) types.Message {
+	return types.Message{SzRole: "assistant", SzContent: szContent}
+}
+
+func TestCreateAndAppend(t *testing.T) {
+	szDir := filepath.Join(t.TempDir(), "sessions")
+	sessionMgr := NewSessionManager(szDir)
+
+	created, err := sessionMgr.Create("  ")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if created.SzID == "" || created.SzTitle != "" || len(created.MessageList) != 0 {
+		t.Fatalf("created %+v, want an untitled empty session", created)
+	}
+	if _, err := os.Stat(filepath.Join(szDir, created.SzID+".json")); err != nil {
+		t.Fatalf("session file not written: %v", err)
+	}
+
+	first, err := sessionMgr.AppendMessages(created.SzID, []types.Message{userMessage("How do  I\nbake bread?"), assistantMessage("Knead it.")})
+	if err != nil {
+		t.Fatalf("AppendMessages: %v", err)
+	}
+	if first.SzTitle != "How do I bake bread?" {
+		t.Errorf("title %q, want it taken from the first user message", first.SzTitle)
+	}
+	if first.TmUpdated.Before(created.TmUpdated) {
+		t.Errorf("updated time %v went back from %v", first.TmUpdated, created.TmUpdated)
+	}
+
+	second, err := sessionMgr.AppendMessages(created.SzID, []types.Message{userMessage("And rye?"), assistantMessage("Use a starter.")})
+	if err != nil {
+		t.Fatalf("AppendMessages: %v", err)
+	}
+	if len(second.MessageList) != 4 || second.MessageList[2].SzContent != "And rye?" {
+		t.Fatalf("messages %+v, want the new turns after the old ones", second.MessageList)
+	}
+	if second.SzTitle != first.SzTitle {
+		t.Errorf("title changed to %q", second.SzTitle)
+	}
+
+	// Returned sessions are copies.
+	second.MessageList[0].SzContent = "changed"
+	stored, err := sessionMgr.Get(created.SzID)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if stored.MessageList[0].SzContent == "changed" {
+		t.Error("Get returned a session sharing messages with an earlier result")
+	}
+
+	reloaded, err := NewSessionManager(szDir).Get(created.SzID)
+	if err != nil {
+		t.Fatalf("Get after reload: %v", err)
+	}
+	if len(reloaded.MessageList) != 4 || reloaded.SzTitle != first.SzTitle {
+		t.Errorf("reloaded %+v, want the stored session", reloaded)
+	}
+}
+
+func TestTitleFrom(t *testing.T) {
+	tests := []struct {
+		szName string
+		messages []types.Message
+		szWant string
+	}{
+		{szName: "no user message", messages: []types.Message{assistantMessage("hello")}, szWant: ""},
+		{szName: "first user message", messages: []types.Message{assistantMessage("hello"), userMessage("one"), userMessage("two")}, szWant: "one"},
+		{szName: "long title cut", messages: []types.Message{userMessage(strings.Repeat("a", MaxTitleLength+5))}, szWant: strings.Repeat("a", MaxTitleLength) + "..."},
+		{szName: "cut on a rune boundary", messages: []types.Message{userMessage(strings.Repeat("a", MaxTitleLength-1) + "éé")}, szWant: strings.Repeat("a", MaxTitleLength-1) + "..."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.szName, func(t *testing.T) {
+			if szTitle := titleFrom(tt.messages); szTitle != tt.szWant {
+				t.Errorf("titleFrom = %q, want %q", szTitle, tt.szWant)
+			}
+		})
+	}
+}
+
+func TestUnknownSession(t *testing.T) {
+	sessionMgr := NewSessionManager(t.TempDir())
+
+	if _, err := sessionMgr.Get("sess_missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get: %v, want ErrNotFound", err)
+	}
+	if _, err := sessionMgr.Rename("sess_missing", "title"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Rename: %v, want ErrNotFound", err)
+	}
+	if _, err := sessionMgr.AppendMessages("sess_missing", []types.Message{userMessage("hi")}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("AppendMessages: %v, want ErrNotFound", err)
+	}
+	if err := sessionMgr.Delete("sess_missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Delete: %v, want ErrNotFound", err)
+	}
+}
+
+// Sessions do not time out; they end when deleted, which must hold across
+// restarts.
+func TestDeleteSession(t *testing.T) {
+	szDir := t.TempDir()
+	sessionMgr := NewSessionManager(szDir)
+
+	kept, err := sessionMgr.Create("kept")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	deleted, err := sessionMgr.Create("deleted")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	if err := sessionMgr.Delete(deleted.SzID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := sessionMgr.Get(deleted.SzID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get after Delete: %v, want ErrNotFound", err)
+	}
+	if _, err := sessionMgr.AppendMessages(deleted.SzID, []types.Message{userMessage("hi")}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("AppendMessages after Delete: %v, want ErrNotFound", err)
+	}
+
+	summaries := NewSessionManager(szDir).List()
+	if len(summaries) != 1 || summaries[0].SzID != kept.SzID {
+		t.Errorf("reloaded %+v, want only %s", summaries, kept.SzID)
+	}
+}
+
+func TestListAndLoad(t *testing.T) {
+	szDir := t.TempDir()
+	sessionMgr := NewSessionManager(szDir)
+
+	older, err := sessionMgr.Create("older")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	newer, err := sessionMgr.Create("newer")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if _, err := sessionMgr.AppendMessages(older.SzID, []types.Message{userMessage("bump")}); err != nil {
+		t.Fatalf("AppendMessages: %v", err)
+	}
+	if _, err := sessionMgr.Rename(newer.SzID, "  renamed  "); err != nil {
+		t.Fatalf("Rename: %v", err)
+	}
+
+	// Files that are not sessions are skipped on load.
+	os.WriteFile(filepath.Join(szDir, "broken.json"), []byte("{"), 0644)
+	os.WriteFile(filepath.Join(szDir, "empty.json"), []byte("{}"), 0644)
+	os.WriteFile(filepath.Join(szDir, "notes.txt"), []byte("{}"), 0644)
+
+	summaries := NewSessionManager(szDir).List()
+	if len(summaries) != 2 {
+		t.Fatalf("listed %d sessions, want 2", len(summaries))
+	}
+	if summaries[0].SzID != newer.SzID || summaries[0].SzTitle != "renamed" {
+		t.Errorf("first %+v, want the renamed session", summaries[0])
+	}
+	if summaries[1].SzID != older.SzID || summaries[1].InMessages != 1 {
+		t.Errorf("second %+v, want the older session with one message", summaries[1])
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"chak-server/internal/config"
+	"chak-server/internal/document"
 	"chak-server/internal/embedding"
 	"chak-server/internal/handler"
 	"chak-server/internal/indexer"
@@ -9,14 +10,18 @@ import (
 	"chak-server/internal/middleware"
 	"chak-server/internal/ollama"
 	"chak-server/internal/prompt"
+	"chak-server/internal/rerank"
 	"chak-server/internal/search"
+	"chak-server/internal/session"
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"path/filepath"
+	"strings"
 	"sync"
-	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -36,6 +41,7 @@ type AppManagers struct {
 	embedMgr embedding.EmbeddingInterface
 	memoryMgr memory.MemoryInterface
 	indexerMgr indexer.ManagerInterface
+	sessionMgr session.SessionInterface
 	chatMgr *handler.ChatHandlerManager
 	mu sync.RWMutex
 }
@@ -46,45 +52,92 @@ func (app *AppManagers) GetChatManager() *handler.ChatHandlerManager {
 	return app.chatMgr
 }
 
-func (app *AppManagers) HotReloadProfile(szProfileName string) error {
-	app.mu.Lock()
-	defer app.mu.Unlock()
+func (app *AppManagers) GetIndexer() indexer.ManagerInterface {
+	app.mu.RLock()
+	defer app.mu.RUnlock()
+	return app.indexerMgr
+}
 
+func (app *AppManagers) GetMemory() memory.MemoryInterface {
+	app.mu.RLock()
+	defer app.mu.RUnlock()
+	return app.memoryMgr
+}
+
+func (app *AppManagers) GetSessions() session.SessionInterface {
+	app.mu.RLock()
+	defer app.mu.RUnlock()
+	return app.sessionMgr
+}
+
+// HotReloadProfile swaps every manager for ones built from the profile.
+// Only the swap happens under the lock; indexing the new directories and
+// embedding stale memories again run in the background afterwards, so
+// requests keep being served and /index/status reports the progress.
+func (app *AppManagers) HotReloadProfile(szProfileName string) error {
 	log.Printf("Hot reloading profile: %s", szProfileName)
 	newProfile, err := app.configMgr.GetProfile(szProfileName)
 	if err != nil {
 		return fmt.Errorf("failed to get profile: %w", err)
 	}
 
+	app.mu.Lock()
+
 	app.indexerMgr.StopWatcher()
+	app.memoryMgr.StopConsolidation()
 
-	if err := app.memoryMgr.Reload(newProfile.SzMemoryFile); err != nil {
-		return fmt.Errorf("failed to reload memory: %w", err)
-	}
+	// Requests that fetched the old managers before the swap may still be
+	// running. The old store is closed once nothing new can reach it, and
+	// their writes then fail with memory.ErrClosed instead of landing in a
+	// store that is no longer read.
+	oldMemoryMgr := app.memoryMgr
+	app.memoryMgr = newMemoryManager(app.embedMgr, newProfile)
 
 	newScanner := indexer.NewDirectoryScanner(
 		newProfile.SzDirectories,
 		newProfile.Extensions,
 		newProfile.InMaxSizeFile,
+		app.configMgr.GetIndexer().SzHash,
+		newScanOptions(newProfile),
 	)
-	app.indexerMgr = indexer.NewIndexerManager(newScanner, app.memoryMgr, newProfile.SzIndexFile)
-	log.Println("Starting watcher for the new profile...")
-	app.indexerMgr.StartWatcher(5 * time.Minute)
+	app.indexerMgr = indexer.NewIndexerManager(newScanner, app.memoryMgr, newProfile.SzIndexFile, newChunkOptions(newProfile), newIndexOptions(app.configMgr.GetIndexer()))
 
-	log.Println("Running initial indexing for new profile.")
-	if err := app.indexerMgr.IndexAll(); err != nil {
-		log.Printf("Indexing warning: %v", err)
-	}
+	log.Println("Starting watcher for the new profile...")
+	indexerConfig := app.configMgr.GetIndexer()
+	app.indexerMgr.StartWatcher(indexerConfig.FullScanInterval(), indexerConfig.Debounce())
+	app.memoryMgr.StartConsolidation(newSummarizer(app.ollamaMgr, newProfile, app.configMgr.GetTimeouts()))
 
-	app.indexerMgr.StartWatcher(5 * time.Minute)
+	app.sessionMgr = session.NewSessionManager(newProfile.SessionDir())
 
 	app.chatMgr = handler.NewChatHandlerManager(
 		app.searchMgr,
 		app.promptMgr,
 		app.ollamaMgr,
 		app.memoryMgr,
+		newReranker(app.ollamaMgr, newProfile),
+		app.sessionMgr,
+		app.configMgr.GetTimeouts(),
+		newProfile.Retrieval,
 	)
 
+	indexerMgr := app.indexerMgr
+	memoryMgr := app.memoryMgr
+	app.mu.Unlock()
+
+	if err := oldMemoryMgr.Close(); err != nil {
+		log.Printf("Failed to close memory store: %v", err)
+	}
+
+	log.Println("Running initial indexing for new profile in the background.")
+	if err := indexerMgr.Rebuild(false); err != nil {
+		log.Printf("Indexing warning: %v", err)
+	}
+	go func() {
+		if _, err := memoryMgr.ReembedStale(context.Background()); err != nil {
+			log.Printf("Failed to embed memories again: %v", err)
+		}
+	}()
+
 	log.Printf("Hot reload complete, current profile: %s", newProfile.SzName)
 
 	return nil
@@ -107,25 +160,43 @@ func main() {
 	searchManager := search.NewBraveManager(szApiKey)
 	promptManager := prompt.NewPromptManager()
 	ollamaManager := ollama.NewDefaultOllamaManager(szUrl)
-	embeddingManager := embedding.NewOllamaEmbedding("all-minilm:33m",szUrl)
-	memoryManager := memory.NewMemoryManager(embeddingManager, activeProfile.SzMemoryFile)
+	embeddingManager := embedding.NewOllamaEmbedding("all-minilm:33m", szUrl, configManager.GetTimeouts().Embed())
+	memoryManager := newMemoryManager(embeddingManager, activeProfile)
 
 	log.Println("Initalizing document indexer...")
 
 	scannerMgr := indexer.NewDirectoryScanner(
 		activeProfile.SzDirectories, 
 		activeProfile.Extensions, 
-		activeProfile.InMaxSizeFile)
-	idxManager := indexer.NewIndexerManager(scannerMgr, memoryManager, activeProfile.SzIndexFile)
+		activeProfile.InMaxSizeFile,
+		configManager.GetIndexer().SzHash,
+		newScanOptions(activeProfile))
+	idxManager := indexer.NewIndexerManager(scannerMgr, memoryManager, activeProfile.SzIndexFile, newChunkOptions(activeProfile), newIndexOptions(configManager.GetIndexer()))
 
 	log.Println("Running initial document indexing")
 	if err := idxManager.IndexAll(); err != nil {
 		log.Printf("Indexing failed: %v\n", err)
 	}
+	if _, err := memoryManager.ReembedStale(context.Background()); err != nil {
+		log.Printf("Failed to embed memories again: %v\n", err)
+	}
 
-	idxManager.StartWatcher(5 * time.Minute)
-
-	chatManager := handler.NewChatHandlerManager(searchManager, promptManager, ollamaManager, memoryManager)
+	indexerConfig := configManager.GetIndexer()
+	idxManager.StartWatcher(indexerConfig.FullScanInterval(), indexerConfig.Debounce())
+	memoryManager.StartConsolidation(newSummarizer(ollamaManager, activeProfile, configManager.GetTimeouts()))
+
+	sessionManager := session.NewSessionManager(activeProfile.SessionDir())
+
+	chatManager := handler.NewChatHandlerManager(
+		searchManager,
+		promptManager,
+		ollamaManager,
+		memoryManager,
+		newReranker(ollamaManager, activeProfile),
+		sessionManager,
+		configManager.GetTimeouts(),
+		activeProfile.Retrieval,
+	)
 
 	appManagers := &AppManagers{
 		configMgr: configManager,
@@ -135,6 +206,7 @@ func main() {
 		embedMgr: embeddingManager,
 		memoryMgr: memoryManager,
 		indexerMgr: idxManager,
+		sessionMgr: sessionManager,
 		chatMgr: chatManager,
 	}
 
@@ -193,12 +265,137 @@ func main() {
 		logMiddleware, corsMiddleware,
 	))
 
+	indexHandler := handler.NewIndexHandler(appManagers.GetIndexer)
+
+	http.Handle("/index/status", Chain(
+		http.HandlerFunc(indexHandler.HandleStatus),
+		logMiddleware, corsMiddleware,
+	))
+
+	http.Handle("/index/rebuild", Chain(
+		http.HandlerFunc(indexHandler.HandleRebuild),
+		logMiddleware, corsMiddleware,
+	))
+
+	sessionHandler := handler.NewSessionHandler(appManagers.GetSessions)
+
+	http.Handle("/sessions", Chain(
+		http.HandlerFunc(sessionHandler.HandleSessions),
+		logMiddleware, corsMiddleware,
+	))
+
+	http.Handle("/sessions/{id}", Chain(
+		http.HandlerFunc(sessionHandler.HandleSession),
+		logMiddleware, corsMiddleware,
+	))
+
+	memoryHandler := handler.NewMemoryHandler(appManagers.GetMemory)
+
+	http.Handle("/memories", Chain(
+		http.HandlerFunc(memoryHandler.HandleMemories),
+		logMiddleware, corsMiddleware,
+	))
+
+	http.Handle("/memories/search", Chain(
+		http.HandlerFunc(memoryHandler.HandleSearch),
+		logMiddleware, corsMiddleware,
+	))
+
+	http.Handle("/memories/{id}", Chain(
+		http.HandlerFunc(memoryHandler.HandleMemory),
+		logMiddleware, corsMiddleware,
+	))
+
 	fmt.Println("Server starting on :5000")
 	if err := http.ListenAndServe(":5000", nil); err != nil {
 		log.Fatalf("Server failed to start: %v", err)
 	}
 }
 
+func newMemoryManager(embedder embedding.EmbeddingInterface, profile config.Profile) memory.MemoryInterface {
+	options := memory.RetrievalOptions{
+		BExactSearch: profile.Retrieval.BExactSearch,
+		SzFusion: profile.Retrieval.SzFusion,
+		FlVectorWeight: profile.Retrieval.FlVectorWeight,
+		FlKeywordWeight: profile.Retrieval.FlKeywordWeight,
+		InRRFK: profile.Retrieval.InRRFK,
+	}
+	consolidation := memory.ConsolidationOptions{
+		FlDedupThreshold: profile.Memory.FlDedupThreshold,
+		TmMinAge: profile.Memory.ConsolidateAfter(),
+		TmInterval: profile.Memory.ConsolidateInterval(),
+		FlClusterThreshold: profile.Memory.FlClusterThreshold,
+		InMinClusterSize: profile.Memory.InMinClusterSize,
+	}
+
+	if profile.SzMemoryBackend == config.MemoryBackendLog {
+		importJSONMemories(profile.SzMemoryFile)
+		return memory.NewLogMemoryManager(embedder, profile.SzMemoryFile, options, consolidation)
+	}
+	return memory.NewMemoryManager(embedder, profile.SzMemoryFile, options, consolidation)
+}
+
+// importJSONMemories fills a memory log that does not exist yet from the
+// JSON dump of the same name, so a profile moved to the log backend keeps
+// its memories.
+func importJSONMemories(szLogFile string) {
+	if _, err := os.Stat(szLogFile); !os.IsNotExist(err) {
+		return
+	}
+
+	szJSONFile := strings.TrimSuffix(szLogFile, filepath.Ext(szLogFile)) + ".json"
+	if _, err := os.Stat(szJSONFile); err != nil {
+		return
+	}
+
+	inImported, err := memory.MigrateJSONToLog(szJSONFile, szLogFile)
+	if err != nil {
+		log.Printf("Failed to import %s into %s: %v\n", szJSONFile, szLogFile, err)
+		return
+	}
+	log.Printf("Imported %d memories from %s into %s\n", inImported, szJSONFile, szLogFile)
+}
+
+func newScanOptions(profile config.Profile) indexer.ScanOptions {
+	return indexer.ScanOptions{
+		Include: profile.Include,
+		Exclude: profile.Exclude,
+		BFollowSymlinks: profile.BFollowSymlinks,
+		BSkipHidden: profile.BSkipHidden,
+		BOneFilesystem: profile.BOneFilesystem,
+	}
+}
+
+func newChunkOptions(profile config.Profile) document.ChunkOptions {
+	return document.ChunkOptions{
+		BCodeAware: profile.Chunking.BCodeAware,
+		InTargetTokens: profile.Chunking.InTargetTokens,
+		InOverlapTokens: profile.Chunking.InOverlapTokens,
+		InParentTokens: profile.Chunking.InParentTokens,
+	}
+}
+
+func newIndexOptions(indexerConfig config.IndexerConfig) indexer.IndexOptions {
+	return indexer.IndexOptions{
+		InWorkers: indexerConfig.Workers(),
+		InBatchSize: indexerConfig.EmbedBatchSize(),
+	}
+}
+
+func newReranker(ollamaMgr ollama.OllamaInterface, profile config.Profile) rerank.RerankInterface {
+	if profile.Retrieval.SzRerankModel == "" {
+		return nil
+	}
+	return rerank.NewLLMReranker(ollamaMgr, profile.Retrieval.SzRerankModel)
+}
+
+func newSummarizer(ollamaMgr ollama.OllamaInterface, profile config.Profile, timeouts config.TimeoutConfig) memory.SummarizerInterface {
+	if profile.Memory.SzSummaryModel == "" {
+		return nil
+	}
+	return memory.NewLLMSummarizer(ollamaMgr, profile.Memory.SzSummaryModel, timeouts.Generate())
+}
+
 func Chain(handler http.Handler, mws ...middleware.Middleware) http.Handler {
 	for i := len(mws) -1;  i >= 0; i-- {
 		handler = mws[i].Handle(handler)